@@ -1,72 +1,394 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
 
 	"net/http"
+	"toggl/app/certs"
 	"toggl/app/config"
+	"toggl/app/events"
+	"toggl/app/grpcserver"
 	"toggl/app/handlers"
+	"toggl/app/metrics"
+	"toggl/app/pb/deckv1"
+	"toggl/app/ratelimit"
 	"toggl/app/repos"
 	"toggl/app/services"
+	"toggl/app/tracing"
+	"toggl/app/webhooks"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 type App struct {
-	httpServer *http.Server
+	// the API, and metrics and probes unless they have a server of their own
+	httpServer  *http.Server
+	adminServer *http.Server
+	listeners   []*listener
+
+	grpcServer   *grpc.Server
+	grpcAddr     string
+	dispatcher   *webhooks.Dispatcher
+	health       *handlers.HealthHandlerImpl
+	repo         *repos.Repository
+	drainTimeout time.Duration
+
+	// serves the TLS certificate, nil to serve plain HTTP and gRPC
+	certs *certs.Reloader
+
+	// reloaded from configPath on changes and SIGHUP, unless it is empty
+	live       *config.Live
+	configPath string
+	logger     *logrus.Logger
+
+	// flushes spans not exported yet
+	stopTracing func(context.Context) error
+
+	// closed once Run listens, on httpAddr and adminAddr when there is one
+	listening chan struct{}
+	httpAddr  string
+	adminAddr string
+
+	// closed by Stop, and once Run has shut down with runErr
+	stopping chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+	runErr   error
 }
 
-func NewApp(config *config.Config) (*App, error) {
+func NewApp(conf *config.Config, logger *logrus.Logger) (*App, error) {
 
 	// Create a new HTTP server with the desired configuration
-	httpServer := &http.Server{
-		Addr: fmt.Sprintf(":%d", config.Port),
+	httpServer := newHTTPServer(conf, logger)
+
+	// Serve over TLS, with HTTP/2, when a certificate is configured
+	var reloader *certs.Reloader
+	if conf.TLS.CertFile != "" {
+		var err error
+		reloader, err = certs.NewReloader(conf.TLS.CertFile, conf.TLS.KeyFile, conf.TLS.ClientCAFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		httpServer.TLSConfig = reloader.TLSConfig()
+	}
+
+	// Fail on settings that can't be served before tracing starts and the
+	// database opens, so there is nothing to shut down yet
+	var socketMode os.FileMode
+	if conf.UnixSocket.Path != "" {
+		var err error
+		socketMode, err = conf.UnixSocket.FileMode()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	logger := logrus.New()
+	// Settings safe to change at runtime are read from the live config
+	live := config.NewLive(conf)
 
-	deckRepo := repos.NewRepository(logger, false, config)
+	// Trace requests through handlers, services and the repository
+	stopTracing, err := tracing.Setup(context.Background(), conf.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	deckRepo := repos.NewRepository(logger, false, live)
+	metrics.CountDecksWith(deckRepo.CountDecks)
 	// Create new services for the app
-	deckService := services.NewDeckService(logger, deckRepo)
+	broker := events.NewBroker(conf.EventBufferSize)
+	deckService := services.NewDeckService(logger, deckRepo, broker)
+	webhookService := services.NewWebhookService(logger, deckRepo)
+	authService := services.NewAuthService(logger, deckRepo)
+	tenantService := services.NewTenantService(logger, deckRepo)
+
+	// Queue webhook deliveries for deck lifecycle events
+	dispatcher := webhooks.NewDispatcher(logger, deckRepo)
+	if conf.WebhookMaxAttempts > 0 {
+		dispatcher.MaxAttempts = conf.WebhookMaxAttempts
+	}
+	broker.Listen(dispatcher.Handle)
+
+	// End event streams when shutting down, rather than wait for them to drain
+	httpServer.RegisterOnShutdown(broker.Close)
 
 	// Create new handlers for the app, injecting the services
 	deckHandler := handlers.NewDeckHandler(deckService, logger)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, logger)
+	authHandler := handlers.NewAuthHandler(authService, logger)
+	tenantHandler := handlers.NewTenantHandler(tenantService, logger)
+	healthHandler := handlers.NewHealthHandler(deckRepo, logger)
 
 	// Create a new ServeMux object
 	mux := mux.NewRouter()
 
 	// Register the routes with the ServeMux object
-	RegisterRoutes(mux, deckHandler)
+	RegisterRoutes(mux, deckHandler, webhookHandler, authHandler, tenantHandler, healthHandler, authService, ratelimit.NewMemoryStore(), deckRepo, logger, live)
 
 	// Attach the ServeMux to the HTTP server
 	httpServer.Handler = mux
 
-	return &App{httpServer: httpServer}, nil
+	// The API is served on Port, and on a Unix socket for sidecars when one is set
+	listeners := []*listener{
+		{name: "api", server: httpServer, network: "tcp", address: fmt.Sprintf(":%d", conf.Port), tls: reloader != nil},
+	}
+	if conf.UnixSocket.Path != "" {
+		listeners = append(listeners, &listener{name: "api", server: httpServer, network: "unix", address: conf.UnixSocket.Path, mode: socketMode, tls: reloader != nil})
+	}
+
+	// Metrics and probes get a plain HTTP server of their own on the admin
+	// port, so scrapers and the orchestrator need no certificate or API access
+	var adminServer *http.Server
+	if conf.AdminPort != 0 {
+		adminServer = newHTTPServer(conf, logger)
+		adminServer.Handler = newOpsRouter(healthHandler, logger, conf)
+		listeners = append(listeners, &listener{name: "admin", server: adminServer, network: "tcp", address: fmt.Sprintf(":%d", conf.AdminPort)})
+	}
+
+	app := &App{
+		httpServer:   httpServer,
+		adminServer:  adminServer,
+		listeners:    listeners,
+		dispatcher:   dispatcher,
+		health:       healthHandler,
+		repo:         deckRepo,
+		drainTimeout: time.Duration(conf.DrainTimeout) * time.Second,
+		stopTracing:  stopTracing,
+		certs:        reloader,
+		live:         live,
+		logger:       logger,
+		listening:    make(chan struct{}),
+		stopping:     make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+
+	// Serve the same deck service over gRPC, unless disabled with a zero port
+	if conf.GrpcPort != 0 {
+		opts := []grpc.ServerOption{
+			grpc.UnaryInterceptor(grpcserver.UnaryAuthInterceptor(authService, conf.RequireAPIKey)),
+			grpc.StreamInterceptor(grpcserver.StreamAuthInterceptor(authService, conf.RequireAPIKey)),
+		}
+		if reloader != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.TLSConfig())))
+		}
+		app.grpcServer = grpc.NewServer(opts...)
+		deckv1.RegisterDeckServiceServer(app.grpcServer, grpcserver.NewDeckServer(deckService, logger))
+		app.grpcAddr = fmt.Sprintf(":%d", conf.GrpcPort)
+	}
+
+	return app, nil
 
 }
 
-func (a *App) Start() error {
-	log.Printf("Starting server on %s", a.httpServer.Addr)
+// an HTTP server with the timeouts from conf, logging its errors, such as
+// failed TLS handshakes
+func newHTTPServer(conf *config.Config, logger *logrus.Logger) *http.Server {
+	return &http.Server{
+		ReadHeaderTimeout: time.Duration(conf.ReadHeaderTimeout) * time.Second,
+		ReadTimeout:       time.Duration(conf.ReadTimeout) * time.Second,
+		WriteTimeout:      time.Duration(conf.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(conf.IdleTimeout) * time.Second,
+		ErrorLog:          log.New(logger.WriterLevel(logrus.WarnLevel), "", 0),
+	}
+}
+
+// Serve HTTP and gRPC and send webhooks until ctx is done, Stop is called or
+// a server fails, then shut down gracefully. The app can't be run again
+// afterwards.
+func (a *App) Run(ctx context.Context) (err error) {
+	defer func() {
+		a.runErr = err
+		close(a.stopped)
+	}()
+
+	// watchers stop with the app however it is stopped
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Bind every address before serving any, so a taken one fails fast
+	for i, l := range a.listeners {
+		err = l.listen()
+		if err != nil {
+			a.closeListeners(i)
+			return errors.Join(err, a.close())
+		}
+	}
+
+	var grpcListener net.Listener
+	if a.grpcServer != nil {
+		grpcListener, err = net.Listen("tcp", a.grpcAddr)
+		if err != nil {
+			a.closeListeners(len(a.listeners))
+			return errors.Join(err, a.close())
+		}
+	}
+
+	a.httpAddr = a.listeners[0].Addr().String()
+	if a.adminServer != nil {
+		a.adminAddr = a.listeners[len(a.listeners)-1].Addr().String()
+	}
+	if grpcListener != nil {
+		a.grpcAddr = grpcListener.Addr().String()
+	}
+	close(a.listening)
+
+	// Send webhook deliveries in the background
+	dispatcherCtx, stopDispatcher := context.WithCancel(context.Background())
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		a.dispatcher.Run(dispatcherCtx)
+	}()
 
-	// Start the HTTP server
-	err := a.httpServer.ListenAndServe()
-	if err != nil && err != http.ErrServerClosed {
-		return err
+	// Reload the config while running, when it was read from a file
+	if a.configPath != "" {
+		go a.watchConfig(ctx)
 	}
 
-	return nil
+	// Pick up renewed certificates
+	if a.certs != nil {
+		go a.certs.Watch(ctx)
+	}
+
+	served := make(chan error, len(a.listeners)+1)
+	if a.grpcServer != nil {
+		a.logger.WithFields(logrus.Fields{"addr": a.grpcAddr, "tls": a.certs != nil}).Info("Starting gRPC server")
+		go func() {
+			err := a.grpcServer.Serve(grpcListener)
+			if err != nil {
+				served <- fmt.Errorf("grpc server: %w", err)
+			}
+		}()
+	}
+
+	for _, l := range a.listeners {
+		a.logger.WithFields(logrus.Fields{"server": l.name, "network": l.network, "addr": l.Addr().String(), "tls": l.tls}).Info("Starting server")
+		go func(l *listener) {
+			err := l.serve()
+			if err != nil {
+				served <- err
+			}
+		}(l)
+	}
+
+	select {
+	case <-ctx.Done():
+		err = nil
+	case <-a.stopping:
+		err = nil
+	case err = <-served:
+	}
+
+	return errors.Join(err, a.shutdown(stopDispatcher, dispatcherDone))
 }
 
+// Stop the app Run is serving as if its context was done, and wait for it to
+// drain and shut down. Returns the error Run returns, and can be called more
+// than once, but only once Run was started.
 func (a *App) Stop() error {
-	log.Printf("Stopping server on %s", a.httpServer.Addr)
+	a.stopOnce.Do(func() { close(a.stopping) })
+	<-a.stopped
+	return a.runErr
+}
 
-	// Shutdown the HTTP server gracefully
-	err := a.httpServer.Shutdown(nil)
-	if err != nil {
-		return err
+// Closed once Run listens for requests
+func (a *App) Listening() <-chan struct{} {
+	return a.listening
+}
+
+// The TCP address the HTTP API listens on, once Listening is closed
+func (a *App) HTTPAddr() string {
+	return a.httpAddr
+}
+
+// The address metrics and probes are served on once Listening is closed, empty
+// when they are served with the API
+func (a *App) AdminAddr() string {
+	return a.adminAddr
+}
+
+// Stop taking traffic and let requests in flight finish within the drain
+// timeout, then stop the webhook dispatcher, export the last spans and close
+// the database
+func (a *App) shutdown(stopDispatcher context.CancelFunc, dispatcherDone <-chan struct{}) error {
+	// Fail readiness checks first, so no new traffic is routed here
+	a.health.Drain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.drainTimeout)
+	defer cancel()
+
+	// Drain every server at once, cutting off what is left at the deadline.
+	// Shutting down an HTTP server closes all of its listeners.
+	servers := map[string]*http.Server{"api": a.httpServer}
+	if a.adminServer != nil {
+		servers["admin"] = a.adminServer
+	}
+	stopped := make(chan error, len(servers)+1)
+	if a.grpcServer != nil {
+		a.logger.WithField("addr", a.grpcAddr).Info("Stopping gRPC server")
+		go func() { stopped <- a.stopGrpc(ctx) }()
+	} else {
+		stopped <- nil
+	}
+	for name, server := range servers {
+		a.logger.WithField("server", name).Info("Stopping server")
+		go func(name string, server *http.Server) {
+			err := server.Shutdown(ctx)
+			if err != nil {
+				server.Close()
+				err = fmt.Errorf("%s server: %w", name, err)
+			}
+			stopped <- err
+		}(name, server)
 	}
 
-	return nil
+	var err error
+	for i := 0; i < len(servers)+1; i++ {
+		err = errors.Join(err, <-stopped)
+	}
+
+	// Stop sending webhooks, unsent deliveries are picked up after a restart
+	stopDispatcher()
+	<-dispatcherDone
+
+	return errors.Join(err, a.close())
+}
+
+// let in-flight RPCs finish, cancelling those still running when ctx is done
+func (a *App) stopGrpc(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		a.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		a.grpcServer.Stop()
+		<-stopped
+		return fmt.Errorf("grpc server: %w", ctx.Err())
+	}
+}
+
+// close the first n listeners, which Run bound before failing
+func (a *App) closeListeners(n int) {
+	for _, l := range a.listeners[:n] {
+		l.Close()
+	}
+}
+
+// Export the spans of the last requests and close the database
+func (a *App) close() error {
+	return errors.Join(a.stopTracing(context.Background()), a.repo.Close())
 }
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"toggl/app/logging"
+)
+
+// prefix of every API key, so leaked keys are easy to recognise
+const KeyPrefix = "tk_"
+
+var ErrInvalidKey = errors.New("Invalid API key")
+
+// The caller of a request, known from its API key
+type Principal struct {
+	KeyID    string
+	TenantID string
+}
+
+// Resolves an API key to its principal, ErrInvalidKey for unknown or revoked keys
+type Authenticator interface {
+	Authenticate(ctx context.Context, key string) (*Principal, error)
+}
+
+type principalKey struct{}
+
+// Attach the caller to a context, and its tenant to the entries logged with it
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	ctx = logging.With(ctx, logging.TenantID, principal.TenantID)
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Get the caller of the request the context belongs to
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// The tenant the caller acts for, empty for anonymous callers
+func TenantID(ctx context.Context) string {
+	principal, ok := FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return principal.TenantID
+}
+
+// Generate a new random API key
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// Keys are only stored hashed. They are random and long, so a fast hash is enough.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,141 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// certificate and key are rarely written at once, reload once both are done
+const reloadDelay = 100 * time.Millisecond
+
+// Serves the TLS certificate in a pair of PEM files, reloading it when the
+// files change so renewed certificates apply without a restart. With a client
+// CA file, clients must present a certificate signed by one of its CAs.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	logger       *logrus.Logger
+
+	// swapped on reloads, handshakes see either the old or the new one
+	current atomic.Pointer[tls.Config]
+}
+
+// Load the certificate in certFile and keyFile, and the CAs in clientCAFile
+// unless it is empty
+func NewReloader(certFile string, keyFile string, clientCAFile string, logger *logrus.Logger) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile, logger: logger}
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// A server config handing every handshake the files loaded last. It offers
+// HTTP/2, which gRPC needs and HTTP clients get when they support it.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// Load the files again, keeping the current certificate when they are invalid
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("loading client CAs: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("loading client CAs: no certificates in %s", r.clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.current.Store(config)
+	return nil
+}
+
+// The certificate handed to clients
+func (r *Reloader) Certificate() *x509.Certificate {
+	return r.current.Load().Certificates[0].Leaf
+}
+
+// Reload the files whenever they change until ctx is done
+func (r *Reloader) Watch(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		r.logger.WithError(err).Warn("Not watching the TLS certificate, renewals need a restart")
+		return
+	}
+	defer watcher.Close()
+
+	// Watch the directories, as mounted secrets are swapped through a symlink
+	// rather than written in place
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if file == "" {
+			continue
+		}
+		err = watcher.Add(filepath.Dir(file))
+		if err != nil {
+			r.logger.WithError(err).WithField("path", file).Warn("Not watching the TLS certificate, renewals need a restart")
+			return
+		}
+	}
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-watcher.Events:
+			if !event.Has(fsnotify.Chmod) {
+				reload = time.After(reloadDelay)
+			}
+		case err := <-watcher.Errors:
+			r.logger.WithError(err).Warn("Error watching the TLS certificate")
+		case <-reload:
+			reload = nil
+			err := r.Reload()
+			if err != nil {
+				r.logger.WithError(err).Error("Error reloading TLS certificate, keeping the current one")
+				continue
+			}
+			r.logger.WithFields(logrus.Fields{
+				"cert_file": r.certFile,
+				"not_after": r.Certificate().NotAfter,
+			}).Info("TLS certificate reloaded")
+		}
+	}
+}
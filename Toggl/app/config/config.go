@@ -1,15 +1,88 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"toggl/app/logging"
+	"unicode"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Port     int
-	Timeout  int
-	Database Database
+	LogLevel           string
+	LogFormat          string
+	Port               int
+	GrpcPort           int
+	AdminPort          int
+	UnixSocket         UnixSocket
+	Timeout            int
+	ReadHeaderTimeout  int
+	ReadTimeout        int
+	WriteTimeout       int
+	IdleTimeout        int
+	DrainTimeout       int
+	EventBufferSize    int
+	WebhookMaxAttempts int
+	RequireAPIKey      bool
+	AdminKey           string
+	MaxDecksPerTenant  int
+	MaxCardsPerDeck    int
+	CreateRateLimit    RateLimit
+	DrawRateLimit      RateLimit
+	DeckDrawRateLimit  RateLimit
+	IdempotencyWindow  int
+	MetricsPath        string
+	Tracing            Tracing
+	TLS                TLS
+	Database           Database
+}
+
+// where spans are exported to, Exporter is otlp, stdout or empty to turn
+// tracing off
+type Tracing struct {
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	SampleRatio float64
+	ServiceName string
+}
+
+// serves the HTTP API on a Unix domain socket as well when Path is set, Mode
+// being the permissions of the socket file in octal, such as 0660
+type UnixSocket struct {
+	Path string
+	Mode string
+}
+
+// The permissions of the socket file
+func (s UnixSocket) FileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("must be octal permissions such as 0660, got %q", s.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// serves HTTP and gRPC over TLS when CertFile and KeyFile are set, the PEM
+// files are reloaded when they change. With ClientCAFile, clients must present
+// a certificate signed by one of its CAs.
+type TLS struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+// requests a client may make per minute, in bursts of up to Burst
+type RateLimit struct {
+	PerMinute int
+	Burst     int
 }
 
 type Database struct {
@@ -17,33 +90,234 @@ type Database struct {
 	ProdPath string
 }
 
-func LoadConfig(isTest bool) (*Config, error) {
+// The config file used when none is given, if it exists
+const DefaultPath = "./app/config/config.yml"
+
+// Prefix of the environment variables overriding the configuration
+const EnvPrefix = "POCKER_"
+
+// environment variables not named after their field
+var envNames = map[string]string{
+	"Database.ProdPath": "DATABASE_PATH",
+}
+
+// Load the configuration from the YAML file at path, then override it with
+// environment variables: POCKER_ followed by the setting in upper snake case,
+// such as POCKER_PORT or POCKER_TRACING_SAMPLE_RATIO. Without a path the
+// file at DefaultPath is read when there is one, and defaults are used
+// otherwise. The configuration isn't validated.
+func Load(path string) (*Config, error) {
+	v := viper.New()
+
 	// Set the default values for configuration fields
-	viper.SetDefault("Port", 8080)
-	viper.SetDefault("Timeout", 30)
+	v.SetDefault("LogLevel", "info")
+	v.SetDefault("LogFormat", logging.FormatJSON)
+	v.SetDefault("Port", 8080)
+	v.SetDefault("GrpcPort", 9090)
+	v.SetDefault("UnixSocket.Mode", "0660")
+	v.SetDefault("Timeout", 30)
+	v.SetDefault("ReadHeaderTimeout", 5)
+	v.SetDefault("ReadTimeout", 15)
+	v.SetDefault("WriteTimeout", 60)
+	v.SetDefault("IdleTimeout", 120)
+	v.SetDefault("DrainTimeout", 30)
+	v.SetDefault("EventBufferSize", 64)
+	v.SetDefault("WebhookMaxAttempts", 8)
+	v.SetDefault("RequireAPIKey", true)
+	v.SetDefault("MaxDecksPerTenant", 1000)
+	v.SetDefault("MaxCardsPerDeck", 52)
+	v.SetDefault("CreateRateLimit.PerMinute", 60)
+	v.SetDefault("CreateRateLimit.Burst", 10)
+	v.SetDefault("DrawRateLimit.PerMinute", 600)
+	v.SetDefault("DrawRateLimit.Burst", 60)
+	v.SetDefault("DeckDrawRateLimit.PerMinute", 300)
+	v.SetDefault("DeckDrawRateLimit.Burst", 30)
+	v.SetDefault("IdempotencyWindow", 86400)
+	v.SetDefault("MetricsPath", "/metrics")
+	v.SetDefault("Tracing.Endpoint", "localhost:4317")
+	v.SetDefault("Tracing.SampleRatio", 1)
+	v.SetDefault("Tracing.ServiceName", "toggl-deck")
+	v.SetDefault("Database.ProdPath", "./app/db/deck.db")
 
 	// Load configuration from a YAML file
-	viper.SetConfigName("config")
-	viper.SetConfigType("yml")
-	if isTest == true {
-		viper.AddConfigPath("../../../app/config/")
-	} else {
-		viper.AddConfigPath("./app/config/")
+	path = FindFile(path)
+	if path != "" {
+		v.SetConfigFile(path)
+		v.SetConfigType("yml")
+		err := v.ReadInConfig()
+		if err != nil {
+			return nil, fmt.Errorf("reading config file %s: %w", path, err)
+		}
 	}
 
-	err := viper.ReadInConfig()
+	var err error
+	walk(reflect.ValueOf(Config{}), "", func(key string, _ reflect.Value) {
+		if err == nil {
+			err = v.BindEnv(key, EnvPrefix+envName(key))
+		}
+	})
 	if err != nil {
-		log.Printf("Unable to read config file: %v", err)
 		return nil, err
 	}
 
 	// Map the configuration fields to the Config struct
 	var cfg Config
-	err = viper.Unmarshal(&cfg)
+	err = v.Unmarshal(&cfg)
 	if err != nil {
-		log.Printf("Unable to parse config file: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("parsing configuration: %w", err)
 	}
 
 	return &cfg, nil
 }
+
+// The config file Load reads for path: path itself, or DefaultPath when path is
+// empty and DefaultPath exists, or empty for none
+func FindFile(path string) string {
+	if path == "" {
+		if _, err := os.Stat(DefaultPath); err == nil {
+			return DefaultPath
+		}
+	}
+	return path
+}
+
+// Check the configuration, reporting every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s (%s%s): %s", key, EnvPrefix, envName(key), fmt.Sprintf(format, args...)))
+	}
+
+	port := func(key string, port int) {
+		if port < 0 || port > 65535 {
+			invalid(key, "must be a port between 0 and 65535, got %d", port)
+		}
+	}
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		invalid("LogLevel", "must be one of panic, fatal, error, warn, info, debug or trace, got %q", c.LogLevel)
+	}
+	if c.LogFormat != logging.FormatJSON && c.LogFormat != logging.FormatText {
+		invalid("LogFormat", "must be json or text, got %q", c.LogFormat)
+	}
+
+	port("Port", c.Port)
+	port("GrpcPort", c.GrpcPort)
+	if c.Port != 0 && c.Port == c.GrpcPort {
+		invalid("GrpcPort", "must differ from Port %d", c.Port)
+	}
+	port("AdminPort", c.AdminPort)
+	if c.AdminPort != 0 && (c.AdminPort == c.Port || c.AdminPort == c.GrpcPort) {
+		invalid("AdminPort", "must differ from Port and GrpcPort, got %d", c.AdminPort)
+	}
+	if c.UnixSocket.Path != "" {
+		if _, err := c.UnixSocket.FileMode(); err != nil {
+			invalid("UnixSocket.Mode", "%s", err)
+		}
+	}
+
+	notNegative := func(key string, value int) {
+		if value < 0 {
+			invalid(key, "must not be negative, got %d", value)
+		}
+	}
+	notNegative("Timeout", c.Timeout)
+	notNegative("ReadHeaderTimeout", c.ReadHeaderTimeout)
+	notNegative("ReadTimeout", c.ReadTimeout)
+	notNegative("WriteTimeout", c.WriteTimeout)
+	notNegative("IdleTimeout", c.IdleTimeout)
+	notNegative("DrainTimeout", c.DrainTimeout)
+	notNegative("EventBufferSize", c.EventBufferSize)
+	notNegative("WebhookMaxAttempts", c.WebhookMaxAttempts)
+	notNegative("MaxDecksPerTenant", c.MaxDecksPerTenant)
+	notNegative("MaxCardsPerDeck", c.MaxCardsPerDeck)
+	notNegative("IdempotencyWindow", c.IdempotencyWindow)
+	for key, limit := range map[string]RateLimit{"CreateRateLimit": c.CreateRateLimit, "DrawRateLimit": c.DrawRateLimit, "DeckDrawRateLimit": c.DeckDrawRateLimit} {
+		notNegative(key+".PerMinute", limit.PerMinute)
+		notNegative(key+".Burst", limit.Burst)
+	}
+
+	if c.MetricsPath != "" && !strings.HasPrefix(c.MetricsPath, "/") {
+		invalid("MetricsPath", "must start with /, got %q", c.MetricsPath)
+	}
+	if c.Tracing.Exporter != "" && c.Tracing.ServiceName == "" {
+		invalid("Tracing.ServiceName", "is required when tracing")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid("Tracing.SampleRatio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+	if c.TLS.CertFile != "" && c.TLS.KeyFile == "" {
+		invalid("TLS.KeyFile", "is required with TLS.CertFile")
+	}
+	if c.TLS.KeyFile != "" && c.TLS.CertFile == "" {
+		invalid("TLS.CertFile", "is required with TLS.KeyFile")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		invalid("TLS.ClientCAFile", "needs TLS.CertFile and TLS.KeyFile")
+	}
+	if c.Database.ProdPath == "" {
+		invalid("Database.ProdPath", "is required")
+	}
+	// API keys are issued on the admin routes, which aren't served without
+	// an admin key, so no request could ever be authorized
+	if c.RequireAPIKey && c.AdminKey == "" {
+		invalid("AdminKey", "is required when RequireAPIKey is set, API keys can't be issued without it")
+	}
+
+	// the same order every time, rate limits come from a map
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// settings that are never printed
+var secrets = map[string]bool{"AdminKey": true}
+
+// A copy of the configuration with secrets redacted, safe to print
+func (c Config) Redacted() Config {
+	if c.AdminKey != "" {
+		c.AdminKey = "REDACTED"
+	}
+	return c
+}
+
+// visit every setting of a config struct, nested keys joined with dots
+func walk(v reflect.Value, prefix string, visit func(key string, value reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), prefix+field.Name+".", visit)
+			continue
+		}
+		visit(prefix+field.Name, v.Field(i))
+	}
+}
+
+// the environment variable of a key without the prefix, such as
+// TRACING_SAMPLE_RATIO for Tracing.SampleRatio or REQUIRE_API_KEY for
+// RequireAPIKey
+func envName(key string) string {
+	if name, ok := envNames[key]; ok {
+		return name
+	}
+
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		if r == '.' {
+			b.WriteRune('_')
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) && runes[i-1] != '.' {
+			previousLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if previousLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
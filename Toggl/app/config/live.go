@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Provides the configuration in force, which may change while the service runs
+type Source interface {
+	Current() *Config
+}
+
+// A configuration that never changes
+func (c *Config) Current() *Config {
+	return c
+}
+
+// The configuration of a running service. Reloads swap it atomically, so a
+// request sees either the old or the new settings, never a mix.
+type Live struct {
+	mu      sync.Mutex
+	current atomic.Pointer[Config]
+}
+
+// Setup the live configuration starting from conf
+func NewLive(conf *Config) *Live {
+	l := &Live{}
+	l.current.Store(conf)
+	return l
+}
+
+// The configuration in force. It must not be modified, reloads replace it.
+func (l *Live) Current() *Config {
+	return l.current.Load()
+}
+
+// Load the configuration again from path and the environment and swap in its
+// settings that are safe to change at runtime: the log level, rate limits and
+// default tenant limits. Returns the changes applied, and the changes that
+// need a restart to apply. An invalid configuration changes nothing.
+func (l *Live) Reload(path string) (applied []string, restart []string, err error) {
+	next, err := Load(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = next.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current := l.current.Load()
+	reloaded := *current
+	reloaded.LogLevel = next.LogLevel
+	reloaded.CreateRateLimit = next.CreateRateLimit
+	reloaded.DrawRateLimit = next.DrawRateLimit
+	reloaded.DeckDrawRateLimit = next.DeckDrawRateLimit
+	reloaded.MaxDecksPerTenant = next.MaxDecksPerTenant
+	reloaded.MaxCardsPerDeck = next.MaxCardsPerDeck
+
+	l.current.Store(&reloaded)
+	return Diff(current, &reloaded), Diff(&reloaded, next), nil
+}
+
+// Settings that differ between two configurations, as "Key: old -> new".
+// Secrets are only reported as changed.
+func Diff(from *Config, to *Config) []string {
+	previous := make(map[string]interface{})
+	walk(reflect.ValueOf(*from), "", func(key string, value reflect.Value) {
+		previous[key] = value.Interface()
+	})
+
+	var changes []string
+	walk(reflect.ValueOf(*to), "", func(key string, value reflect.Value) {
+		if previous[key] == value.Interface() {
+			return
+		}
+		if secrets[key] {
+			changes = append(changes, key+" changed")
+			return
+		}
+		changes = append(changes, fmt.Sprintf("%s: %#v -> %#v", key, previous[key], value.Interface()))
+	})
+	return changes
+}
@@ -0,0 +1,6 @@
+package dtos
+
+type ReqCreateAPIKey struct {
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+}
@@ -0,0 +1,7 @@
+package dtos
+
+type ReqCreateDeck struct {
+	Shuffle  bool              `json:"shuffle"`
+	Cards    []string          `json:"cards"`
+	Metadata map[string]string `json:"metadata"`
+}
@@ -0,0 +1,7 @@
+package dtos
+
+type ReqCreateWebhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
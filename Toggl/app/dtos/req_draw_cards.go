@@ -0,0 +1,6 @@
+package dtos
+
+type ReqDrawCards struct {
+	DeckID string `json:"deck_id"`
+	Count  int    `json:"count"`
+}
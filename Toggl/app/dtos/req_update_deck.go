@@ -0,0 +1,6 @@
+package dtos
+
+// Metadata keys set to null are removed, other keys are added or replaced
+type ReqUpdateDeck struct {
+	Metadata map[string]*string `json:"metadata"`
+}
@@ -0,0 +1,7 @@
+package dtos
+
+// Limits of a tenant, a limit left out falls back to the configured default
+type ReqUpdateTenant struct {
+	MaxDecks        *int `json:"max_decks"`
+	MaxCardsPerDeck *int `json:"max_cards_per_deck"`
+}
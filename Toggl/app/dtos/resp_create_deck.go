@@ -4,4 +4,9 @@ type RespCreateDeck struct {
 	DeckID    string `json:"deck_id"`
 	Shuffled  bool   `json:"shuffled"`
 	Remaining int    `json:"remaining"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// sent as the ETag header
+	Version int `json:"-"`
 }
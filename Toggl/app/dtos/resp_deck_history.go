@@ -0,0 +1,19 @@
+package dtos
+
+import "time"
+
+type RespDeckHistory struct {
+	DeckID string          `json:"deck_id"`
+	Events []RespDeckEvent `json:"events"`
+}
+
+type RespDeckEvent struct {
+	Seq       int               `json:"seq"`
+	Type      string            `json:"type"`
+	DeckID    string            `json:"deck_id"`
+	Remaining int               `json:"remaining"`
+	Shuffled  bool              `json:"shuffled,omitempty"`
+	Cards     []RespDrawCard    `json:"cards,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
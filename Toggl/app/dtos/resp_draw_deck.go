@@ -2,6 +2,9 @@ package dtos
 
 type RespDrawDeck struct {
 	Cards []RespDrawCard `json:"cards"`
+
+	// sent as the ETag header
+	Version int `json:"-"`
 }
 
 type RespDrawCard struct {
@@ -0,0 +1,11 @@
+package dtos
+
+type RespError struct {
+	Error  string           `json:"error"`
+	Fields []RespFieldError `json:"fields,omitempty"`
+}
+
+type RespFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,16 @@
+package dtos
+
+import "time"
+
+type RespListDecks struct {
+	Decks      []RespDeckSummary `json:"decks"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+type RespDeckSummary struct {
+	DeckID    string            `json:"deck_id"`
+	Shuffled  bool              `json:"shuffled"`
+	Remaining int               `json:"remaining"`
+	CreatedAt time.Time         `json:"created_at"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
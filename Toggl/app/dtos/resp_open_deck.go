@@ -5,6 +5,10 @@ type RespOpenDeck struct {
 	Shuffled  bool               `json:"shuffled"`
 	Remaining int                `json:"remaining"`
 	Cards     []RespOpenDeckCard `json:"cards"`
+	Metadata  map[string]string  `json:"metadata,omitempty"`
+
+	// sent as the ETag header
+	Version int `json:"-"`
 }
 
 type RespOpenDeckCard struct {
@@ -0,0 +1,22 @@
+package dtos
+
+import "time"
+
+type RespTenantLimits struct {
+	MaxDecks        int `json:"max_decks"`
+	MaxCardsPerDeck int `json:"max_cards_per_deck"`
+}
+
+type RespTenantUsage struct {
+	TenantID  string           `json:"tenant_id"`
+	Decks     int              `json:"decks"`
+	Cards     int              `json:"cards"`
+	APIKeys   int              `json:"api_keys"`
+	Webhooks  int              `json:"webhooks"`
+	Limits    RespTenantLimits `json:"limits"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+type RespListTenants struct {
+	Tenants []RespTenantUsage `json:"tenants"`
+}
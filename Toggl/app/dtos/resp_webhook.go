@@ -0,0 +1,32 @@
+package dtos
+
+import "time"
+
+type RespWebhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RespListWebhooks struct {
+	Webhooks []RespWebhook `json:"webhooks"`
+}
+
+type RespWebhookDelivery struct {
+	ID             string     `json:"id"`
+	EventType      string     `json:"event_type"`
+	DeckID         string     `json:"deck_id"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+type RespWebhookDeliveries struct {
+	Deliveries []RespWebhookDelivery `json:"deliveries"`
+}
@@ -0,0 +1,142 @@
+package events
+
+import (
+	"sync"
+	"toggl/app/models"
+)
+
+// events a subscriber may fall behind by before it is disconnected
+const DefaultBufferSize = 64
+
+// In-process pub/sub of deck events. Publishing never blocks: a subscriber
+// whose buffer is full is disconnected instead of slowing down the service,
+// and can subscribe again and reload the deck.
+type Broker struct {
+	mu          sync.Mutex
+	bufferSize  int
+	subscribers map[string]map[*Subscription]struct{}
+	listeners   []func(models.DeckEvent)
+	closed      bool
+}
+
+// A subscription to the events of one deck
+type Subscription struct {
+	deckId     string
+	events     chan models.DeckEvent
+	broker     *Broker
+	overflowed bool
+}
+
+// Setup a new broker, bufferSize of 0 uses DefaultBufferSize
+func NewBroker(bufferSize int) *Broker {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Broker{bufferSize: bufferSize, subscribers: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscribe to the events of a deck. The subscription must be closed when
+// done. Once the broker is closed the subscription ends right away.
+func (b *Broker) Subscribe(deckId string) *Subscription {
+	sub := &Subscription{deckId: deckId, events: make(chan models.DeckEvent, b.bufferSize), broker: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.events)
+		return sub
+	}
+	if b.subscribers[deckId] == nil {
+		b.subscribers[deckId] = make(map[*Subscription]struct{})
+	}
+	b.subscribers[deckId][sub] = struct{}{}
+
+	return sub
+}
+
+// Register a function called with the events of every deck. Unlike a
+// subscriber it sees every event, so it must return quickly.
+func (b *Broker) Listen(listener func(models.DeckEvent)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, listener)
+}
+
+// Send an event to the listeners and every subscriber of its deck
+func (b *Broker) Publish(event models.DeckEvent) {
+	b.mu.Lock()
+	listeners := b.listeners
+	b.mu.Unlock()
+	for _, listener := range listeners {
+		listener(event)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers[event.DeckID] {
+		select {
+		case sub.events <- event:
+		default:
+			// the subscriber can't keep up, drop it rather than block
+			sub.overflowed = true
+			b.remove(sub)
+		}
+	}
+}
+
+// Number of subscribers of a deck
+func (b *Broker) Subscribers(deckId string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers[deckId])
+}
+
+// End every subscription, so streams of deck events finish when the server
+// shuts down. Listeners still get published events.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, subs := range b.subscribers {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+}
+
+// remove a subscriber and close its channel, the caller holds the lock
+func (b *Broker) remove(sub *Subscription) {
+	subs, ok := b.subscribers[sub.deckId]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subscribers, sub.deckId)
+	}
+	close(sub.events)
+}
+
+// Events of the deck, the channel is closed when the subscription ends
+func (s *Subscription) Events() <-chan models.DeckEvent {
+	return s.events
+}
+
+// Whether the subscription ended because the subscriber fell behind
+func (s *Subscription) Overflowed() bool {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.overflowed
+}
+
+// Stop receiving events, safe to call more than once
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
@@ -0,0 +1,83 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"toggl/app/auth"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Authenticate unary calls by their API key, the same way as HTTP requests
+func UnaryAuthInterceptor(authenticator auth.Authenticator, required bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, authenticator, required)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Authenticate streaming calls by their API key
+func StreamAuthInterceptor(authenticator auth.Authenticator, required bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), authenticator, required)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// a server stream carrying the caller in its context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// attach the caller to the context, from the authorization or x-api-key metadata
+func authenticate(ctx context.Context, authenticator auth.Authenticator, required bool) (context.Context, error) {
+	key := metadataKey(ctx)
+	if key == "" && !required {
+		return ctx, nil
+	}
+	if key == "" {
+		return nil, status.Error(codes.Unauthenticated, "API key is required")
+	}
+
+	principal, err := authenticator.Authenticate(ctx, key)
+	if errors.Is(err, auth.ErrInvalidKey) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Internal server error")
+	}
+
+	return auth.NewContext(ctx, principal), nil
+}
+
+func metadataKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, authorization := range md.Get("authorization") {
+		scheme, token, ok := strings.Cut(authorization, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
@@ -0,0 +1,192 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"toggl/app/auth"
+	"toggl/app/logging"
+	"toggl/app/pb/deckv1"
+	"toggl/app/services"
+	"toggl/app/utils"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DeckServer serves the deck service over gRPC
+type DeckServer struct {
+	deckv1.UnimplementedDeckServiceServer
+	deckservice services.DeckService
+	logger      *logrus.Logger
+}
+
+// Setup a new DeckServer with deck service and logger
+func NewDeckServer(deckService services.DeckService, logger *logrus.Logger) *DeckServer {
+	return &DeckServer{deckservice: deckService, logger: logger}
+}
+
+// Create a new deck
+func (s *DeckServer) CreateNewDeck(ctx context.Context, req *deckv1.CreateDeckRequest) (*deckv1.CreateDeckResponse, error) {
+	for _, code := range req.Cards {
+		err := services.ValidateCardCode(code)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s is not a valid card code: %s", code, err)
+		}
+	}
+
+	deck, err := s.deckservice.CreateNewDeck(ctx, auth.TenantID(ctx), req.Shuffle, strings.Join(req.Cards, ","), req.Metadata)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error creating new deck")
+		return nil, toStatus(err)
+	}
+	setETag(ctx, deck.Version)
+
+	return deckv1.FromRespCreateDeck(deck), nil
+}
+
+// Open a deck
+func (s *DeckServer) OpenDeck(ctx context.Context, req *deckv1.OpenDeckRequest) (*deckv1.OpenDeckResponse, error) {
+	err := validateDeckId(req.DeckId)
+	if err != nil {
+		return nil, err
+	}
+
+	deck, err := s.deckservice.OpenDeck(ctx, auth.TenantID(ctx), req.DeckId)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField(logging.DeckID, req.DeckId).WithError(err).Error("Error in open deck")
+		return nil, toStatus(err)
+	}
+	setETag(ctx, deck.Version)
+
+	return deckv1.FromRespOpenDeck(deck), nil
+}
+
+// Draw cards from a deck
+func (s *DeckServer) DrawCard(ctx context.Context, req *deckv1.DrawCardsRequest) (*deckv1.DrawCardsResponse, error) {
+	err := validateDrawCardsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := ifMatchVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deck, err := s.deckservice.DrawCard(ctx, auth.TenantID(ctx), req.DeckId, int(req.Count), version)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField(logging.DeckID, req.DeckId).WithError(err).Error("Error in draw a card")
+		return nil, toStatus(err)
+	}
+	setETag(ctx, deck.Version)
+
+	return deckv1.FromRespDrawDeck(deck), nil
+}
+
+// Create a deck for every request on the stream, until the client closes it
+func (s *DeckServer) CreateNewDeckStream(stream deckv1.DeckService_CreateNewDeckStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		deck, err := s.CreateNewDeck(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(deck)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Draw the cards at once, then send them one at a time
+func (s *DeckServer) DrawCardStream(req *deckv1.DrawCardsRequest, stream deckv1.DeckService_DrawCardStreamServer) error {
+	deck, err := s.DrawCard(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	for _, card := range deck.Cards {
+		err = stream.Send(card)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateDeckId(deckId string) error {
+	if deckId == "" {
+		return status.Error(codes.InvalidArgument, "Deck id parameter is required")
+	}
+	_, err := utils.Parse_uuid(deckId)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Invalid deck id")
+	}
+	return nil
+}
+
+func validateDrawCardsRequest(req *deckv1.DrawCardsRequest) error {
+	err := validateDeckId(req.DeckId)
+	if err != nil {
+		return err
+	}
+	if req.Count <= 0 {
+		return status.Error(codes.InvalidArgument, "Count parameter must be a positive integer")
+	}
+	return nil
+}
+
+// map service errors to gRPC status codes
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, services.ErrDeckNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, services.ErrNotEnoughCards):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, services.ErrInvalidMetadata), errors.Is(err, services.ErrTooManyCards):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, services.ErrDeckLimitReached):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, services.ErrVersionMismatch):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// Send the version of a deck in the etag header, like the HTTP API. Streams
+// only send the header of their first message.
+func setETag(ctx context.Context, version int) {
+	grpc.SetHeader(ctx, metadata.Pairs("etag", utils.Format_etag(version)))
+}
+
+// The version required by the if-match metadata, zero when there is none
+func ifMatchVersion(ctx context.Context) (int, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("if-match")
+	if len(values) == 0 || values[0] == "*" {
+		return 0, nil
+	}
+
+	version, err := utils.Parse_etag(values[0])
+	if err != nil {
+		return 0, status.Error(codes.InvalidArgument, "if-match must be the etag of a deck")
+	}
+	return version, nil
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"toggl/app/render"
+	"toggl/app/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+type AuthHandlerImpl struct {
+	authservice services.AuthService
+	logger      *logrus.Logger
+}
+
+// Setup a new AuthHandler with auth service and logger
+func NewAuthHandler(authService services.AuthService, logger *logrus.Logger) *AuthHandlerImpl {
+	return &AuthHandlerImpl{authservice: authService, logger: logger}
+}
+
+// Write a successful response in the negotiated media type
+func (h *AuthHandlerImpl) respond(w http.ResponseWriter, mediaType string, status int, v interface{}) {
+	err := render.Respond(w, mediaType, status, v)
+	if err != nil {
+		h.logger.WithError(err).Error("Error writing response")
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"toggl/app/dtos"
+	"toggl/app/render"
+)
+
+// tenant ids are short identifiers chosen by the admin
+var tenantIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// longest name of an API key
+const maxAPIKeyNameLength = 128
+
+// Issue an API key for a tenant
+func (h *AuthHandlerImpl) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	if !render.IsJSONRequest(r) {
+		h.logger.WithContext(r.Context()).WithField("content_type", r.Header.Get("Content-Type")).Error("Unsupported content type")
+		render.Error(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+
+	var req dtos.ReqCreateAPIKey
+	fields := decodeJSONBody(w, r, &req)
+	if fields == nil {
+		fields = validateCreateAPIKeyRequest(req)
+	}
+	if len(fields) > 0 {
+		writeValidationErrorResponse(w, fields, h.logger)
+		return
+	}
+
+	apiKey, err := h.authservice.CreateAPIKey(r.Context(), req)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error creating API key")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	h.respond(w, mediaType, http.StatusCreated, apiKey)
+}
+
+// validate the fields of a create API key request
+func validateCreateAPIKeyRequest(req dtos.ReqCreateAPIKey) []dtos.RespFieldError {
+	var fields []dtos.RespFieldError
+	if !tenantIdPattern.MatchString(req.TenantID) {
+		fields = append(fields, dtos.RespFieldError{Field: "tenant_id", Message: "must be 1 to 64 letters, digits, dashes or underscores"})
+	}
+	if len(req.Name) > maxAPIKeyNameLength {
+		fields = append(fields, dtos.RespFieldError{Field: "name", Message: fmt.Sprintf("must not exceed %d characters", maxAPIKeyNameLength)})
+	}
+	return fields
+}
@@ -1,47 +1,99 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"toggl/app/auth"
 	"toggl/app/dtos"
-
-	"github.com/sirupsen/logrus"
+	"toggl/app/render"
+	"toggl/app/services"
 )
 
 // Create a new deck
 func (d *DeckHandlerImpl) CreateNewDeckHandler(w http.ResponseWriter, r *http.Request) {
 
-	query := r.URL.Query()
-	shuffle := query.Get("shuffle") == "true"
-	cards := strings.TrimSpace(query.Get("cards"))
-	deck, err := d.deckservice.CreateNewDeck(shuffle, cards)
-	if err != nil {
-		d.logger.WithError(err).Error("Error creating new deck")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
 		return
 	}
 
-	// Write the response
-	writeCreateNewDeckHandlerResponse(w, deck, d.logger)
-}
-
-func writeCreateNewDeckHandlerResponse(w http.ResponseWriter, deck *dtos.RespCreateDeck, logger *logrus.Logger) {
-	// Set the content type of the response to JSON
-	w.Header().Set("Content-Type", "application/json")
+	// Read parameters from a JSON body, or the query string for older clients
+	var shuffle bool
+	var cards string
+	var metadata map[string]string
+	if render.IsJSONRequest(r) {
+		var req dtos.ReqCreateDeck
+		fields := decodeJSONBody(w, r, &req)
+		if fields == nil {
+			fields = validateCreateDeckRequest(req)
+		}
+		if len(fields) > 0 {
+			writeValidationErrorResponse(w, fields, d.logger)
+			return
+		}
+		shuffle = req.Shuffle
+		cards = strings.Join(req.Cards, ",")
+		metadata = req.Metadata
+	} else if hasUnsupportedBody(r) {
+		d.logger.WithContext(r.Context()).WithField("content_type", r.Header.Get("Content-Type")).Error("Unsupported content type")
+		render.Error(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	} else {
+		query := r.URL.Query()
+		shuffle = query.Get("shuffle") == "true"
+		cards = strings.TrimSpace(query.Get("cards"))
+		metadata = parseMetadataParams(query)
+	}
 
-	// Marshal the deck object into JSON
-	jsonData, err := json.Marshal(deck)
+	deck, err := d.deckservice.CreateNewDeck(r.Context(), auth.TenantID(r.Context()), shuffle, cards, metadata)
+	if errors.Is(err, services.ErrInvalidMetadata) && render.IsJSONRequest(r) {
+		writeValidationErrorResponse(w, []dtos.RespFieldError{{Field: "metadata", Message: err.Error()}}, d.logger)
+		return
+	}
+	if errors.Is(err, services.ErrInvalidMetadata) {
+		d.logger.WithContext(r.Context()).WithError(err).Error("Invalid deck metadata")
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrTooManyCards) && render.IsJSONRequest(r) {
+		writeValidationErrorResponse(w, []dtos.RespFieldError{{Field: "cards", Message: err.Error()}}, d.logger)
+		return
+	}
+	if errors.Is(err, services.ErrTooManyCards) {
+		d.logger.WithContext(r.Context()).WithError(err).Error("Too many cards for a deck")
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrDeckLimitReached) {
+		d.logger.WithContext(r.Context()).WithError(err).Error("Deck limit reached")
+		render.Error(w, r, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
-		logger.WithError(err).Error("Error marshaling JSON response")
-		http.Error(w, "Error creating JSON response", http.StatusInternalServerError)
+		d.logger.WithContext(r.Context()).WithError(err).Error("Error creating new deck")
+		render.ServerError(w, r, err)
 		return
 	}
 
-	// Write the JSON data to the HTTP writer
-	_, err = w.Write(jsonData)
-	if err != nil {
-		logger.WithError(err).Error("Error writing response")
-		http.Error(w, "Error writing response", http.StatusInternalServerError)
+	// Write the response
+	setDeckETag(w, deck.Version)
+	d.respond(w, mediaType, deck)
+}
+
+// validate the fields of a JSON create deck request
+func validateCreateDeckRequest(req dtos.ReqCreateDeck) []dtos.RespFieldError {
+	var fields []dtos.RespFieldError
+	if req.Cards != nil && len(req.Cards) == 0 {
+		fields = append(fields, dtos.RespFieldError{Field: "cards", Message: "must not be empty, leave it out for a full deck"})
+	}
+	for i, code := range req.Cards {
+		err := services.ValidateCardCode(code)
+		if err != nil {
+			fields = append(fields, dtos.RespFieldError{Field: fmt.Sprintf("cards[%d]", i), Message: fmt.Sprintf("%s is not a valid card code: %s", code, err)})
+		}
 	}
+	return fields
 }
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"toggl/app/auth"
+	"toggl/app/dtos"
+	"toggl/app/render"
+	"toggl/app/services"
+	"toggl/app/webhooks"
+)
+
+// Create a webhook
+func (h *WebhookHandlerImpl) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	if !render.IsJSONRequest(r) {
+		h.logger.WithContext(r.Context()).WithField("content_type", r.Header.Get("Content-Type")).Error("Unsupported content type")
+		render.Error(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+
+	var req dtos.ReqCreateWebhook
+	fields := decodeJSONBody(w, r, &req)
+	if fields == nil {
+		fields = validateCreateWebhookRequest(r.Context(), req)
+	}
+	if len(fields) > 0 {
+		writeValidationErrorResponse(w, fields, h.logger)
+		return
+	}
+
+	webhook, err := h.webhookservice.CreateWebhook(r.Context(), auth.TenantID(r.Context()), req)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error creating webhook")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	h.respond(w, mediaType, http.StatusCreated, webhook)
+}
+
+// validate the fields of a create webhook request, resolving the host of its
+// URL to check it is public
+func validateCreateWebhookRequest(ctx context.Context, req dtos.ReqCreateWebhook) []dtos.RespFieldError {
+	var fields []dtos.RespFieldError
+
+	target, err := url.Parse(req.URL)
+	if req.URL == "" {
+		fields = append(fields, dtos.RespFieldError{Field: "url", Message: "is required"})
+	} else if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		fields = append(fields, dtos.RespFieldError{Field: "url", Message: "must be an absolute http or https URL"})
+	} else if err := webhooks.CheckURL(ctx, req.URL); err != nil {
+		fields = append(fields, dtos.RespFieldError{Field: "url", Message: err.Error()})
+	}
+
+	if len(req.Events) == 0 {
+		fields = append(fields, dtos.RespFieldError{Field: "events", Message: "must name at least one event"})
+	}
+	for i, event := range req.Events {
+		if !contains(services.WebhookEvents, event) {
+			fields = append(fields, dtos.RespFieldError{Field: fmt.Sprintf("events[%d]", i), Message: fmt.Sprintf("%s is not a webhook event", event)})
+		}
+	}
+
+	if req.Secret != "" && (len(req.Secret) < services.MinWebhookSecretLength || len(req.Secret) > services.MaxWebhookSecretLength) {
+		fields = append(fields, dtos.RespFieldError{Field: "secret", Message: fmt.Sprintf("must be %d to %d characters", services.MinWebhookSecretLength, services.MaxWebhookSecretLength)})
+	}
+
+	return fields
+}
+
+func contains(arr []string, str string) bool {
+	for _, a := range arr {
+		if a == str {
+			return true
+		}
+	}
+	return false
+}
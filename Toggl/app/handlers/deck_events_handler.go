@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"toggl/app/auth"
+	"toggl/app/dtos"
+	"toggl/app/logging"
+	"toggl/app/models"
+	"toggl/app/render"
+	"toggl/app/services"
+	"toggl/app/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// comment sent on idle streams so proxies don't close them
+const keepAliveInterval = 15 * time.Second
+
+// Stream the events of a deck as Server-Sent Events. A client reconnecting
+// with Last-Event-ID first gets the events it missed from the deck history.
+func (d *DeckHandlerImpl) DeckEventsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Get the deck ID from the URL path
+	deckId := mux.Vars(r)["deck_id"]
+	_, err := utils.Parse_uuid(deckId)
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing deck id ")
+		render.Error(w, r, http.StatusBadRequest, "Invalid deck id")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		d.logger.WithContext(r.Context()).Error("Response writer does not support streaming")
+		render.Error(w, r, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	sub, err := d.deckservice.SubscribeDeckEvents(r.Context(), auth.TenantID(r.Context()), deckId)
+	if errors.Is(err, services.ErrDeckNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithField(logging.DeckID, deckId).WithError(err).Error("Error in subscribing to deck events")
+		render.ServerError(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	// The stream stays open past the write timeout of the server
+	err = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		d.logger.WithContext(r.Context()).WithError(err).Warn("Error in clearing the write deadline of a deck event stream")
+	}
+
+	// Start the stream
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": subscribed\n\n")
+
+	// Catch up from the history, subscribed first so nothing falls in between
+	lastSeq, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	if lastSeq > 0 {
+		history, err := d.deckservice.DeckHistory(r.Context(), auth.TenantID(r.Context()), deckId)
+		if err != nil {
+			d.logger.WithContext(r.Context()).WithField(logging.DeckID, deckId).WithError(err).Error("Error in loading deck history")
+			return
+		}
+		for _, event := range history.Events {
+			if event.Seq > lastSeq {
+				d.writeEvent(w, event)
+				lastSeq = event.Seq
+			}
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, ok := <-sub.Events():
+			if !ok {
+				// tell a client that fell behind to reload the deck
+				if sub.Overflowed() {
+					d.logger.WithContext(r.Context()).WithField(logging.DeckID, deckId).Warn("Deck event subscriber fell behind")
+					fmt.Fprint(w, "event: overflow\ndata: {}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			if event.Seq <= lastSeq {
+				continue
+			}
+			d.writeEvent(w, services.DeckEventResponse(event))
+			lastSeq = event.Seq
+			flusher.Flush()
+
+			// nothing follows the deletion of a deck
+			if event.Type == models.DeckDeleted {
+				return
+			}
+		}
+	}
+}
+
+// write one event of the stream, its id is the sequence number in the deck history
+func (d *DeckHandlerImpl) writeEvent(w http.ResponseWriter, event dtos.RespDeckEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		d.logger.WithError(err).Error("Error encoding deck event")
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+}
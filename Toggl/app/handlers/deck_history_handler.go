@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"toggl/app/auth"
+	"toggl/app/logging"
+	"toggl/app/render"
+	"toggl/app/services"
+	"toggl/app/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// List the recorded events of a deck
+func (d *DeckHandlerImpl) DeckHistoryHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	// Get the deck ID from the URL path
+	deckId := mux.Vars(r)["deck_id"]
+	_, err := utils.Parse_uuid(deckId)
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing deck id ")
+		render.Error(w, r, http.StatusBadRequest, "Invalid deck id")
+		return
+	}
+
+	history, err := d.deckservice.DeckHistory(r.Context(), auth.TenantID(r.Context()), deckId)
+	if errors.Is(err, services.ErrDeckNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithField(logging.DeckID, deckId).WithError(err).Error("Error in loading deck history ")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	d.respond(w, mediaType, history)
+}
+
+// Rebuild a deck as it was right after one of its events
+func (d *DeckHandlerImpl) DeckStateHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	// Get the deck ID and event number from the URL path
+	deckId := mux.Vars(r)["deck_id"]
+	_, err := utils.Parse_uuid(deckId)
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing deck id ")
+		render.Error(w, r, http.StatusBadRequest, "Invalid deck id")
+		return
+	}
+
+	seq, err := strconv.Atoi(mux.Vars(r)["seq"])
+	if err != nil || seq < 1 {
+		d.logger.WithContext(r.Context()).WithField(logging.DeckID, deckId).WithField("seq", mux.Vars(r)["seq"]).Error("Invalid event number")
+		render.Error(w, r, http.StatusBadRequest, "Event number must be a positive integer")
+		return
+	}
+
+	deck, err := d.deckservice.DeckStateAt(r.Context(), auth.TenantID(r.Context()), deckId, seq)
+	if errors.Is(err, services.ErrDeckNotFound) || errors.Is(err, services.ErrEventNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithField(logging.DeckID, deckId).WithError(err).Error("Error in replaying deck history ")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	d.respond(w, mediaType, deck)
+}
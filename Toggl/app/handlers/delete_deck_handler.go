@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"toggl/app/auth"
+	"toggl/app/logging"
+	"toggl/app/render"
+	"toggl/app/services"
+	"toggl/app/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Delete a deck
+func (d *DeckHandlerImpl) DeleteDeckHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Get the deck ID from the URL path
+	deckId := mux.Vars(r)["deck_id"]
+	_, err := utils.Parse_uuid(deckId)
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing deck id ")
+		render.Error(w, r, http.StatusBadRequest, "Invalid deck id")
+		return
+	}
+
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		render.Error(w, r, http.StatusPreconditionFailed, services.ErrVersionMismatch.Error())
+		return
+	}
+
+	err = d.deckservice.DeleteDeck(r.Context(), auth.TenantID(r.Context()), deckId, version)
+	if errors.Is(err, services.ErrDeckNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrVersionMismatch) {
+		render.Error(w, r, http.StatusPreconditionFailed, err.Error())
+		return
+	}
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithField(logging.DeckID, deckId).WithError(err).Error("Error in delete deck ")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"toggl/app/auth"
+	"toggl/app/render"
+	"toggl/app/services"
+	"toggl/app/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Delete a webhook
+func (h *WebhookHandlerImpl) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Get the webhook ID from the URL path
+	webhookId := mux.Vars(r)["webhook_id"]
+	_, err := utils.Parse_uuid(webhookId)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing webhook id ")
+		render.Error(w, r, http.StatusBadRequest, "Invalid webhook id")
+		return
+	}
+
+	err = h.webhookservice.DeleteWebhook(r.Context(), auth.TenantID(r.Context()), webhookId)
+	if errors.Is(err, services.ErrWebhookNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error in delete webhook ")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
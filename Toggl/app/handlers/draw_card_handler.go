@@ -1,71 +1,112 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"toggl/app/auth"
 	"toggl/app/dtos"
+	"toggl/app/logging"
+	"toggl/app/render"
+	"toggl/app/services"
 	"toggl/app/utils"
-
-	"github.com/sirupsen/logrus"
 )
 
 // Draw a card from deck
 func (d *DeckHandlerImpl) DrawCardHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse request parameters
-	deckId := r.URL.Query().Get("deck_id")
-	countStr := r.URL.Query().Get("count")
 
-	// Validate deckId parameter
-	if deckId == "" {
-		d.logger.Error("Empty deck id")
-		http.Error(w, "Deck id parameter is required", http.StatusBadRequest)
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
 		return
 	}
-	_, err := utils.Parse_uuid((deckId))
-	if err != nil {
-		d.logger.WithError(err).Error("Error in parsing ")
-		http.Error(w, fmt.Sprintf("Invalid deck id"), http.StatusBadRequest)
+	var deckId string
+	var count int
+	if render.IsJSONRequest(r) {
+		var req dtos.ReqDrawCards
+		fields := decodeJSONBody(w, r, &req)
+		if fields == nil {
+			fields = validateDrawCardsRequest(req)
+		}
+		if len(fields) > 0 {
+			writeValidationErrorResponse(w, fields, d.logger)
+			return
+		}
+		deckId = req.DeckID
+		count = req.Count
+	} else if hasUnsupportedBody(r) {
+		d.logger.WithContext(r.Context()).WithField("content_type", r.Header.Get("Content-Type")).Error("Unsupported content type")
+		render.Error(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
 		return
+	} else {
+		// Parse request parameters
+		deckId = r.URL.Query().Get("deck_id")
+		countStr := r.URL.Query().Get("count")
+
+		// Validate deckId parameter
+		if deckId == "" {
+			d.logger.WithContext(r.Context()).Error("Empty deck id")
+			render.Error(w, r, http.StatusBadRequest, "Deck id parameter is required")
+			return
+		}
+		_, err := utils.Parse_uuid((deckId))
+		if err != nil {
+			d.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing ")
+			render.Error(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid deck id"))
+			return
+		}
+
+		// Validate count parameter
+		count, err = strconv.Atoi(countStr)
+		if err != nil || count <= 0 {
+			d.logger.WithContext(r.Context()).WithError(err).Error("Error in checking is count positive number")
+			render.Error(w, r, http.StatusBadRequest, "Count parameter must be a positive integer")
+			return
+		}
 	}
 
-	// Validate count parameter
-	count, err := strconv.Atoi(countStr)
-	if err != nil || count <= 0 {
-		d.logger.WithError(err).Error("Error in checking is count positive number")
-		http.Error(w, "Count parameter must be a positive integer", http.StatusBadRequest)
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		render.Error(w, r, http.StatusPreconditionFailed, services.ErrVersionMismatch.Error())
 		return
 	}
 
 	// Call service method to draw cards
-	deck, err := d.deckservice.DrawCard(deckId, count)
+	deck, err := d.deckservice.DrawCard(r.Context(), auth.TenantID(r.Context()), deckId, count, version)
+	if errors.Is(err, services.ErrVersionMismatch) {
+		render.Error(w, r, http.StatusPreconditionFailed, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrDeckNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrNotEnoughCards) {
+		render.Error(w, r, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
-		d.logger.WithError(err).Error("Error in draw a card")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		d.logger.WithContext(r.Context()).WithField(logging.DeckID, deckId).WithError(err).Error("Error in draw a card")
+		render.ServerError(w, r, err)
 		return
 	}
 
 	// Write the response
-	writeDrawCardHandlerResponse(w, deck, d.logger)
+	setDeckETag(w, deck.Version)
+	d.respond(w, mediaType, deck)
 }
 
-func writeDrawCardHandlerResponse(w http.ResponseWriter, deck *dtos.RespDrawDeck, logger *logrus.Logger) {
-	// Set the content type of the response to JSON
-	w.Header().Set("Content-Type", "application/json")
-
-	// Marshal the deck object into JSON
-	jsonData, err := json.Marshal(deck)
-	if err != nil {
-		logger.WithError(err).Error("Error marshaling JSON response")
-		http.Error(w, "Error creating JSON response", http.StatusInternalServerError)
-		return
+// validate the fields of a JSON draw cards request
+func validateDrawCardsRequest(req dtos.ReqDrawCards) []dtos.RespFieldError {
+	var fields []dtos.RespFieldError
+	if req.DeckID == "" {
+		fields = append(fields, dtos.RespFieldError{Field: "deck_id", Message: "is required"})
+	} else if _, err := utils.Parse_uuid(req.DeckID); err != nil {
+		fields = append(fields, dtos.RespFieldError{Field: "deck_id", Message: "must be a valid UUID"})
 	}
-
-	// Write the JSON data to the HTTP writer
-	_, err = w.Write(jsonData)
-	if err != nil {
-		logger.WithError(err).Error("Error writing response")
-		http.Error(w, "Error writing response", http.StatusInternalServerError)
+	if req.Count <= 0 {
+		fields = append(fields, dtos.RespFieldError{Field: "count", Message: "must be a positive integer"})
 	}
+	return fields
 }
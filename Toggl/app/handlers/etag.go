@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"toggl/app/utils"
+)
+
+func setDeckETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", utils.Format_etag(version))
+}
+
+// The version an If-Match header requires, zero when there is none or it is
+// "*". Only a single strong ETag of a deck can match, anything else is false.
+func ifMatchVersion(r *http.Request) (int, bool) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, true
+	}
+
+	version, err := utils.Parse_etag(ifMatch)
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
+
+// Whether the If-None-Match header lists the ETag of the version
+func ifNoneMatch(r *http.Request, version int) bool {
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	etag := utils.Format_etag(version)
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		// weak comparison, W/ is ignored
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"net/http"
+	"toggl/app/render"
 	"toggl/app/services"
 
 	"github.com/sirupsen/logrus"
@@ -15,3 +17,11 @@ type DeckHandlerImpl struct {
 func NewDeckHandler(deckService services.DeckService, logger *logrus.Logger) *DeckHandlerImpl {
 	return &DeckHandlerImpl{deckservice: deckService, logger: logger}
 }
+
+// Write a successful response in the negotiated media type
+func (d *DeckHandlerImpl) respond(w http.ResponseWriter, mediaType string, v interface{}) {
+	err := render.Respond(w, mediaType, http.StatusOK, v)
+	if err != nil {
+		d.logger.WithError(err).Error("Error writing response")
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"toggl/app/render"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Checks the service can serve requests, the repository implements it
+type ReadinessChecker interface {
+	CheckSchema(ctx context.Context) error
+}
+
+type HealthHandlerImpl struct {
+	checker  ReadinessChecker
+	logger   *logrus.Logger
+	draining atomic.Bool
+}
+
+// Setup a new HealthHandler with the readiness checker and logger
+func NewHealthHandler(checker ReadinessChecker, logger *logrus.Logger) *HealthHandlerImpl {
+	return &HealthHandlerImpl{checker: checker, logger: logger}
+}
+
+// Report not ready from now on, so load balancers stop sending requests
+// while the server shuts down
+func (h *HealthHandlerImpl) Drain() {
+	h.draining.Store(true)
+}
+
+// Probes are answered in JSON whatever they accept
+func (h *HealthHandlerImpl) respond(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	err := render.Respond(w, render.MediaTypeJSON, status, v)
+	if err != nil {
+		h.logger.WithError(err).Error("Error writing response")
+	}
+}
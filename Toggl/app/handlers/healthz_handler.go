@@ -0,0 +1,11 @@
+package handlers
+
+import (
+	"net/http"
+	"toggl/app/dtos"
+)
+
+// HealthzHandler answers as long as the process is alive
+func (h *HealthHandlerImpl) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, http.StatusOK, dtos.RespHealth{Status: "ok"})
+}
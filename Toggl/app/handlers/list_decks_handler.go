@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"toggl/app/auth"
+	"toggl/app/models"
+	"toggl/app/render"
+	"toggl/app/services"
+)
+
+// List decks with filters and cursor pagination
+func (d *DeckHandlerImpl) ListDecksHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := parseDeckFilter(r.URL.Query())
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing deck filter")
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	decks, err := d.deckservice.ListDecks(r.Context(), auth.TenantID(r.Context()), *filter)
+	if errors.Is(err, services.ErrInvalidCursor) {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithError(err).Error("Error in listing decks")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	d.respond(w, mediaType, decks)
+}
+
+// parse the query parameters of the list decks endpoint
+func parseDeckFilter(query url.Values) (*models.DeckFilter, error) {
+	filter := &models.DeckFilter{Cursor: query.Get("cursor"), Metadata: parseMetadataParams(query)}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > services.MaxListLimit {
+			return nil, errors.New("Limit parameter must be a positive integer up to " + strconv.Itoa(services.MaxListLimit))
+		}
+		filter.Limit = limit
+	}
+
+	if shuffledStr := query.Get("shuffled"); shuffledStr != "" {
+		shuffled, err := strconv.ParseBool(shuffledStr)
+		if err != nil {
+			return nil, errors.New("Shuffled parameter must be true or false")
+		}
+		filter.Shuffled = &shuffled
+	}
+
+	var err error
+	filter.CreatedAfter, err = parseTimeParam(query, "created_after")
+	if err != nil {
+		return nil, err
+	}
+	filter.CreatedBefore, err = parseTimeParam(query, "created_before")
+	if err != nil {
+		return nil, err
+	}
+	filter.MinRemaining, err = parseCountParam(query, "min_remaining")
+	if err != nil {
+		return nil, err
+	}
+	filter.MaxRemaining, err = parseCountParam(query, "max_remaining")
+	if err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.New(name + " parameter must be an RFC 3339 timestamp")
+	}
+	return &t, nil
+}
+
+func parseCountParam(query url.Values, name string) (*int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return nil, errors.New(name + " parameter must be a non-negative integer")
+	}
+	return &count, nil
+}
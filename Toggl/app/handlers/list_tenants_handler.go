@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+	"toggl/app/render"
+)
+
+// List tenants with their usage
+func (h *TenantHandlerImpl) ListTenantsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	tenants, err := h.tenantservice.ListTenants(r.Context())
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error in listing tenants")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	h.respond(w, mediaType, http.StatusOK, tenants)
+}
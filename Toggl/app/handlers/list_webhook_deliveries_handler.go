@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"toggl/app/auth"
+	"toggl/app/render"
+	"toggl/app/services"
+	"toggl/app/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// List the deliveries of a webhook
+func (h *WebhookHandlerImpl) ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	// Get the webhook ID from the URL path
+	webhookId := mux.Vars(r)["webhook_id"]
+	_, err := utils.Parse_uuid(webhookId)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing webhook id ")
+		render.Error(w, r, http.StatusBadRequest, "Invalid webhook id")
+		return
+	}
+
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > services.MaxDeliveriesLimit {
+			h.logger.WithContext(r.Context()).WithField("limit", limitStr).Error("Invalid limit")
+			render.Error(w, r, http.StatusBadRequest, "Limit parameter must be a positive integer up to "+strconv.Itoa(services.MaxDeliveriesLimit))
+			return
+		}
+	}
+
+	deliveries, err := h.webhookservice.ListDeliveries(r.Context(), auth.TenantID(r.Context()), webhookId, limit)
+	if errors.Is(err, services.ErrWebhookNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error in listing webhook deliveries")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	h.respond(w, mediaType, http.StatusOK, deliveries)
+}
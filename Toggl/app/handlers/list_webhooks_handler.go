@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"toggl/app/auth"
+	"toggl/app/render"
+)
+
+// List webhooks
+func (h *WebhookHandlerImpl) ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	webhooks, err := h.webhookservice.ListWebhooks(r.Context(), auth.TenantID(r.Context()))
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error in listing webhooks")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	h.respond(w, mediaType, http.StatusOK, webhooks)
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+)
+
+// collect metadata[key]=value query parameters, nil when there are none
+func parseMetadataParams(query url.Values) map[string]string {
+	var metadata map[string]string
+	for param, values := range query {
+		if !strings.HasPrefix(param, "metadata[") || !strings.HasSuffix(param, "]") {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		key := strings.TrimSuffix(strings.TrimPrefix(param, "metadata["), "]")
+		metadata[key] = values[0]
+	}
+	return metadata
+}
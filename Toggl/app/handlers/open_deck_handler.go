@@ -1,62 +1,59 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"toggl/app/dtos"
+	"toggl/app/auth"
+	"toggl/app/logging"
+	"toggl/app/render"
+	"toggl/app/services"
 	"toggl/app/utils"
-
-	"github.com/sirupsen/logrus"
 )
 
 // Open a deck handler
 func (d *DeckHandlerImpl) OpenDeckHandler(w http.ResponseWriter, r *http.Request) {
 
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
 	// Get the deck ID from the URL parameter
 
 	deckId := r.URL.Query().Get("deck_id")
-	fmt.Println(deckId)
 	if deckId == "" {
-		d.logger.Error("Empty deck id")
-		http.Error(w, fmt.Sprintf("Deck id parameter is required"), http.StatusBadRequest)
+		d.logger.WithContext(r.Context()).Error("Empty deck id")
+		render.Error(w, r, http.StatusBadRequest, fmt.Sprintf("Deck id parameter is required"))
 		return
 	}
 
 	_, err := utils.Parse_uuid(deckId)
 	if err != nil {
-		d.logger.WithError(err).Error("Error in parsing deck id ")
-		http.Error(w, fmt.Sprintf("Invalid deck id"), http.StatusBadRequest)
+		d.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing deck id ")
+		render.Error(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid deck id"))
 		return
 	}
 	// Fetch the deck by its ID
-	deck, err := d.deckservice.OpenDeck(deckId)
-	if err != nil {
-		d.logger.WithError(err).Error("Error in open deck ")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	deck, err := d.deckservice.OpenDeck(r.Context(), auth.TenantID(r.Context()), deckId)
+	if errors.Is(err, services.ErrDeckNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
 		return
 	}
-
-	// Write the response
-	writeOpenDeckHandlerResponse(w, deck, d.logger)
-}
-
-func writeOpenDeckHandlerResponse(w http.ResponseWriter, deck *dtos.RespOpenDeck, logger *logrus.Logger) {
-	// Set the content type of the response to JSON
-	w.Header().Set("Content-Type", "application/json")
-
-	// Marshal the deck object into JSON
-	jsonData, err := json.Marshal(deck)
 	if err != nil {
-		logger.WithError(err).Error("Error marshaling JSON response")
-		http.Error(w, "Error creating JSON response", http.StatusInternalServerError)
+		d.logger.WithContext(r.Context()).WithField(logging.DeckID, deckId).WithError(err).Error("Error in open deck ")
+		render.ServerError(w, r, err)
 		return
 	}
 
-	// Write the JSON data to the HTTP writer
-	_, err = w.Write(jsonData)
-	if err != nil {
-		logger.WithError(err).Error("Error writing response")
-		http.Error(w, "Error writing response", http.StatusInternalServerError)
+	// The client already has this version of the deck
+	setDeckETag(w, deck.Version)
+	if ifNoneMatch(r, deck.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
+
+	// Write the response
+	d.respond(w, mediaType, deck)
 }
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+	"toggl/app/dtos"
+)
+
+// ReadyzHandler answers 200 when the repository is reachable with every
+// migration applied, and 503 otherwise or once the server shuts down
+func (h *HealthHandlerImpl) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		h.respond(w, http.StatusServiceUnavailable, dtos.RespHealth{Status: "unavailable", Error: "Shutting down"})
+		return
+	}
+
+	err := h.checker.CheckSchema(r.Context())
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Warn("Not ready")
+		h.respond(w, http.StatusServiceUnavailable, dtos.RespHealth{Status: "unavailable", Error: "Repository unavailable"})
+		return
+	}
+
+	h.respond(w, http.StatusOK, dtos.RespHealth{Status: "ok"})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"toggl/app/dtos"
+	"toggl/app/render"
+
+	"github.com/sirupsen/logrus"
+)
+
+// upper bound of a JSON request body
+const maxBodyBytes = 1 << 20
+
+// a body in any format other than JSON can't be read
+func hasUnsupportedBody(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return false
+	}
+	return r.Header.Get("Content-Type") != "" && !render.IsJSONRequest(r)
+}
+
+// decode a JSON body, returning field level errors when it doesn't fit the request
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) []dtos.RespFieldError {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil && decoder.More() {
+		err = errors.New("body must contain a single JSON object")
+	}
+	if err == nil {
+		return nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, io.EOF):
+		return []dtos.RespFieldError{{Field: "body", Message: "must not be empty"}}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return []dtos.RespFieldError{{Field: "body", Message: "malformed JSON, unexpected end of body"}}
+	case errors.As(err, &syntaxErr):
+		return []dtos.RespFieldError{{Field: "body", Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)}}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return []dtos.RespFieldError{{Field: typeErr.Field, Message: "must be " + describeType(typeErr.Type)}}
+	case errors.As(err, &typeErr):
+		return []dtos.RespFieldError{{Field: "body", Message: "must be a JSON object"}}
+	case errors.As(err, &maxBytesErr):
+		return []dtos.RespFieldError{{Field: "body", Message: fmt.Sprintf("must not exceed %d bytes", maxBodyBytes)}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return []dtos.RespFieldError{{Field: field, Message: "is not a known field"}}
+	default:
+		return []dtos.RespFieldError{{Field: "body", Message: err.Error()}}
+	}
+}
+
+// describe the expected JSON type of a field
+func describeType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice:
+		// drop the article of the element type
+		return "an array of " + strings.SplitN(describeType(t.Elem()), " ", 2)[1] + "s"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a " + t.String()
+	}
+}
+
+func writeValidationErrorResponse(w http.ResponseWriter, fields []dtos.RespFieldError, logger *logrus.Logger) {
+	logger.WithField("fields", fields).Error("Invalid request body")
+	render.ValidationError(w, fields)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"toggl/app/render"
+	"toggl/app/services"
+	"toggl/app/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Revoke an API key
+func (h *AuthHandlerImpl) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Get the key ID from the URL path
+	keyId := mux.Vars(r)["key_id"]
+	_, err := utils.Parse_uuid(keyId)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing API key id ")
+		render.Error(w, r, http.StatusBadRequest, "Invalid API key id")
+		return
+	}
+
+	err = h.authservice.RevokeAPIKey(r.Context(), keyId)
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error in revoke API key ")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
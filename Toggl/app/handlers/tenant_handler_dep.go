@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"toggl/app/render"
+	"toggl/app/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+type TenantHandlerImpl struct {
+	tenantservice services.TenantService
+	logger        *logrus.Logger
+}
+
+// Setup a new TenantHandler with tenant service and logger
+func NewTenantHandler(tenantService services.TenantService, logger *logrus.Logger) *TenantHandlerImpl {
+	return &TenantHandlerImpl{tenantservice: tenantService, logger: logger}
+}
+
+// Write a successful response in the negotiated media type
+func (h *TenantHandlerImpl) respond(w http.ResponseWriter, mediaType string, status int, v interface{}) {
+	err := render.Respond(w, mediaType, status, v)
+	if err != nil {
+		h.logger.WithError(err).Error("Error writing response")
+	}
+}
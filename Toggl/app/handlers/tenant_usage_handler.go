@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"toggl/app/logging"
+	"toggl/app/render"
+	"toggl/app/services"
+
+	"github.com/gorilla/mux"
+)
+
+// Usage of a tenant
+func (h *TenantHandlerImpl) TenantUsageHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	// Get the tenant ID from the URL path
+	tenantId := mux.Vars(r)["tenant_id"]
+	if !tenantIdPattern.MatchString(tenantId) {
+		h.logger.WithContext(r.Context()).WithField(logging.TenantID, tenantId).Error("Invalid tenant id")
+		render.Error(w, r, http.StatusBadRequest, "Invalid tenant id")
+		return
+	}
+
+	usage, err := h.tenantservice.TenantUsage(r.Context(), tenantId)
+	if errors.Is(err, services.ErrTenantNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error in loading tenant usage")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	h.respond(w, mediaType, http.StatusOK, usage)
+}
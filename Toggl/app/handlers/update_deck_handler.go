@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"toggl/app/auth"
+	"toggl/app/dtos"
+	"toggl/app/logging"
+	"toggl/app/render"
+	"toggl/app/services"
+	"toggl/app/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Update the metadata of a deck
+func (d *DeckHandlerImpl) UpdateDeckHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	// Get the deck ID from the URL path
+	deckId := mux.Vars(r)["deck_id"]
+	_, err := utils.Parse_uuid(deckId)
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithError(err).Error("Error in parsing deck id ")
+		render.Error(w, r, http.StatusBadRequest, "Invalid deck id")
+		return
+	}
+
+	if !render.IsJSONRequest(r) {
+		d.logger.WithContext(r.Context()).WithField("content_type", r.Header.Get("Content-Type")).Error("Unsupported content type")
+		render.Error(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+
+	var update dtos.ReqUpdateDeck
+	fields := decodeJSONBody(w, r, &update)
+	if len(fields) > 0 {
+		writeValidationErrorResponse(w, fields, d.logger)
+		return
+	}
+
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		render.Error(w, r, http.StatusPreconditionFailed, services.ErrVersionMismatch.Error())
+		return
+	}
+
+	deck, err := d.deckservice.UpdateDeck(r.Context(), auth.TenantID(r.Context()), deckId, update, version)
+	if errors.Is(err, services.ErrDeckNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrVersionMismatch) {
+		render.Error(w, r, http.StatusPreconditionFailed, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrInvalidMetadata) {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		d.logger.WithContext(r.Context()).WithField(logging.DeckID, deckId).WithError(err).Error("Error in update deck ")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	setDeckETag(w, deck.Version)
+	d.respond(w, mediaType, deck)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"toggl/app/dtos"
+	"toggl/app/logging"
+	"toggl/app/render"
+
+	"github.com/gorilla/mux"
+)
+
+// Set the limits of a tenant
+func (h *TenantHandlerImpl) UpdateTenantHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the response format before doing any work
+	mediaType, ok := render.Negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	// Get the tenant ID from the URL path
+	tenantId := mux.Vars(r)["tenant_id"]
+	if !tenantIdPattern.MatchString(tenantId) {
+		h.logger.WithContext(r.Context()).WithField(logging.TenantID, tenantId).Error("Invalid tenant id")
+		render.Error(w, r, http.StatusBadRequest, "Invalid tenant id")
+		return
+	}
+
+	if !render.IsJSONRequest(r) {
+		h.logger.WithContext(r.Context()).WithField("content_type", r.Header.Get("Content-Type")).Error("Unsupported content type")
+		render.Error(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+
+	var req dtos.ReqUpdateTenant
+	fields := decodeJSONBody(w, r, &req)
+	if fields == nil {
+		fields = validateUpdateTenantRequest(req)
+	}
+	if len(fields) > 0 {
+		writeValidationErrorResponse(w, fields, h.logger)
+		return
+	}
+
+	usage, err := h.tenantservice.UpdateTenant(r.Context(), tenantId, req)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithError(err).Error("Error in updating tenant")
+		render.ServerError(w, r, err)
+		return
+	}
+
+	// Write the response
+	h.respond(w, mediaType, http.StatusOK, usage)
+}
+
+// validate the fields of an update tenant request, zero lifts a limit
+func validateUpdateTenantRequest(req dtos.ReqUpdateTenant) []dtos.RespFieldError {
+	var fields []dtos.RespFieldError
+	if req.MaxDecks != nil && *req.MaxDecks < 0 {
+		fields = append(fields, dtos.RespFieldError{Field: "max_decks", Message: "must not be negative"})
+	}
+	if req.MaxCardsPerDeck != nil && *req.MaxCardsPerDeck < 0 {
+		fields = append(fields, dtos.RespFieldError{Field: "max_cards_per_deck", Message: "must not be negative"})
+	}
+	return fields
+}
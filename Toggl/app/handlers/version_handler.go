@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+	"toggl/app/dtos"
+	"toggl/app/version"
+)
+
+// VersionHandler reports the build metadata of the running binary
+func (h *HealthHandlerImpl) VersionHandler(w http.ResponseWriter, r *http.Request) {
+	info := version.Get()
+	h.respond(w, http.StatusOK, dtos.RespVersion{
+		Version:   info.Version,
+		Commit:    info.Commit,
+		BuildTime: info.BuildTime,
+		GoVersion: info.GoVersion,
+	})
+}
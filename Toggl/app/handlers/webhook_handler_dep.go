@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"toggl/app/render"
+	"toggl/app/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+type WebhookHandlerImpl struct {
+	webhookservice services.WebhookService
+	logger         *logrus.Logger
+}
+
+// Setup a new WebhookHandler with webhook service and logger
+func NewWebhookHandler(webhookService services.WebhookService, logger *logrus.Logger) *WebhookHandlerImpl {
+	return &WebhookHandlerImpl{webhookservice: webhookService, logger: logger}
+}
+
+// Write a successful response in the negotiated media type
+func (h *WebhookHandlerImpl) respond(w http.ResponseWriter, mediaType string, status int, v interface{}) {
+	err := render.Respond(w, mediaType, status, v)
+	if err != nil {
+		h.logger.WithError(err).Error("Error writing response")
+	}
+}
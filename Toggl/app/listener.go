@@ -0,0 +1,90 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+)
+
+// An address an HTTP server accepts connections on. Servers may have several,
+// they are all closed when the server shuts down.
+type listener struct {
+	// logged, api or admin
+	name    string
+	server  *http.Server
+	network string
+	address string
+	tls     bool
+
+	// permissions of a Unix socket file
+	mode os.FileMode
+
+	net.Listener
+}
+
+// Bind the address, replacing a socket file left behind by a previous run
+func (l *listener) listen() error {
+	if l.network == "unix" {
+		err := removeStaleSocket(l.address)
+		if err != nil {
+			return fmt.Errorf("%s listener: %w", l.name, err)
+		}
+	}
+
+	ln, err := net.Listen(l.network, l.address)
+	if err != nil {
+		return fmt.Errorf("%s listener: %w", l.name, err)
+	}
+
+	if l.network == "unix" {
+		err = os.Chmod(l.address, l.mode)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("%s listener: %w", l.name, err)
+		}
+	}
+
+	l.Listener = ln
+	return nil
+}
+
+// Serve connections until the server shuts down
+func (l *listener) serve() error {
+	var err error
+	if l.tls {
+		// the certificate comes from the TLS config, HTTP/2 is offered too
+		err = l.server.ServeTLS(l.Listener, "", "")
+	} else {
+		err = l.server.Serve(l.Listener)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return fmt.Errorf("%s server: %w", l.name, err)
+}
+
+// a socket outlives a process that crashed without closing it, other files
+// in its place and sockets in use are left alone
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	// a socket someone still listens on isn't stale
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	return os.Remove(path)
+}
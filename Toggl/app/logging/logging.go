@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// formats logs are written in
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// fields correlating the entries logged for a request
+const (
+	RequestID = "request_id"
+	TenantID  = "tenant_id"
+	DeckID    = "deck_id"
+	TraceID   = "trace_id"
+	SpanID    = "span_id"
+)
+
+type fieldsKey struct{}
+
+// Set up logger to write to stderr in format, json or text, from level on.
+// Entries logged with a context carry the fields added to it with With, and
+// the ids of its trace.
+func Configure(logger *logrus.Logger, format string, level string) error {
+	switch format {
+	case FormatJSON, "":
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	case FormatText:
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	err := SetLevel(logger, level)
+	if err != nil {
+		return err
+	}
+
+	logger.SetOutput(os.Stderr)
+	logger.AddHook(contextHook{})
+	return nil
+}
+
+// Set the level of logger by name, leaving it as is for an empty name
+func SetLevel(logger *logrus.Logger, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	level, err := logrus.ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(level)
+	return nil
+}
+
+// Add a field to the entries logged with ctx, along with those it has already
+func With(ctx context.Context, key string, value interface{}) context.Context {
+	previous := Fields(ctx)
+	fields := make(logrus.Fields, len(previous)+1)
+	for k, v := range previous {
+		fields[k] = v
+	}
+	fields[key] = value
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// The fields added to ctx, which must not be modified
+func Fields(ctx context.Context) logrus.Fields {
+	fields, _ := ctx.Value(fieldsKey{}).(logrus.Fields)
+	return fields
+}
+
+// adds the fields of the context of an entry, leaving those set on the entry
+type contextHook struct{}
+
+func (contextHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (contextHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	for key, value := range Fields(entry.Context) {
+		if _, ok := entry.Data[key]; !ok {
+			entry.Data[key] = value
+		}
+	}
+
+	span := trace.SpanContextFromContext(entry.Context)
+	if span.IsValid() {
+		entry.Data[TraceID] = span.TraceID().String()
+		entry.Data[SpanID] = span.SpanID().String()
+	}
+	return nil
+}
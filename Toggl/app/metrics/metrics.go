@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "toggl"
+
+// reasons a draw fails for
+const (
+	DrawNotFound       = "not_found"
+	DrawNotEnoughCards = "not_enough_cards"
+	DrawVersionChanged = "version_mismatch"
+	DrawError          = "error"
+)
+
+// Registry holds every metric of the service, along with the Go runtime and
+// process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	decksCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "decks_created_total",
+		Help:      "Decks created, by whether they were shuffled.",
+	}, []string{"shuffled"})
+
+	cardsDrawn = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cards_drawn_total",
+		Help:      "Cards drawn from decks.",
+	})
+
+	drawFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "draw_failures_total",
+		Help:      "Draws that failed, by reason.",
+	}, []string{"reason"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_query_duration_seconds",
+		Help:      "Time taken by repository queries, by query.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"query"})
+
+	liveDecks = &deckCounter{desc: prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "decks"),
+		"Decks that exist, counted when scraped.",
+		nil, nil,
+	)}
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, decksCreated, cardsDrawn, drawFailures, queryDuration, liveDecks,
+	)
+
+	// report zeros before the first deck is created or draw fails
+	decksCreated.WithLabelValues("true")
+	decksCreated.WithLabelValues("false")
+	for _, reason := range []string{DrawNotFound, DrawNotEnoughCards, DrawVersionChanged, DrawError} {
+		drawFailures.WithLabelValues(reason)
+	}
+}
+
+// Serve the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Record a served HTTP request, route is the template of the matched route
+func ObserveRequest(method string, route string, status int, duration time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// Record a created deck
+func DeckCreated(shuffled bool) {
+	decksCreated.WithLabelValues(strconv.FormatBool(shuffled)).Inc()
+}
+
+// Record cards drawn from a deck
+func CardsDrawn(count int) {
+	cardsDrawn.Add(float64(count))
+}
+
+// Record a draw that failed for one of the Draw reasons
+func DrawFailed(reason string) {
+	drawFailures.WithLabelValues(reason).Inc()
+}
+
+// Record how long a repository query took since start, meant to be deferred
+func ObserveQuery(query string, start time.Time) {
+	queryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+// Count the live decks with count whenever metrics are scraped
+func CountDecksWith(count func(ctx context.Context) (int, error)) {
+	liveDecks.mu.Lock()
+	defer liveDecks.mu.Unlock()
+	liveDecks.count = count
+}
+
+// deckCounter reports the number of decks, leaving it out when it can't be
+// counted
+type deckCounter struct {
+	desc  *prometheus.Desc
+	mu    sync.Mutex
+	count func(ctx context.Context) (int, error)
+}
+
+func (c *deckCounter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *deckCounter) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	count := c.count
+	c.mu.Unlock()
+	if count == nil {
+		return
+	}
+
+	decks, err := count(context.Background())
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(decks))
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Log every request once it's served
+func AccessLog(logger *logrus.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := wrapResponseWriter(w)
+
+			next.ServeHTTP(rw, r)
+
+			logger.WithFields(logrus.Fields{
+				"request_id":  RequestIDFromContext(r.Context()),
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"status":      rw.status,
+				"bytes":       rw.bytes,
+				"duration_ms": time.Since(start).Milliseconds(),
+				"remote_addr": r.RemoteAddr,
+				"user_agent":  r.UserAgent(),
+			}).Info("Request served")
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"toggl/app/auth"
+	"toggl/app/dtos"
+	"toggl/app/render"
+
+	"github.com/gorilla/mux"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// Authenticate requests by their API key, sent as a bearer token or in
+// X-API-Key. Without a key the request is anonymous, unless keys are required.
+func APIKey(authenticator auth.Authenticator, required bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := requestKey(r)
+			if key == "" && !required {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if key == "" {
+				unauthorized(w, "API key is required")
+				return
+			}
+
+			principal, err := authenticator.Authenticate(r.Context(), key)
+			if errors.Is(err, auth.ErrInvalidKey) {
+				unauthorized(w, err.Error())
+				return
+			}
+			if err != nil {
+				render.JSONError(w, http.StatusInternalServerError, dtos.RespError{Error: "Internal server error"})
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+		})
+	}
+}
+
+// Only let requests with the admin key through. An empty admin key disables
+// the routes behind it.
+func AdminKey(adminKey string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if adminKey == "" {
+				render.JSONError(w, http.StatusNotFound, dtos.RespError{Error: "Not found"})
+				return
+			}
+
+			key := requestKey(r)
+			if subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+				unauthorized(w, "Admin key is required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// the key of a request, from the Authorization or X-API-Key header
+func requestKey(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		scheme, token, ok := strings.Cut(authorization, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.Header.Get(APIKeyHeader)
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="toggl"`)
+	render.JSONError(w, http.StatusUnauthorized, dtos.RespError{Error: message})
+}
@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"toggl/app/auth"
+	"toggl/app/dtos"
+	"toggl/app/models"
+	"toggl/app/render"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// set on responses replayed for a retried request
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// longest idempotency key accepted
+const maxIdempotencyKeyLength = 255
+
+// request bodies up to this size are part of the fingerprint of a request
+const maxFingerprintBodyBytes = 1 << 20
+
+// Keeps requests sent with an idempotency key and their responses
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error
+	ReleaseIdempotencyKey(ctx context.Context, scope string, key string) error
+}
+
+// Make mutating requests sent with an Idempotency-Key safe to retry. The first
+// request with a key is handled and its response kept for the window, retries
+// with the same key get that response again, headers and all, instead of being
+// handled. Keys belong to the tenant using them, within the given scope. A key
+// reused for a different request is rejected with 422, and one whose request
+// is still being handled with 409. A request that doesn't finish within the
+// lease, such as one of a process that crashed, frees its key. Failures that a
+// retry may fix, 429 and 5xx responses, aren't kept.
+func Idempotency(store IdempotencyStore, window time.Duration, lease time.Duration, scope string, logger *logrus.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || !isMutating(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				render.JSONError(w, http.StatusBadRequest, dtos.RespError{Error: "Idempotency-Key must not exceed 255 characters"})
+				return
+			}
+
+			fingerprint, err := fingerprintRequest(r)
+			if err != nil {
+				logger.WithError(err).Error("Error reading request body")
+				render.JSONError(w, http.StatusBadRequest, dtos.RespError{Error: "Error reading request body"})
+				return
+			}
+
+			record := &models.IdempotencyRecord{
+				Scope:       scope + ":" + auth.TenantID(r.Context()),
+				Key:         key,
+				Fingerprint: fingerprint,
+				ExpiresAt:   time.Now().Add(lease),
+			}
+			existing, err := store.ReserveIdempotencyKey(r.Context(), record)
+			if err != nil {
+				logger.WithError(err).WithField("idempotency_key", key).Error("Error reserving idempotency key")
+				render.JSONError(w, http.StatusInternalServerError, dtos.RespError{Error: "Error checking Idempotency-Key"})
+				return
+			}
+
+			switch {
+			case existing == nil:
+				// a new request
+			case existing.Fingerprint != fingerprint:
+				render.JSONError(w, http.StatusUnprocessableEntity, dtos.RespError{Error: "Idempotency-Key was used for a different request"})
+				return
+			case existing.Status == 0:
+				render.JSONError(w, http.StatusConflict, dtos.RespError{Error: "A request with this Idempotency-Key is still in progress"})
+				return
+			default:
+				for key, values := range existing.Header {
+					w.Header()[key] = values
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(existing.Status)
+				w.Write(existing.Body)
+				return
+			}
+
+			// the outcome is stored even when the request was cancelled or timed out
+			storeCtx := context.Background()
+
+			// keep the key free for retries when the handler panics
+			before := w.Header().Clone()
+			recorder := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					store.ReleaseIdempotencyKey(storeCtx, record.Scope, record.Key)
+					panic(recovered)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status == http.StatusTooManyRequests || recorder.status >= 500 {
+				err = store.ReleaseIdempotencyKey(storeCtx, record.Scope, record.Key)
+			} else {
+				record.Status = recorder.status
+				record.Header = responseHeader(before, recorder.Header())
+				record.Body = recorder.body.Bytes()
+				record.ExpiresAt = time.Now().Add(window)
+				err = store.CompleteIdempotencyKey(storeCtx, record)
+				if err != nil {
+					// a reservation left behind would answer 409 until its lease ends
+					store.ReleaseIdempotencyKey(storeCtx, record.Scope, record.Key)
+				}
+			}
+			if err != nil {
+				logger.WithError(err).WithField("idempotency_key", key).Error("Error storing the response for idempotency key")
+			}
+		})
+	}
+}
+
+// the headers the handler set on its response. Those of the request, such as
+// its id, and rate limits, which a replay doesn't count against, are left out.
+func responseHeader(before http.Header, after http.Header) http.Header {
+	header := http.Header{}
+	for key, values := range after {
+		if strings.HasPrefix(key, "Ratelimit-") || key == "Retry-After" {
+			continue
+		}
+		if previous, ok := before[key]; ok && slices.Equal(previous, values) {
+			continue
+		}
+		header[key] = values
+	}
+	return header
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// a hash of what makes a request, its body is put back for the handler
+func fingerprintRequest(r *http.Request) (string, error) {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+
+	if r.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxFingerprintBodyBytes))
+		if err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		hash.Write(body)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// recordingWriter passes a response through, keeping a copy of it
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.status = status
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(data []byte) (int, error) {
+	rw.wroteHeader = true
+	rw.body.Write(data)
+	return rw.ResponseWriter.Write(data)
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+	"toggl/app/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// Count requests and time them per route. Routes are labelled with their
+// template, such as /v1/decks/{deck_id}, so ids don't make new series.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := wrapResponseWriter(w)
+
+		next.ServeHTTP(rw, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		metrics.ObserveRequest(r.Method, route, rw.status, time.Since(start))
+	})
+}
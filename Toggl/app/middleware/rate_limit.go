@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"toggl/app/auth"
+	"toggl/app/dtos"
+	"toggl/app/ratelimit"
+	"toggl/app/render"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Picks the bucket a request takes a token from, an empty key skips the limit
+type RateLimitKey func(r *http.Request) string
+
+// Limit requests with a token bucket per key. Responses carry the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, and
+// requests over the limit get a JSON 429 with Retry-After. When limits are
+// stacked the headers describe the one with the fewest requests left.
+// Requests are let through when the store fails. The limit is read for every
+// request, so a reloaded limit applies right away.
+func RateLimit(store ratelimit.Store, limits ratelimit.LimitSource, key RateLimitKey, logger *logrus.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := limits.Current()
+			if !limit.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			bucket := key(r)
+			if bucket == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := store.Take(r.Context(), bucket, limit)
+			if err != nil {
+				logger.WithError(err).WithField("bucket", bucket).Error("Error taking a rate limit token")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setRateLimitHeaders(w.Header(), result)
+			if !result.Allowed {
+				retryAfter := ceilSeconds(result.RetryAfter)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				render.JSONError(w, http.StatusTooManyRequests, dtos.RespError{Error: fmt.Sprintf("Too many requests, retry in %d seconds", retryAfter)})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Key requests by their API key, or the remote address of anonymous clients.
+// Anonymous clients of the Unix socket aren't limited: they all share one
+// empty remote address, and the socket's permissions already pick who may
+// connect. The prefix keeps the buckets of different limits apart.
+func ClientKey(prefix string) RateLimitKey {
+	return func(r *http.Request) string {
+		if principal, ok := auth.FromContext(r.Context()); ok {
+			return prefix + ":key:" + principal.KeyID
+		}
+
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+			return ""
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return prefix + ":ip:" + host
+	}
+}
+
+// Key draws by the tenant and the deck they draw from, found in the query
+// string or the JSON body. Deck ids are unique, but a tenant drawing with the
+// id of a deck it doesn't own would otherwise use up the owner's bucket. The
+// body is read up front and put back for the handler.
+func DrawDeckKey(r *http.Request) string {
+	deckId := r.URL.Query().Get("deck_id")
+	if render.IsJSONRequest(r) && r.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBytes))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err != nil {
+			return ""
+		}
+
+		var req dtos.ReqDrawCards
+		if json.Unmarshal(body, &req) == nil {
+			deckId = req.DeckID
+		}
+	}
+
+	if deckId == "" {
+		return ""
+	}
+	return auth.TenantID(r.Context()) + ":deck:" + deckId
+}
+
+// request bodies larger than this are left to the handler to reject
+const maxPeekBytes = 1 << 16
+
+// report the bucket with the fewest requests left
+func setRateLimitHeaders(header http.Header, result ratelimit.Result) {
+	if previous, err := strconv.Atoi(header.Get("RateLimit-Remaining")); err == nil && previous < result.Remaining {
+		return
+	}
+
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+// whole seconds, rounded up so clients don't retry too early
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
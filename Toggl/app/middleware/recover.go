@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+	"toggl/app/dtos"
+	"toggl/app/render"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Turn panics in handlers into a JSON 500 response
+func Recover(logger *logrus.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := wrapResponseWriter(w)
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					// the handler asked to abort the response, let net/http do it
+					panic(recovered)
+				}
+
+				logger.WithContext(r.Context()).WithFields(logrus.Fields{
+					"panic": recovered,
+					"stack": string(debug.Stack()),
+				}).Error("Recovered from panic in handler")
+
+				// too late for an error response once the handler started writing one
+				if rw.wroteHeader {
+					panic(http.ErrAbortHandler)
+				}
+				render.JSONError(rw, http.StatusInternalServerError, dtos.RespError{Error: "Internal server error"})
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"toggl/app/logging"
+	"toggl/app/utils"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// Tag every request with an id, reusing the one sent by the client if any
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(RequestIDHeader)
+		if requestId == "" || len(requestId) > 128 {
+			requestId = utils.Generate_uuid()
+		}
+
+		w.Header().Set(RequestIDHeader, requestId)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, requestId)
+		ctx = logging.With(ctx, logging.RequestID, requestId)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Get the id of the request the context belongs to
+func RequestIDFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIDKey{}).(string)
+	return requestId
+}
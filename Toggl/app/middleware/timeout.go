@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+	"toggl/app/render"
+
+	"github.com/gorilla/mux"
+)
+
+// Answer with a JSON 504 when a handler runs longer than the timeout, as
+// render.ServerError does for handlers that notice the deadline first. The
+// request context carries the deadline so handlers can give up early, and the
+// response is buffered until the handler is done, so it's not fit for streams.
+func Timeout(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header), status: http.StatusOK}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if recovered := recover(); recovered != nil {
+						panicked <- recovered
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case recovered := <-panicked:
+				// re-panic on the serving goroutine, where Recover can handle it
+				panic(recovered)
+			case <-done:
+				for key, values := range tw.header {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				// the handler keeps its own writer, nothing it writes from now on is sent
+				render.ServerError(w, r, ctx.Err())
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a response until the handler is done
+type timeoutWriter struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.status = status
+	tw.wroteHeader = true
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.wroteHeader = true
+	return tw.body.Write(data)
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("toggl/app/middleware")
+
+// Trace every request as a span named after its route, continuing the trace
+// of the caller when it sends a traceparent header. Handlers get the span in
+// the request context, so the spans of services and queries belong to it.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPRoute(route),
+				attribute.String("request_id", RequestIDFromContext(r.Context())),
+			))
+		defer span.End()
+
+		rw := wrapResponseWriter(w)
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPStatusCode(rw.status))
+		if rw.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rw.status))
+		}
+	})
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// A key granting access to the decks of a tenant
+type APIKey struct {
+	ID        string
+	TenantID  string
+	Name      string
+	KeyHash   string
+	CreatedAt time.Time
+}
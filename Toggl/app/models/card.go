@@ -1,10 +1,10 @@
 package models
 
 type Card struct {
-	Id     string `json:"id"`
-	DeckId string `json:"deck_id"`
+	Id     string `json:"id,omitempty"`
+	DeckId string `json:"deck_id,omitempty"`
 	Code   string `json:"code"`
 	Value  string `json:"value"`
 	Suit   string `json:"suit"`
-	Drawn  int    `json:"drawn"`
+	Drawn  int    `json:"drawn,omitempty"`
 }
@@ -5,4 +5,7 @@ type Deck struct {
 	Cards     []Card `json:"cards"`
 	Shuffled  bool   `json:"shuffled"`
 	Remaining int    `json:"remaining"`
+
+	Metadata map[string]string `json:"metadata"`
+	TenantID string            `json:"-"`
 }
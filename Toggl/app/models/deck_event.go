@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// types of deck events
+const (
+	DeckCreated = "deck.created"
+	CardsDrawn  = "deck.drawn"
+	DeckUpdated = "deck.updated"
+	DeckDeleted = "deck.deleted"
+)
+
+// A change of a deck. Events are numbered per deck from 1 and stored with the
+// change they describe, so replaying them in order rebuilds the deck.
+type DeckEvent struct {
+	Seq       int               `json:"seq"`
+	Type      string            `json:"type"`
+	DeckID    string            `json:"deck_id"`
+	Remaining int               `json:"remaining"`
+	Shuffled  bool              `json:"shuffled,omitempty"`
+	Cards     []Card            `json:"cards,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	TenantID  string            `json:"-"`
+	// version of the deck after the change
+	Version int `json:"-"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Filters for listing decks, nil fields are not applied
+type DeckFilter struct {
+	Shuffled      *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MinRemaining  *int
+	MaxRemaining  *int
+	Metadata      map[string]string
+	Cursor        string
+	Limit         int
+}
+
+// Position of the last deck of a page, decks are listed by creation time and id
+type DeckCursor struct {
+	CreatedAt time.Time
+	DeckID    string
+}
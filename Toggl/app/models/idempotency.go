@@ -0,0 +1,20 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// A request sent with an Idempotency-Key and, once it is done, its response.
+// Status is zero while the request is still being handled, until ExpiresAt
+// frees the key of a request that never finished.
+type IdempotencyRecord struct {
+	Scope       string
+	Key         string
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
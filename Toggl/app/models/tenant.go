@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Limits applied to the decks of a tenant
+type TenantLimits struct {
+	MaxDecks        int
+	MaxCardsPerDeck int
+}
+
+// A tenant with what it currently uses. Limits it doesn't override are the
+// configured defaults.
+type TenantUsage struct {
+	TenantID  string
+	Decks     int
+	Cards     int
+	APIKeys   int
+	Webhooks  int
+	Limits    TenantLimits
+	CreatedAt time.Time
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// events webhooks can subscribe to
+const (
+	WebhookDeckCreated   = "deck.created"
+	WebhookDeckExhausted = "deck.exhausted"
+	WebhookDeckDeleted   = "deck.deleted"
+)
+
+// The webhook event of a deck event, empty when webhooks aren't told about it
+func WebhookEvent(event DeckEvent) string {
+	switch {
+	case event.Type == DeckCreated:
+		return WebhookDeckCreated
+	case event.Type == CardsDrawn && event.Remaining == 0:
+		return WebhookDeckExhausted
+	case event.Type == DeckDeleted:
+		return WebhookDeckDeleted
+	default:
+		return ""
+	}
+}
+
+// statuses of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// An endpoint notified of deck lifecycle events
+type Webhook struct {
+	ID        string
+	TenantID  string
+	URL       string
+	Secret    string
+	Events    []string
+	CreatedAt time.Time
+}
+
+// One event sent to one webhook, retried until it succeeds or runs out of attempts
+type WebhookDelivery struct {
+	ID             string
+	WebhookID      string
+	EventType      string
+	DeckID         string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	LastStatusCode int
+	LastError      string
+	NextAttemptAt  time.Time
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+
+	// target of the delivery, loaded with due deliveries
+	URL    string
+	Secret string
+}
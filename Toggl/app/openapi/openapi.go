@@ -0,0 +1,40 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// The OpenAPI 3 document of the HTTP API. Keep it in step with RegisterRoutes
+// and the dtos, the openapi tests fail on routes and fields it leaves out.
+//
+//go:embed openapi.json
+var spec []byte
+
+// a page rendering the document, without assets from elsewhere
+//
+//go:embed docs.html
+var docs []byte
+
+// The OpenAPI document as JSON
+func Spec() []byte {
+	return spec
+}
+
+// Serve the OpenAPI document
+func Handler() http.Handler {
+	return serve("application/json", spec)
+}
+
+// Serve a page documenting the API from the OpenAPI document
+func DocsHandler() http.Handler {
+	return serve("text/html; charset=utf-8", docs)
+}
+
+func serve(contentType string, content []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(content)
+	})
+}
@@ -0,0 +1,190 @@
+package deckv1
+
+import (
+	"time"
+	"toggl/app/dtos"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Convert a response DTO into its protobuf message, false if it has none
+func FromDTO(v interface{}) (proto.Message, bool) {
+	switch resp := v.(type) {
+	case *dtos.RespCreateDeck:
+		return FromRespCreateDeck(resp), true
+	case *dtos.RespOpenDeck:
+		return FromRespOpenDeck(resp), true
+	case *dtos.RespDrawDeck:
+		return FromRespDrawDeck(resp), true
+	case *dtos.RespListDecks:
+		return FromRespListDecks(resp), true
+	case *dtos.RespDeckHistory:
+		return FromRespDeckHistory(resp), true
+	case *dtos.RespWebhook:
+		return FromRespWebhook(resp), true
+	case *dtos.RespListWebhooks:
+		return FromRespListWebhooks(resp), true
+	case *dtos.RespWebhookDeliveries:
+		return FromRespWebhookDeliveries(resp), true
+	case *dtos.RespAPIKey:
+		return FromRespAPIKey(resp), true
+	case *dtos.RespTenantUsage:
+		return FromRespTenantUsage(resp), true
+	case *dtos.RespListTenants:
+		return FromRespListTenants(resp), true
+	default:
+		return nil, false
+	}
+}
+
+func FromRespCreateDeck(resp *dtos.RespCreateDeck) *CreateDeckResponse {
+	return &CreateDeckResponse{
+		DeckId:    resp.DeckID,
+		Shuffled:  resp.Shuffled,
+		Remaining: int32(resp.Remaining),
+		Metadata:  resp.Metadata,
+	}
+}
+
+func FromRespOpenDeck(resp *dtos.RespOpenDeck) *OpenDeckResponse {
+	cards := make([]*Card, len(resp.Cards))
+	for i, card := range resp.Cards {
+		cards[i] = &Card{Code: card.Code, Value: card.Value, Suit: card.Suit}
+	}
+
+	return &OpenDeckResponse{
+		DeckId:    resp.DeckID,
+		Shuffled:  resp.Shuffled,
+		Remaining: int32(resp.Remaining),
+		Cards:     cards,
+		Metadata:  resp.Metadata,
+	}
+}
+
+func FromRespDrawDeck(resp *dtos.RespDrawDeck) *DrawCardsResponse {
+	cards := make([]*Card, len(resp.Cards))
+	for i, card := range resp.Cards {
+		cards[i] = &Card{Code: card.Code, Value: card.Value, Suit: card.Suit}
+	}
+
+	return &DrawCardsResponse{Cards: cards}
+}
+
+func FromRespListDecks(resp *dtos.RespListDecks) *ListDecksResponse {
+	decks := make([]*DeckSummary, len(resp.Decks))
+	for i, deck := range resp.Decks {
+		decks[i] = &DeckSummary{
+			DeckId:    deck.DeckID,
+			Shuffled:  deck.Shuffled,
+			Remaining: int32(deck.Remaining),
+			CreatedAt: timestamppb.New(deck.CreatedAt),
+			Metadata:  deck.Metadata,
+		}
+	}
+
+	return &ListDecksResponse{Decks: decks, NextCursor: resp.NextCursor}
+}
+
+func FromRespDeckHistory(resp *dtos.RespDeckHistory) *DeckHistoryResponse {
+	events := make([]*DeckEvent, len(resp.Events))
+	for i, event := range resp.Events {
+		cards := make([]*Card, len(event.Cards))
+		for j, card := range event.Cards {
+			cards[j] = &Card{Code: card.Code, Value: card.Value, Suit: card.Suit}
+		}
+
+		events[i] = &DeckEvent{
+			Seq:       int32(event.Seq),
+			Type:      event.Type,
+			DeckId:    event.DeckID,
+			Remaining: int32(event.Remaining),
+			Shuffled:  event.Shuffled,
+			Cards:     cards,
+			Metadata:  event.Metadata,
+			CreatedAt: timestamppb.New(event.CreatedAt),
+		}
+	}
+
+	return &DeckHistoryResponse{DeckId: resp.DeckID, Events: events}
+}
+
+func FromRespWebhook(resp *dtos.RespWebhook) *Webhook {
+	return &Webhook{
+		Id:        resp.ID,
+		Url:       resp.URL,
+		Events:    resp.Events,
+		Secret:    resp.Secret,
+		CreatedAt: timestamppb.New(resp.CreatedAt),
+	}
+}
+
+func FromRespListWebhooks(resp *dtos.RespListWebhooks) *ListWebhooksResponse {
+	webhooks := make([]*Webhook, len(resp.Webhooks))
+	for i := range resp.Webhooks {
+		webhooks[i] = FromRespWebhook(&resp.Webhooks[i])
+	}
+
+	return &ListWebhooksResponse{Webhooks: webhooks}
+}
+
+func FromRespWebhookDeliveries(resp *dtos.RespWebhookDeliveries) *WebhookDeliveriesResponse {
+	deliveries := make([]*WebhookDelivery, len(resp.Deliveries))
+	for i, delivery := range resp.Deliveries {
+		deliveries[i] = &WebhookDelivery{
+			Id:             delivery.ID,
+			EventType:      delivery.EventType,
+			DeckId:         delivery.DeckID,
+			Status:         delivery.Status,
+			Attempts:       int32(delivery.Attempts),
+			LastStatusCode: int32(delivery.LastStatusCode),
+			LastError:      delivery.LastError,
+			NextAttemptAt:  optionalTimestamp(delivery.NextAttemptAt),
+			CreatedAt:      timestamppb.New(delivery.CreatedAt),
+			DeliveredAt:    optionalTimestamp(delivery.DeliveredAt),
+		}
+	}
+
+	return &WebhookDeliveriesResponse{Deliveries: deliveries}
+}
+
+// unset times stay unset in the message
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func FromRespAPIKey(resp *dtos.RespAPIKey) *APIKey {
+	return &APIKey{
+		Id:        resp.ID,
+		TenantId:  resp.TenantID,
+		Name:      resp.Name,
+		Key:       resp.Key,
+		CreatedAt: timestamppb.New(resp.CreatedAt),
+	}
+}
+
+func FromRespTenantUsage(resp *dtos.RespTenantUsage) *TenantUsage {
+	return &TenantUsage{
+		TenantId: resp.TenantID,
+		Decks:    int32(resp.Decks),
+		Cards:    int32(resp.Cards),
+		ApiKeys:  int32(resp.APIKeys),
+		Webhooks: int32(resp.Webhooks),
+		Limits: &TenantLimits{
+			MaxDecks:        int32(resp.Limits.MaxDecks),
+			MaxCardsPerDeck: int32(resp.Limits.MaxCardsPerDeck),
+		},
+		CreatedAt: timestamppb.New(resp.CreatedAt),
+	}
+}
+
+func FromRespListTenants(resp *dtos.RespListTenants) *ListTenantsResponse {
+	tenants := make([]*TenantUsage, len(resp.Tenants))
+	for i := range resp.Tenants {
+		tenants[i] = FromRespTenantUsage(&resp.Tenants[i])
+	}
+	return &ListTenantsResponse{Tenants: tenants}
+}
@@ -0,0 +1,321 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: deck/v1/deck.proto
+
+package deckv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	DeckService_CreateNewDeck_FullMethodName       = "/deck.v1.DeckService/CreateNewDeck"
+	DeckService_OpenDeck_FullMethodName            = "/deck.v1.DeckService/OpenDeck"
+	DeckService_DrawCard_FullMethodName            = "/deck.v1.DeckService/DrawCard"
+	DeckService_CreateNewDeckStream_FullMethodName = "/deck.v1.DeckService/CreateNewDeckStream"
+	DeckService_DrawCardStream_FullMethodName      = "/deck.v1.DeckService/DrawCardStream"
+)
+
+// DeckServiceClient is the client API for DeckService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DeckServiceClient interface {
+	CreateNewDeck(ctx context.Context, in *CreateDeckRequest, opts ...grpc.CallOption) (*CreateDeckResponse, error)
+	OpenDeck(ctx context.Context, in *OpenDeckRequest, opts ...grpc.CallOption) (*OpenDeckResponse, error)
+	DrawCard(ctx context.Context, in *DrawCardsRequest, opts ...grpc.CallOption) (*DrawCardsResponse, error)
+	// Create a deck for every request received on the stream
+	CreateNewDeckStream(ctx context.Context, opts ...grpc.CallOption) (DeckService_CreateNewDeckStreamClient, error)
+	// Draw the cards at once and send them one message per card
+	DrawCardStream(ctx context.Context, in *DrawCardsRequest, opts ...grpc.CallOption) (DeckService_DrawCardStreamClient, error)
+}
+
+type deckServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDeckServiceClient(cc grpc.ClientConnInterface) DeckServiceClient {
+	return &deckServiceClient{cc}
+}
+
+func (c *deckServiceClient) CreateNewDeck(ctx context.Context, in *CreateDeckRequest, opts ...grpc.CallOption) (*CreateDeckResponse, error) {
+	out := new(CreateDeckResponse)
+	err := c.cc.Invoke(ctx, DeckService_CreateNewDeck_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deckServiceClient) OpenDeck(ctx context.Context, in *OpenDeckRequest, opts ...grpc.CallOption) (*OpenDeckResponse, error) {
+	out := new(OpenDeckResponse)
+	err := c.cc.Invoke(ctx, DeckService_OpenDeck_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deckServiceClient) DrawCard(ctx context.Context, in *DrawCardsRequest, opts ...grpc.CallOption) (*DrawCardsResponse, error) {
+	out := new(DrawCardsResponse)
+	err := c.cc.Invoke(ctx, DeckService_DrawCard_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deckServiceClient) CreateNewDeckStream(ctx context.Context, opts ...grpc.CallOption) (DeckService_CreateNewDeckStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DeckService_ServiceDesc.Streams[0], DeckService_CreateNewDeckStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &deckServiceCreateNewDeckStreamClient{stream}
+	return x, nil
+}
+
+type DeckService_CreateNewDeckStreamClient interface {
+	Send(*CreateDeckRequest) error
+	Recv() (*CreateDeckResponse, error)
+	grpc.ClientStream
+}
+
+type deckServiceCreateNewDeckStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *deckServiceCreateNewDeckStreamClient) Send(m *CreateDeckRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *deckServiceCreateNewDeckStreamClient) Recv() (*CreateDeckResponse, error) {
+	m := new(CreateDeckResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *deckServiceClient) DrawCardStream(ctx context.Context, in *DrawCardsRequest, opts ...grpc.CallOption) (DeckService_DrawCardStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DeckService_ServiceDesc.Streams[1], DeckService_DrawCardStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &deckServiceDrawCardStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type DeckService_DrawCardStreamClient interface {
+	Recv() (*Card, error)
+	grpc.ClientStream
+}
+
+type deckServiceDrawCardStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *deckServiceDrawCardStreamClient) Recv() (*Card, error) {
+	m := new(Card)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DeckServiceServer is the server API for DeckService service.
+// All implementations must embed UnimplementedDeckServiceServer
+// for forward compatibility
+type DeckServiceServer interface {
+	CreateNewDeck(context.Context, *CreateDeckRequest) (*CreateDeckResponse, error)
+	OpenDeck(context.Context, *OpenDeckRequest) (*OpenDeckResponse, error)
+	DrawCard(context.Context, *DrawCardsRequest) (*DrawCardsResponse, error)
+	// Create a deck for every request received on the stream
+	CreateNewDeckStream(DeckService_CreateNewDeckStreamServer) error
+	// Draw the cards at once and send them one message per card
+	DrawCardStream(*DrawCardsRequest, DeckService_DrawCardStreamServer) error
+	mustEmbedUnimplementedDeckServiceServer()
+}
+
+// UnimplementedDeckServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedDeckServiceServer struct {
+}
+
+func (UnimplementedDeckServiceServer) CreateNewDeck(context.Context, *CreateDeckRequest) (*CreateDeckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateNewDeck not implemented")
+}
+func (UnimplementedDeckServiceServer) OpenDeck(context.Context, *OpenDeckRequest) (*OpenDeckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OpenDeck not implemented")
+}
+func (UnimplementedDeckServiceServer) DrawCard(context.Context, *DrawCardsRequest) (*DrawCardsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DrawCard not implemented")
+}
+func (UnimplementedDeckServiceServer) CreateNewDeckStream(DeckService_CreateNewDeckStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method CreateNewDeckStream not implemented")
+}
+func (UnimplementedDeckServiceServer) DrawCardStream(*DrawCardsRequest, DeckService_DrawCardStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method DrawCardStream not implemented")
+}
+func (UnimplementedDeckServiceServer) mustEmbedUnimplementedDeckServiceServer() {}
+
+// UnsafeDeckServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DeckServiceServer will
+// result in compilation errors.
+type UnsafeDeckServiceServer interface {
+	mustEmbedUnimplementedDeckServiceServer()
+}
+
+func RegisterDeckServiceServer(s grpc.ServiceRegistrar, srv DeckServiceServer) {
+	s.RegisterService(&DeckService_ServiceDesc, srv)
+}
+
+func _DeckService_CreateNewDeck_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateDeckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeckServiceServer).CreateNewDeck(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeckService_CreateNewDeck_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeckServiceServer).CreateNewDeck(ctx, req.(*CreateDeckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeckService_OpenDeck_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OpenDeckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeckServiceServer).OpenDeck(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeckService_OpenDeck_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeckServiceServer).OpenDeck(ctx, req.(*OpenDeckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeckService_DrawCard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrawCardsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeckServiceServer).DrawCard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeckService_DrawCard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeckServiceServer).DrawCard(ctx, req.(*DrawCardsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeckService_CreateNewDeckStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DeckServiceServer).CreateNewDeckStream(&deckServiceCreateNewDeckStreamServer{stream})
+}
+
+type DeckService_CreateNewDeckStreamServer interface {
+	Send(*CreateDeckResponse) error
+	Recv() (*CreateDeckRequest, error)
+	grpc.ServerStream
+}
+
+type deckServiceCreateNewDeckStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *deckServiceCreateNewDeckStreamServer) Send(m *CreateDeckResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *deckServiceCreateNewDeckStreamServer) Recv() (*CreateDeckRequest, error) {
+	m := new(CreateDeckRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _DeckService_DrawCardStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DrawCardsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DeckServiceServer).DrawCardStream(m, &deckServiceDrawCardStreamServer{stream})
+}
+
+type DeckService_DrawCardStreamServer interface {
+	Send(*Card) error
+	grpc.ServerStream
+}
+
+type deckServiceDrawCardStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *deckServiceDrawCardStreamServer) Send(m *Card) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// DeckService_ServiceDesc is the grpc.ServiceDesc for DeckService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DeckService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "deck.v1.DeckService",
+	HandlerType: (*DeckServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateNewDeck",
+			Handler:    _DeckService_CreateNewDeck_Handler,
+		},
+		{
+			MethodName: "OpenDeck",
+			Handler:    _DeckService_OpenDeck_Handler,
+		},
+		{
+			MethodName: "DrawCard",
+			Handler:    _DeckService_DrawCard_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CreateNewDeckStream",
+			Handler:       _DeckService_CreateNewDeckStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DrawCardStream",
+			Handler:       _DeckService_DrawCardStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "deck/v1/deck.proto",
+}
@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// A token bucket holding up to Burst tokens, refilled at Rate tokens per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// A limit allowing perMinute requests a minute, with bursts of up to burst
+// requests. Zero for either disables the limit.
+func PerMinute(perMinute int, burst int) Limit {
+	return Limit{Rate: float64(perMinute) / 60, Burst: burst}
+}
+
+// Whether the limit applies at all
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Provides the limit in force, which may change while the service runs
+type LimitSource interface {
+	Current() Limit
+}
+
+// A limit that never changes
+func (l Limit) Current() Limit {
+	return l
+}
+
+// A limit read again for every request
+type LimitFunc func() Limit
+
+func (f LimitFunc) Current() Limit {
+	return f()
+}
+
+// The outcome of taking a token from a bucket
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// time until a token is available, zero when the request was allowed
+	RetryAfter time.Duration
+	// time until the bucket is full again
+	Reset time.Duration
+}
+
+// Keeps the buckets. Implementations backed by a shared store let several
+// instances enforce the same limits.
+type Store interface {
+	// Take a token from the bucket of key, a new bucket starts full
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// how often idle buckets are dropped from memory
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// A Store keeping buckets in memory, for a single instance
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	// Now returns the current time, replaceable in tests
+	Now func() time.Time
+}
+
+// Create an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), Now: time.Now}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+
+	result := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+
+	return result, nil
+}
+
+// add the tokens earned since the last update, up to the burst
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+	}
+	b.updated = now
+}
+
+// drop buckets that have refilled, they are the same as new ones
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"toggl/app/logging"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// editors write a file in several steps, reload once they are done
+const reloadDelay = 100 * time.Millisecond
+
+// Reload the runtime-safe settings from the config file at path whenever it
+// changes or the process gets SIGHUP, while the app runs
+func (a *App) WatchConfig(path string) {
+	a.configPath = path
+}
+
+// Reload the runtime-safe settings from the config file now, logging what
+// changed. The current settings are kept when the file is invalid.
+func (a *App) ReloadConfig() error {
+	applied, restart, err := a.live.Reload(a.configPath)
+	if err != nil {
+		a.logger.WithError(err).WithField("path", a.configPath).Error("Error reloading configuration, keeping the current one")
+		return err
+	}
+
+	err = logging.SetLevel(a.logger, a.live.Current().LogLevel)
+	if err != nil {
+		return err
+	}
+
+	if len(applied) > 0 {
+		a.logger.WithField("changes", strings.Join(applied, ", ")).Info("Configuration reloaded")
+	}
+	if len(restart) > 0 {
+		a.logger.WithField("changes", strings.Join(restart, ", ")).Warn("Configuration changes need a restart to apply")
+	}
+	return nil
+}
+
+// reload the config on SIGHUP and changes to the file until ctx is done
+func (a *App) watchConfig(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	// Watch the directory, as editors and config maps replace the file
+	var changes chan fsnotify.Event
+	var watchErrors chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watcher.Add(filepath.Dir(a.configPath))
+	}
+	if err != nil {
+		a.logger.WithError(err).Warn("Not watching the configuration file, reload it with SIGHUP")
+	} else {
+		defer watcher.Close()
+		changes = watcher.Events
+		watchErrors = watcher.Errors
+	}
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			a.ReloadConfig()
+		case event := <-changes:
+			if filepath.Clean(event.Name) == filepath.Clean(a.configPath) && !event.Has(fsnotify.Chmod) {
+				reload = time.After(reloadDelay)
+			}
+		case err := <-watchErrors:
+			a.logger.WithError(err).Warn("Error watching the configuration file")
+		case <-reload:
+			reload = nil
+			a.ReloadConfig()
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"toggl/app/dtos"
+	"toggl/app/pb/deckv1"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// media types the API responds with
+const (
+	MediaTypeJSON     = "application/json"
+	MediaTypeMsgpack  = "application/msgpack"
+	MediaTypeProtobuf = "application/x-protobuf"
+	MediaTypeText     = "text/plain; charset=utf-8"
+)
+
+// accepted names of each media type
+var mediaTypeAliases = map[string]string{
+	"application/json":       MediaTypeJSON,
+	"application/msgpack":    MediaTypeMsgpack,
+	"application/x-msgpack":  MediaTypeMsgpack,
+	"application/x-protobuf": MediaTypeProtobuf,
+	"application/protobuf":   MediaTypeProtobuf,
+	"application/*":          MediaTypeJSON,
+	"*/*":                    MediaTypeJSON,
+}
+
+// Pick the response media type from the Accept header, JSON when there is none.
+// Writes a 406 response and returns false when no supported type is accepted.
+func Negotiate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	mediaType, ok := NegotiateMediaType(r.Header.Get("Accept"))
+	if !ok {
+		Error(w, r, http.StatusNotAcceptable, "Not acceptable, supported types are "+MediaTypeJSON+", "+MediaTypeMsgpack+" and "+MediaTypeProtobuf)
+		return "", false
+	}
+	return mediaType, true
+}
+
+func NegotiateMediaType(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return MediaTypeJSON, true
+	}
+
+	type acceptedType struct {
+		mediaType string
+		quality   float64
+	}
+	var accepted []acceptedType
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		supported, ok := mediaTypeAliases[mediaType]
+		if !ok {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			accepted = append(accepted, acceptedType{mediaType: supported, quality: quality})
+		}
+	}
+	if len(accepted) == 0 {
+		return "", false
+	}
+
+	// highest quality wins, ties go to the first listed type
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+	return accepted[0].mediaType, true
+}
+
+// Check whether the request carries a JSON body
+func IsJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == MediaTypeJSON
+}
+
+// Encode a response DTO in the given media type
+func Encode(mediaType string, v interface{}) ([]byte, error) {
+	switch mediaType {
+	case MediaTypeMsgpack:
+		// same field names as the JSON encoding
+		var buf bytes.Buffer
+		encoder := msgpack.NewEncoder(&buf)
+		encoder.SetCustomStructTag("json")
+		err := encoder.Encode(v)
+		return buf.Bytes(), err
+	case MediaTypeProtobuf:
+		message, ok := deckv1.FromDTO(v)
+		if !ok {
+			return nil, errors.New("no protobuf message for response")
+		}
+		return proto.Marshal(message)
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// Write a response DTO in the negotiated media type. The DTO is encoded before
+// anything is written, so an encoding error still gets a proper 500 response.
+func Respond(w http.ResponseWriter, mediaType string, status int, v interface{}) error {
+	data, err := Encode(mediaType, v)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, dtos.RespError{Error: "Error creating response"})
+		return err
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
+
+// Write an error message. Clients of the JSON API, which send a JSON body or
+// ask for an application type, get a JSON error; others get plain text.
+func Error(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if IsJSONRequest(r) || strings.Contains(r.Header.Get("Accept"), "application/") {
+		JSONError(w, status, dtos.RespError{Error: message})
+		return
+	}
+
+	w.Header().Set("Content-Type", MediaTypeText)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write([]byte(message + "\n"))
+}
+
+// Write the error of a request the service failed to handle. A request whose
+// deadline passed gets a JSON 504, and one its client gave up on a JSON 503,
+// anything else is a 500.
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		JSONError(w, http.StatusGatewayTimeout, dtos.RespError{Error: "Request timed out"})
+	case errors.Is(err, context.Canceled):
+		JSONError(w, http.StatusServiceUnavailable, dtos.RespError{Error: "Request was cancelled"})
+	default:
+		Error(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Write a 400 response listing the invalid fields of a request body
+func ValidationError(w http.ResponseWriter, fields []dtos.RespFieldError) {
+	JSONError(w, http.StatusBadRequest, dtos.RespError{Error: "Invalid request body", Fields: fields})
+}
+
+// Write an error as JSON
+func JSONError(w http.ResponseWriter, status int, resp dtos.RespError) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		// a RespError always marshals, keep the status regardless
+		data = []byte(`{"error":"Internal server error"}`)
+	}
+
+	w.Header().Set("Content-Type", MediaTypeJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,82 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"toggl/app/logging"
+	"toggl/app/models"
+	"toggl/app/utils"
+)
+
+// Store a new API key of a tenant, registering the tenant when it is new.
+// Only the hash of the key itself is kept.
+func (r *Repository) CreateAPIKey(ctx context.Context, apiKey *models.APIKey) error {
+	ctx, done := startQuery(ctx, "create_api_key")
+	defer done()
+
+	err := ensureTenant(ctx, r.db, apiKey.TenantID)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField(logging.TenantID, apiKey.TenantID).Error("Error in registering tenant")
+		return err
+	}
+
+	apiKey.ID = utils.Generate_uuid()
+	apiKey.CreatedAt = time.Now().UTC()
+
+	keyStmt := `
+        INSERT INTO api_keys(id, tenant_id, name, key_hash, created_at) VALUES(?, ?, ?, ?, ?);
+    `
+	_, err = r.db.ExecContext(ctx, keyStmt, apiKey.ID, apiKey.TenantID, apiKey.Name, apiKey.KeyHash, apiKey.CreatedAt)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in inserting API key")
+		return err
+	}
+
+	return nil
+}
+
+// Find the active API key with the given hash, nil when there is none
+func (r *Repository) FindAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	ctx, done := startQuery(ctx, "find_api_key")
+	defer done()
+
+	keyQuery := `
+        SELECT id, tenant_id, name, key_hash, created_at
+        FROM api_keys
+        WHERE key_hash = ? AND revoked_at IS NULL
+    `
+	var apiKey models.APIKey
+	err := r.db.QueryRowContext(ctx, keyQuery, keyHash).Scan(&apiKey.ID, &apiKey.TenantID, &apiKey.Name, &apiKey.KeyHash, &apiKey.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in finding API key")
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
+
+// Revoke an API key, false when there is no active key with the id
+func (r *Repository) RevokeAPIKey(ctx context.Context, keyId string) (bool, error) {
+	ctx, done := startQuery(ctx, "revoke_api_key")
+	defer done()
+
+	revokeStmt := `
+        UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL;
+    `
+	result, err := r.db.ExecContext(ctx, revokeStmt, time.Now().UTC(), keyId)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField("key_id", keyId).Error("Error in revoking API key")
+		return false, err
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return revoked > 0, nil
+}
@@ -0,0 +1,91 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+	"toggl/app/models"
+)
+
+// the parts of an event kept in its payload column
+type eventPayload struct {
+	Shuffled bool              `json:"shuffled,omitempty"`
+	Cards    []models.Card     `json:"cards,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// append an event to the history of its deck, numbering it after the last
+// one, and queue its webhook deliveries. Runs in the transaction of the
+// change it records, so a change never happens without its event and
+// deliveries.
+func appendEvent(ctx context.Context, tx *sql.Tx, event *models.DeckEvent) error {
+	err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) + 1 FROM deck_events WHERE deck_id = ?`, event.DeckID).Scan(&event.Seq)
+	if err != nil {
+		return err
+	}
+	event.CreatedAt = time.Now().UTC()
+
+	payload, err := json.Marshal(eventPayload{Shuffled: event.Shuffled, Cards: event.Cards, Metadata: event.Metadata})
+	if err != nil {
+		return err
+	}
+
+	eventStmt := `
+        INSERT INTO deck_events(deck_id, seq, type, remaining, payload, created_at, tenant_id) VALUES(?, ?, ?, ?, ?, ?, ?);
+    `
+	_, err = tx.ExecContext(ctx, eventStmt, event.DeckID, event.Seq, event.Type, event.Remaining, string(payload), event.CreatedAt, event.TenantID)
+	if err != nil {
+		return err
+	}
+
+	return enqueueDeliveries(ctx, tx, event)
+}
+
+// Events of a deck owned by the tenant, in the order they happened
+func (r *Repository) DeckHistory(ctx context.Context, tenantId string, deckId string) ([]models.DeckEvent, error) {
+	ctx, done := startQuery(ctx, "deck_history")
+	defer done()
+
+	eventsQuery := `
+        SELECT seq, type, remaining, payload, created_at
+        FROM deck_events
+        WHERE deck_id = ? AND tenant_id = ?
+        ORDER BY seq
+    `
+	rows, err := r.db.QueryContext(ctx, eventsQuery, deckId, tenantId)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in querying deck events")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.DeckEvent
+	for rows.Next() {
+		event := models.DeckEvent{DeckID: deckId, TenantID: tenantId}
+		var payload string
+		err := rows.Scan(&event.Seq, &event.Type, &event.Remaining, &payload, &event.CreatedAt)
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).Error("Error in scanning deck event")
+			return nil, err
+		}
+
+		var p eventPayload
+		err = json.Unmarshal([]byte(payload), &p)
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).WithField("seq", event.Seq).Error("Error in decoding deck event")
+			return nil, err
+		}
+		event.Shuffled, event.Cards, event.Metadata = p.Shuffled, p.Cards, p.Metadata
+		event.CreatedAt = event.CreatedAt.UTC()
+
+		history = append(history, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in retriving")
+		return nil, err
+	}
+
+	return history, nil
+}
@@ -1,43 +1,70 @@
 package repos
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
 	"strings"
+	"time"
 	"toggl/app/config"
 	"toggl/app/dtos"
+	"toggl/app/logging"
+	"toggl/app/metrics"
 	"toggl/app/models"
 	"toggl/app/utils"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// the decks of a tenant that count against its deck limit, and are reported
+// in its usage: those with cards left
+const limitedDeck = "remaining > 0"
+
+// Returned by DrawCard when the deck has fewer cards left than requested
+var ErrNotEnoughCards = errors.New("Not enough cards left in deck")
+
 type DeckRepository interface {
-	CreateDeck(deck models.Deck) (string, error)
-	OpenDeck(deckId string) (*dtos.RespOpenDeck, error)
-	CheckDeckExist(deckId string) (bool, error)
-	DrawCard(deckId string, count int) (*dtos.RespDrawDeck, error)
+	CreateDeck(ctx context.Context, deck *models.Deck, maxDecks int) (*models.DeckEvent, error)
+	OpenDeck(ctx context.Context, tenantId string, deckId string) (*dtos.RespOpenDeck, error)
+	CheckDeckExist(ctx context.Context, tenantId string, deckId string) (bool, error)
+	CountDecks(ctx context.Context) (int, error)
+	DrawCard(ctx context.Context, tenantId string, deckId string, count int, version int) (*models.DeckEvent, error)
+	UpdateDeckMetadata(ctx context.Context, tenantId string, deckId string, metadata map[string]*string, version int) (*models.DeckEvent, error)
+	DeleteDeck(ctx context.Context, tenantId string, deckId string, version int) (*models.DeckEvent, error)
+	DeckHistory(ctx context.Context, tenantId string, deckId string) ([]models.DeckEvent, error)
 }
 
 type Repository struct {
 	logger   *logrus.Logger
 	testMode bool
-	config   *config.Config
+	config   config.Source
+	db       *sql.DB
 }
 
+// Transactions take the write lock when they begin, so concurrent writers
+// wait their turn for up to busyTimeout instead of failing with "database
+// is locked" when a read lock can't be upgraded
+const busyTimeout = 5 * time.Second
+
 func setupDb(isTest bool, conf *config.Config) (*sql.DB, error) {
-	var db *sql.DB
-	var err error
+	path := conf.Database.ProdPath
 	if isTest {
-		db, err = sql.Open("sqlite3", conf.Database.TestPath)
-		if err != nil {
-			return nil, err
-		}
-		return db, nil
+		path = conf.Database.TestPath
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
 	}
-	db, err = sql.Open("sqlite3", conf.Database.ProdPath)
+	dsn := fmt.Sprintf("%s%s_txlock=immediate&_busy_timeout=%d", path, separator, busyTimeout.Milliseconds())
+
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -46,80 +73,106 @@ func setupDb(isTest bool, conf *config.Config) (*sql.DB, error) {
 
 }
 
-// Setup new database repository
-func NewRepository(logger *logrus.Logger, testMode bool, config *config.Config) *Repository {
+var tracer = otel.Tracer("toggl/app/repos")
+
+// trace a repository query as a span of ctx and time it. The returned
+// function ends both, meant to be deferred.
+func startQuery(ctx context.Context, query string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, "repository."+query,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemSqlite, semconv.DBOperation(query)))
+
+	return ctx, func() {
+		metrics.ObserveQuery(query, start)
+		span.End()
+	}
+}
+
+// Setup new database repository. The database it opens is fixed, tenant
+// limits follow the config when it is reloaded.
+func NewRepository(logger *logrus.Logger, testMode bool, config config.Source) *Repository {
 
 	// open the database
-	db, err := setupDb(testMode, config)
-
-	if err != nil {
-		logger.Error(err)
-	}
-	defer db.Close()
-
-	sqlStmt := `create table if not exists decks (
-		id text not null primary key,
-		shuffled boolean,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	  );
-	  
-	  create table if not exists cards (
-		id text not null primary key,
-		value text,
-		suit text,
-		deck_id text not null,
-		drawn int not null DEFAULT 0,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		foreign key(deck_id) references decks(id) on delete cascade
-	  );
-	  
+	db, err := setupDb(testMode, config.Current())
+
+	if err != nil {
+		logger.WithError(err).Fatal("Error opening database")
+	}
+
+	// bring the schema up to date
+	err = migrate(db)
+	if err != nil {
+		logger.WithError(err).Fatal("Error migrating database")
+	}
+
+	sqlStmt := `
 	  delete from decks;
 	  delete from cards;
+	  delete from deck_metadata;
 	  `
 
 	// execute the SQL statements
 	_, err = db.Exec(sqlStmt)
 	if err != nil {
-		log.Fatal(err)
+		logger.WithError(err).Fatal("Error clearing database")
 	}
-	return &Repository{logger: logger, testMode: testMode, config: config}
+	return &Repository{logger: logger, testMode: testMode, config: config, db: db}
 }
 
-// Create deck
-func (r *Repository) CreateDeck(deck *models.Deck) (string, error) {
+// Close the database once queries in flight are done, queries made after
+// fail
+func (r *Repository) Close() error {
+	return r.db.Close()
+}
 
-	var deckId = utils.Generate_uuid()
-	// open the database
-	db, err := setupDb(r.testMode, r.config)
+// Create deck, returning the event recording it. The event is nil when the
+// tenant already has maxDecks decks with cards left, zero or less allows any
+// number. Decks whose last card was drawn don't count.
+func (r *Repository) CreateDeck(ctx context.Context, deck *models.Deck, maxDecks int) (event *models.DeckEvent, err error) {
+	ctx, done := startQuery(ctx, "create_deck")
+	defer done()
 
+	var deckId = utils.Generate_uuid()
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		r.logger.Error(err)
-	}
-
-	defer db.Close()
-	tx, err := db.Begin()
-	if err != nil {
-		r.logger.Errorf("Error %s in begin database transaction", err)
-		return "", err
+		r.logger.WithContext(ctx).WithError(err).Error("Error in begin database transaction")
+		return nil, err
 	}
 	defer func() {
 		if err != nil {
-			r.logger.Errorf("Error %s in roleback transaction", err)
+			r.logger.WithContext(ctx).WithError(err).Error("Error in roleback transaction")
 			tx.Rollback()
 			return
 		}
 		err = tx.Commit()
 	}()
 
-	// insert new deck
+	err = ensureTenant(ctx, tx, deck.TenantID)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField(logging.TenantID, deck.TenantID).Error("Error in registering tenant")
+		return nil, err
+	}
+
+	// insert new deck, unless the tenant has no room left for it
 	deckStmt := `
-        INSERT INTO decks(id, shuffled) VALUES(?, ?);
+        INSERT INTO decks(id, shuffled, remaining, tenant_id, created_at)
+        SELECT ?, ?, ?, ?, ?
+        WHERE ? <= 0 OR (SELECT count(*) FROM decks WHERE tenant_id = ? AND ` + limitedDeck + `) < ?;
     `
 
-	_, err = tx.Exec(deckStmt, deckId, deck.Shuffled)
+	result, err := tx.ExecContext(ctx, deckStmt, deckId, deck.Shuffled, len(deck.Cards), deck.TenantID, formatTimestamp(time.Now()), maxDecks, deck.TenantID, maxDecks)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in inserting deck")
+		return nil, err
+	}
+	inserted, err := result.RowsAffected()
 	if err != nil {
-		r.logger.Errorf("Error %s in executing %s", err, deckStmt)
-		return "", err
+		r.logger.WithContext(ctx).WithError(err).Error("Error in checking inserted deck")
+		return nil, err
+	}
+	if inserted == 0 {
+		return nil, nil
 	}
 
 	// insert cards for deck
@@ -133,35 +186,53 @@ func (r *Repository) CreateDeck(deck *models.Deck) (string, error) {
 		args = append(args, utils.Generate_uuid(), deck.Cards[i].Value, deck.Cards[i].Suit, deckId)
 	}
 	cardStmt += strings.Join(placeholders, ", ")
-	_, err = tx.Exec(cardStmt, args...)
+	_, err = tx.ExecContext(ctx, cardStmt, args...)
 	if err != nil {
-		r.logger.Errorf("Error %s in executing %s", err, cardStmt)
-		return "", err
+		r.logger.WithContext(ctx).WithError(err).Error("Error in inserting cards")
+		return nil, err
 	}
 
-	return deckId, nil
-}
-
-// Open deck
-func (r *Repository) OpenDeck(deckId string) (*dtos.RespOpenDeck, error) {
-
-	db, err := setupDb(r.testMode, r.config)
+	// insert metadata for deck
+	err = insertMetadata(ctx, tx, deckId, deck.Metadata)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in inserting metadata")
+		return nil, err
+	}
 
+	// record the cards in the order they were dealt into the deck
+	event = &models.DeckEvent{
+		Type:      models.DeckCreated,
+		DeckID:    deckId,
+		Remaining: len(deck.Cards),
+		Shuffled:  deck.Shuffled,
+		Cards:     deck.Cards,
+		Metadata:  deck.Metadata,
+		TenantID:  deck.TenantID,
+		Version:   1,
+	}
+	err = appendEvent(ctx, tx, event)
 	if err != nil {
-		r.logger.Error(err)
+		r.logger.WithContext(ctx).WithError(err).WithField(logging.DeckID, deckId).Error("Error in recording creation of deck")
+		return nil, err
 	}
 
-	defer db.Close()
+	return event, nil
+}
+
+// Open a deck of the tenant
+func (r *Repository) OpenDeck(ctx context.Context, tenantId string, deckId string) (*dtos.RespOpenDeck, error) {
+	ctx, done := startQuery(ctx, "open_deck")
+	defer done()
 
 	var deck dtos.RespOpenDeck
 	deckQuery := `
-        SELECT id, shuffled
+        SELECT id, shuffled, version
         FROM decks
-        WHERE id = ?
+        WHERE id = ? AND tenant_id = ?
     `
-	err = db.QueryRow(deckQuery, deckId).Scan(&deck.DeckID, &deck.Shuffled)
+	err := r.db.QueryRowContext(ctx, deckQuery, deckId, tenantId).Scan(&deck.DeckID, &deck.Shuffled, &deck.Version)
 	if err != nil {
-		r.logger.Errorf("Error %s in querying %s with %s", err, deckQuery, deckId)
+		r.logger.WithContext(ctx).WithError(err).Error("Error in querying deck")
 		return nil, err
 	}
 
@@ -171,10 +242,10 @@ func (r *Repository) OpenDeck(deckId string) (*dtos.RespOpenDeck, error) {
         WHERE deck_id = ? AND drawn = 0
         ORDER BY created_at
     `
-	rows, err := db.Query(cardsQuery, deckId)
+	rows, err := r.db.QueryContext(ctx, cardsQuery, deckId)
 	deck.Remaining = 0
 	if err != nil {
-		r.logger.Errorf("Error %s in querying %s with %s", err, cardsQuery, deckId)
+		r.logger.WithContext(ctx).WithError(err).Error("Error in querying cards")
 		return nil, err
 	}
 	defer rows.Close()
@@ -183,7 +254,7 @@ func (r *Repository) OpenDeck(deckId string) (*dtos.RespOpenDeck, error) {
 		var card dtos.RespOpenDeckCard
 		err := rows.Scan(&card.Value, &card.Suit)
 		if err != nil {
-			r.logger.Errorf("Error %s in scanning %s and %s", err, "card.Value", "card.Suit")
+			r.logger.WithContext(ctx).WithError(err).Error("Error in scanning card")
 			return nil, err
 		}
 		deck.Remaining += 1
@@ -192,87 +263,130 @@ func (r *Repository) OpenDeck(deckId string) (*dtos.RespOpenDeck, error) {
 	}
 
 	if err := rows.Err(); err != nil {
-		r.logger.Errorf("Error %s in scanning ", err)
+		r.logger.WithContext(ctx).WithError(err).Error("Error in scanning")
 		return nil, err
 	}
 
-	return &deck, nil
-}
-
-// Check is id exist
-func (r *Repository) CheckDeckExist(deckId string) (bool, error) {
-
-	db, err := setupDb(r.testMode, r.config)
-
+	metadata, err := loadMetadata(ctx, r.db, []string{deckId})
 	if err != nil {
-		r.logger.Error(err)
+		r.logger.WithContext(ctx).WithError(err).Error("Error in loading deck metadata")
+		return nil, err
 	}
+	deck.Metadata = metadata[deckId]
 
-	defer db.Close()
+	return &deck, nil
+}
+
+// Check is id exist and owned by the tenant
+func (r *Repository) CheckDeckExist(ctx context.Context, tenantId string, deckId string) (bool, error) {
+	ctx, done := startQuery(ctx, "check_deck_exist")
+	defer done()
 
 	deckQuery := `
         SELECT EXISTS(
-            SELECT 1 FROM decks WHERE id = ?
+            SELECT 1 FROM decks WHERE id = ? AND tenant_id = ?
         )
     `
 	var exist bool
-	err = db.QueryRow(deckQuery, deckId).Scan(&exist)
+	err := r.db.QueryRowContext(ctx, deckQuery, deckId, tenantId).Scan(&exist)
 	if err != nil {
-		r.logger.Error("Error %s in querying %s with param %s", err, deckQuery, deckId)
+		r.logger.WithContext(ctx).WithError(err).Error("Error in checking deck exists")
 		return false, err
 	}
 
 	return exist, nil
 }
 
-// draw cards from deck
-func (r *Repository) DrawCard(deckId string, count int) (*dtos.RespDrawDeck, error) {
+// Number of decks of every tenant
+func (r *Repository) CountDecks(ctx context.Context) (int, error) {
+	ctx, done := startQuery(ctx, "count_decks")
+	defer done()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM decks`).Scan(&count)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in counting decks")
+		return 0, err
+	}
+
+	return count, nil
+}
 
-	db, err := setupDb(r.testMode, r.config)
+// draw cards from a deck of the tenant, returning the event recording the drawn
+// cards. The event is nil when the deck isn't at the given version, zero
+// draws from any version. A deck with fewer than count cards left fails with
+// ErrNotEnoughCards and one that doesn't exist with sql.ErrNoRows.
+func (r *Repository) DrawCard(ctx context.Context, tenantId string, deckId string, count int, version int) (event *models.DeckEvent, err error) {
+	ctx, done := startQuery(ctx, "draw_card")
+	defer done()
 
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		r.logger.Error(err)
+		r.logger.WithContext(ctx).WithError(err).Error("Error in begin database transaction")
+		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).Error("Error in roleback transaction")
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
 
-	defer db.Close()
+	current, err := deckVersion(ctx, tx, tenantId, deckId)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in loading deck version")
+		return nil, err
+	}
+	if version != 0 && current != version {
+		return nil, nil
+	}
 
 	// draw cards
 	cardsQuery := `
         SELECT id, value, suit
         FROM cards
-        WHERE deck_id = ? AND drawn = 0
+        WHERE deck_id = (SELECT id FROM decks WHERE id = ? AND tenant_id = ?) AND drawn = 0
         ORDER BY created_at
         LIMIT ?
     `
-	rows, err := db.Query(cardsQuery, deckId, count)
+	rows, err := tx.QueryContext(ctx, cardsQuery, deckId, tenantId, count)
 	if err != nil {
-		r.logger.Errorf("Error %s in querying %s with parmas %s and %d", err, cardsQuery, deckId, count)
+		r.logger.WithContext(ctx).WithError(err).WithField("count", count).Error("Error in querying cards to draw")
 		return nil, err
 	}
 	defer rows.Close()
 
 	var cardIds []string
-	var cards []dtos.RespDrawCard
+	var cards []models.Card
 	for rows.Next() {
 		var card models.Card
-		err := rows.Scan(&card.Id, &card.Value, &card.Suit)
+		err = rows.Scan(&card.Id, &card.Value, &card.Suit)
 		if err != nil {
-			r.logger.Errorf("Error %s in scan %s with parmas %s and %s", err, "card.Id", "card.Value", "card.Suit")
+			r.logger.WithContext(ctx).WithError(err).Error("Error in scanning card")
 			return nil, err
 		}
 
 		cardIds = append(cardIds, card.Id)
-		cards = append(cards, dtos.RespDrawCard{
+		cards = append(cards, models.Card{
 			Value: card.Value,
 			Suit:  card.Suit,
 			Code:  string(card.Value[0]) + string(card.Suit[0]),
 		})
 	}
 
-	if err := rows.Err(); err != nil {
-		r.logger.Errorf("Error %s in retriving", err)
+	if err = rows.Err(); err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in retriving")
 		return nil, err
 	}
+	rows.Close()
+
+	// the write lock is held since the transaction began, no other draw can
+	// take these cards in between
+	if len(cardIds) == 0 || len(cardIds) < count {
+		return nil, fmt.Errorf("%w: %d left", ErrNotEnoughCards, len(cardIds))
+	}
 
 	// update drawn status for cards
 	updateQuery := `
@@ -282,14 +396,323 @@ func (r *Repository) DrawCard(deckId string, count int) (*dtos.RespDrawDeck, err
 	for i, id := range cardIds {
 		args[i] = id
 	}
-	_, err = db.Exec(updateQuery, args...)
+	_, err = tx.ExecContext(ctx, updateQuery, args...)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in marking cards drawn")
+		return nil, err
+	}
+
+	// keep the remaining counter of the deck in sync
+	remainingQuery := `
+        UPDATE decks SET remaining = (
+            SELECT count(*) FROM cards WHERE deck_id = decks.id AND drawn = 0
+        ), version = version + 1
+        WHERE id = ? AND tenant_id = ?
+        RETURNING remaining, version;
+    `
+	var remaining int
+	err = tx.QueryRowContext(ctx, remainingQuery, deckId, tenantId).Scan(&remaining, &current)
 	if err != nil {
-		r.logger.Errorf("Error %s in updating %s with params %s", err, updateQuery, args)
+		r.logger.WithContext(ctx).WithError(err).Error("Error in updating remaining cards")
 		return nil, err
 	}
 
-	deck := &dtos.RespDrawDeck{
-		Cards: cards,
+	event = &models.DeckEvent{
+		Type:      models.CardsDrawn,
+		DeckID:    deckId,
+		Remaining: remaining,
+		Cards:     cards,
+		TenantID:  tenantId,
+		Version:   current,
+	}
+	err = appendEvent(ctx, tx, event)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in recording draw")
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// delete a deck with its cards and metadata, returning the event recording it.
+// The history of the deck is kept. The event is nil when the deck isn't at the
+// given version, zero deletes any version.
+func (r *Repository) DeleteDeck(ctx context.Context, tenantId string, deckId string, version int) (event *models.DeckEvent, err error) {
+	ctx, done := startQuery(ctx, "delete_deck")
+	defer done()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in begin database transaction")
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).Error("Error in roleback transaction")
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	event = &models.DeckEvent{Type: models.DeckDeleted, DeckID: deckId, TenantID: tenantId}
+	err = tx.QueryRowContext(ctx, `SELECT remaining, version FROM decks WHERE id = ? AND tenant_id = ?`, deckId, tenantId).Scan(&event.Remaining, &event.Version)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in loading remaining cards")
+		return nil, err
+	}
+	if version != 0 && event.Version != version {
+		return nil, nil
+	}
+
+	// foreign keys aren't enforced by sqlite unless enabled, delete children explicitly
+	deleteStmt := `
+        DELETE FROM cards WHERE deck_id = ?;
+        DELETE FROM deck_metadata WHERE deck_id = ?;
+        DELETE FROM decks WHERE id = ?;
+    `
+	_, err = tx.ExecContext(ctx, deleteStmt, deckId, deckId, deckId)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in deleting deck")
+		return nil, err
 	}
-	return deck, nil
+
+	err = appendEvent(ctx, tx, event)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in recording deletion of deck")
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// list decks of a tenant matching the filter, ordered by creation time and id
+func (r *Repository) ListDecks(ctx context.Context, tenantId string, filter models.DeckFilter, after *models.DeckCursor, limit int) ([]dtos.RespDeckSummary, error) {
+	ctx, done := startQuery(ctx, "list_decks")
+	defer done()
+
+	conditions := []string{"tenant_id = ?"}
+	args := []interface{}{tenantId}
+	if filter.Shuffled != nil {
+		conditions = append(conditions, "shuffled = ?")
+		args = append(args, *filter.Shuffled)
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, formatTimestamp(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, formatTimestamp(*filter.CreatedBefore))
+	}
+	if filter.MinRemaining != nil {
+		conditions = append(conditions, "remaining >= ?")
+		args = append(args, *filter.MinRemaining)
+	}
+	if filter.MaxRemaining != nil {
+		conditions = append(conditions, "remaining <= ?")
+		args = append(args, *filter.MaxRemaining)
+	}
+	for key, value := range filter.Metadata {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM deck_metadata m WHERE m.deck_id = decks.id AND m.key = ? AND m.value = ?)")
+		args = append(args, key, value)
+	}
+	if after != nil {
+		createdAt := formatTimestamp(after.CreatedAt)
+		conditions = append(conditions, "(created_at > ? OR (created_at = ? AND id > ?))")
+		args = append(args, createdAt, createdAt, after.DeckID)
+	}
+
+	decksQuery := `
+        SELECT id, shuffled, remaining, created_at
+        FROM decks
+    `
+	decksQuery += " WHERE " + strings.Join(conditions, " AND ")
+	decksQuery += " ORDER BY created_at, id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, decksQuery, args...)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in listing decks")
+		return nil, err
+	}
+	defer rows.Close()
+
+	decks := []dtos.RespDeckSummary{}
+	for rows.Next() {
+		var deck dtos.RespDeckSummary
+		err := rows.Scan(&deck.DeckID, &deck.Shuffled, &deck.Remaining, &deck.CreatedAt)
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).Error("Error in scanning deck summary")
+			return nil, err
+		}
+		decks = append(decks, deck)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in retriving")
+		return nil, err
+	}
+
+	deckIds := make([]string, len(decks))
+	for i, deck := range decks {
+		deckIds[i] = deck.DeckID
+	}
+	metadata, err := loadMetadata(ctx, r.db, deckIds)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in loading metadata of decks")
+		return nil, err
+	}
+	for i := range decks {
+		decks[i].Metadata = metadata[decks[i].DeckID]
+	}
+
+	return decks, nil
+}
+
+// update metadata of a deck, keys with a nil value are removed. Returns the
+// event recording the metadata the deck ends up with, nil when the deck isn't
+// at the given version. Zero updates any version.
+func (r *Repository) UpdateDeckMetadata(ctx context.Context, tenantId string, deckId string, metadata map[string]*string, version int) (event *models.DeckEvent, err error) {
+	ctx, done := startQuery(ctx, "update_deck_metadata")
+	defer done()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in begin database transaction")
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).Error("Error in roleback transaction")
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	event = &models.DeckEvent{Type: models.DeckUpdated, DeckID: deckId, TenantID: tenantId}
+	err = tx.QueryRowContext(ctx, `SELECT remaining, version FROM decks WHERE id = ? AND tenant_id = ?`, deckId, tenantId).Scan(&event.Remaining, &event.Version)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in loading remaining cards")
+		return nil, err
+	}
+	if version != 0 && event.Version != version {
+		return nil, nil
+	}
+
+	upsertStmt := `
+        INSERT INTO deck_metadata(deck_id, key, value) VALUES(?, ?, ?)
+        ON CONFLICT(deck_id, key) DO UPDATE SET value = excluded.value;
+    `
+	deleteStmt := `
+        DELETE FROM deck_metadata WHERE deck_id = ? AND key = ?;
+    `
+	for key, value := range metadata {
+		if value == nil {
+			_, err = tx.ExecContext(ctx, deleteStmt, deckId, key)
+		} else {
+			_, err = tx.ExecContext(ctx, upsertStmt, deckId, key, *value)
+		}
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).WithField("key", key).Error("Error in updating deck metadata")
+			return nil, err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, `UPDATE decks SET version = version + 1 WHERE id = ? RETURNING version`, deckId).Scan(&event.Version)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in raising deck version")
+		return nil, err
+	}
+
+	merged, err := loadMetadata(ctx, tx, []string{deckId})
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in loading deck metadata")
+		return nil, err
+	}
+	event.Metadata = merged[deckId]
+
+	err = appendEvent(ctx, tx, event)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in recording update of deck")
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// the version of a deck of the tenant
+func deckVersion(ctx context.Context, tx *sql.Tx, tenantId string, deckId string) (int, error) {
+	var version int
+	err := tx.QueryRowContext(ctx, `SELECT version FROM decks WHERE id = ? AND tenant_id = ?`, deckId, tenantId).Scan(&version)
+	return version, err
+}
+
+func insertMetadata(ctx context.Context, tx *sql.Tx, deckId string, metadata map[string]string) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	metadataStmt := `
+        INSERT INTO deck_metadata(deck_id, key, value) VALUES
+    `
+	args := make([]interface{}, 0, len(metadata)*3)
+	placeholders := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		placeholders = append(placeholders, "(?, ?, ?)")
+		args = append(args, deckId, key, value)
+	}
+	metadataStmt += strings.Join(placeholders, ", ")
+	_, err := tx.ExecContext(ctx, metadataStmt, args...)
+	return err
+}
+
+// runs queries on a database or within a transaction
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// load metadata of the given decks, keyed by deck id
+func loadMetadata(ctx context.Context, db queryer, deckIds []string) (map[string]map[string]string, error) {
+	metadata := make(map[string]map[string]string)
+	if len(deckIds) == 0 {
+		return metadata, nil
+	}
+
+	metadataQuery := `
+        SELECT deck_id, key, value
+        FROM deck_metadata
+        WHERE deck_id IN (?` + strings.Repeat(",?", len(deckIds)-1) + `)
+    `
+	args := make([]interface{}, len(deckIds))
+	for i, id := range deckIds {
+		args[i] = id
+	}
+	rows, err := db.QueryContext(ctx, metadataQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deckId, key, value string
+		err := rows.Scan(&deckId, &key, &value)
+		if err != nil {
+			return nil, err
+		}
+		if metadata[deckId] == nil {
+			metadata[deckId] = make(map[string]string)
+		}
+		metadata[deckId][key] = value
+	}
+
+	return metadata, rows.Err()
+}
+
+// format time in UTC to the nanosecond, with a fixed width so timestamps
+// compare as text in the order they happened. Decks are listed and paged by
+// the time they were created, so it isn't truncated to the second
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.000000000")
 }
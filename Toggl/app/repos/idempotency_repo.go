@@ -0,0 +1,113 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"toggl/app/models"
+)
+
+// Reserve an idempotency key for a request until its ExpiresAt. Returns nil
+// when the key is new, or was only used by a request that expired, and the
+// record of the earlier request otherwise.
+func (r *Repository) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (existing *models.IdempotencyRecord, err error) {
+	ctx, done := startQuery(ctx, "reserve_idempotency_key")
+	defer done()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in begin database transaction")
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).Error("Error in roleback transaction")
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	// forget every request past its window
+	now := formatTimestamp(time.Now())
+	_, err = tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?;`, now)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in deleting expired idempotency keys")
+		return nil, err
+	}
+
+	reserveStmt := `
+        INSERT INTO idempotency_keys(scope, key, fingerprint, created_at, expires_at) VALUES(?, ?, ?, ?, ?)
+        ON CONFLICT(scope, key) DO NOTHING;
+    `
+	result, err := tx.ExecContext(ctx, reserveStmt, record.Scope, record.Key, record.Fingerprint, now, formatTimestamp(record.ExpiresAt))
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField("idempotency_key", record.Key).Error("Error in reserving idempotency key")
+		return nil, err
+	}
+	reserved, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if reserved > 0 {
+		return nil, nil
+	}
+
+	existingQuery := `
+        SELECT fingerprint, status, headers, body, created_at, expires_at
+        FROM idempotency_keys
+        WHERE scope = ? AND key = ?
+    `
+	var headers string
+	existing = &models.IdempotencyRecord{Scope: record.Scope, Key: record.Key}
+	err = tx.QueryRowContext(ctx, existingQuery, record.Scope, record.Key).Scan(&existing.Fingerprint, &existing.Status,
+		&headers, &existing.Body, &existing.CreatedAt, &existing.ExpiresAt)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField("idempotency_key", record.Key).Error("Error in loading idempotency key")
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(headers), &existing.Header)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField("idempotency_key", record.Key).Error("Error in decoding idempotent response headers")
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// Store the response to the request holding an idempotency key, kept until
+// the new ExpiresAt of the record
+func (r *Repository) CompleteIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) error {
+	ctx, done := startQuery(ctx, "complete_idempotency_key")
+	defer done()
+
+	headers, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	completeStmt := `
+        UPDATE idempotency_keys SET status = ?, headers = ?, body = ?, expires_at = ? WHERE scope = ? AND key = ?;
+    `
+	_, err = r.db.ExecContext(ctx, completeStmt, record.Status, string(headers), record.Body, formatTimestamp(record.ExpiresAt), record.Scope, record.Key)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField("idempotency_key", record.Key).Error("Error in storing idempotent response")
+		return err
+	}
+
+	return nil
+}
+
+// Release an idempotency key, so a retry is handled as a new request
+func (r *Repository) ReleaseIdempotencyKey(ctx context.Context, scope string, key string) error {
+	ctx, done := startQuery(ctx, "release_idempotency_key")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE scope = ? AND key = ?;`, scope, key)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField("idempotency_key", key).Error("Error in releasing idempotency key")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Schema migrations, applied in order. The index of the last applied
+// migration is tracked in sqlite's user_version pragma, so a migration must
+// never be edited once released - append a new one instead.
+var migrations = []string{
+	// 1: initial schema
+	`create table if not exists decks (
+		id text not null primary key,
+		shuffled boolean,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	  );
+
+	  create table if not exists cards (
+		id text not null primary key,
+		value text,
+		suit text,
+		deck_id text not null,
+		drawn int not null DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		foreign key(deck_id) references decks(id) on delete cascade
+	  );`,
+
+	// 2: remaining counter and indexes for listing decks
+	`alter table decks add column remaining int not null DEFAULT 0;
+
+	  update decks set remaining = (
+		select count(*) from cards where cards.deck_id = decks.id and cards.drawn = 0
+	  );
+
+	  create index if not exists idx_decks_created_at on decks(created_at, id);
+	  create index if not exists idx_decks_shuffled on decks(shuffled, created_at, id);
+	  create index if not exists idx_decks_remaining on decks(remaining, created_at, id);
+	  create index if not exists idx_cards_deck_drawn on cards(deck_id, drawn, created_at);`,
+
+	// 3: key/value metadata of decks
+	`create table if not exists deck_metadata (
+		deck_id text not null,
+		key text not null,
+		value text not null,
+		primary key(deck_id, key),
+		foreign key(deck_id) references decks(id) on delete cascade
+	  );
+
+	  create index if not exists idx_deck_metadata_key_value on deck_metadata(key, value);`,
+
+	// 4: append-only history of deck changes, kept when a deck is deleted
+	`create table if not exists deck_events (
+		deck_id text not null,
+		seq int not null,
+		type text not null,
+		remaining int not null,
+		payload text not null,
+		created_at DATETIME not null,
+		primary key(deck_id, seq)
+	  );`,
+
+	// 5: webhook subscriptions and their deliveries
+	`create table if not exists webhooks (
+		id text not null primary key,
+		url text not null,
+		secret text not null,
+		events text not null,
+		created_at DATETIME not null
+	  );
+
+	  create table if not exists webhook_deliveries (
+		id text not null primary key,
+		webhook_id text not null,
+		event_type text not null,
+		deck_id text not null,
+		payload text not null,
+		status text not null,
+		attempts int not null DEFAULT 0,
+		last_status_code int not null DEFAULT 0,
+		last_error text not null DEFAULT '',
+		next_attempt_at DATETIME not null,
+		created_at DATETIME not null,
+		delivered_at DATETIME,
+		foreign key(webhook_id) references webhooks(id) on delete cascade
+	  );
+
+	  create index if not exists idx_webhook_deliveries_due on webhook_deliveries(status, next_attempt_at);
+	  create index if not exists idx_webhook_deliveries_webhook on webhook_deliveries(webhook_id, created_at);`,
+
+	// 6: API keys, and the tenant owning decks, their history and webhooks.
+	// Existing rows belong to the anonymous tenant.
+	`create table if not exists api_keys (
+		id text not null primary key,
+		tenant_id text not null,
+		name text not null,
+		key_hash text not null unique,
+		created_at DATETIME not null,
+		revoked_at DATETIME
+	  );
+
+	  alter table decks add column tenant_id text not null DEFAULT '';
+	  alter table deck_events add column tenant_id text not null DEFAULT '';
+	  alter table webhooks add column tenant_id text not null DEFAULT '';
+
+	  create index if not exists idx_decks_tenant on decks(tenant_id, created_at, id);
+	  create index if not exists idx_webhooks_tenant on webhooks(tenant_id);`,
+
+	// 7: tenants with their own limits, null limits use the configured defaults.
+	// Tenants already owning keys, decks or webhooks are registered.
+	`create table if not exists tenants (
+		id text not null primary key,
+		max_decks integer,
+		max_cards_per_deck integer,
+		created_at DATETIME not null DEFAULT CURRENT_TIMESTAMP
+	  );
+
+	  insert or ignore into tenants(id)
+	    select tenant_id from api_keys
+	    union select tenant_id from decks
+	    union select tenant_id from webhooks;`,
+
+	// 8: responses to requests sent with an Idempotency-Key, replayed on retries
+	`create table if not exists idempotency_keys (
+		scope text not null,
+		key text not null,
+		fingerprint text not null,
+		status integer not null DEFAULT 0,
+		content_type text not null DEFAULT '',
+		body blob,
+		created_at DATETIME not null,
+		expires_at DATETIME not null,
+		primary key (scope, key)
+	  );
+
+	  create index if not exists idx_idempotency_keys_expires on idempotency_keys(expires_at);`,
+
+	// 9: version of a deck, raised by every change to it
+	`alter table decks add column version integer not null DEFAULT 1;`,
+
+	// 10: every header of an idempotent response, not only its content type
+	`alter table idempotency_keys add column headers text not null DEFAULT '{}';
+
+	  update idempotency_keys set headers = json_object('Content-Type', json_array(content_type))
+	  where content_type != '';`,
+}
+
+// Apply all migrations newer than the database schema version
+func migrate(db *sql.DB) error {
+	var version int
+	err := db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(migrations[i])
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		// pragmas don't accept bound parameters
+		_, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Check the database can be reached and every migration has been applied
+func (r *Repository) CheckSchema(ctx context.Context) error {
+	ctx, done := startQuery(ctx, "check_schema")
+	defer done()
+
+	var version int
+	err := r.db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version < len(migrations) {
+		return fmt.Errorf("schema at migration %d of %d", version, len(migrations))
+	}
+
+	return nil
+}
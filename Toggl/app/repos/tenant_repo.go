@@ -0,0 +1,132 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"toggl/app/logging"
+	"toggl/app/models"
+)
+
+// runs statements on a database or within a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// register a tenant the first time it is used
+func ensureTenant(ctx context.Context, db execer, tenantId string) error {
+	_, err := db.ExecContext(ctx, `INSERT OR IGNORE INTO tenants(id) VALUES(?);`, tenantId)
+	return err
+}
+
+// Limits of a tenant, the configured defaults where it has none of its own.
+// A limit of zero or less means unlimited.
+func (r *Repository) TenantLimits(ctx context.Context, tenantId string) (*models.TenantLimits, error) {
+	ctx, done := startQuery(ctx, "tenant_limits")
+	defer done()
+
+	limitsQuery := `
+        SELECT max_decks, max_cards_per_deck FROM tenants WHERE id = ?
+    `
+	var maxDecks, maxCards sql.NullInt64
+	err := r.db.QueryRowContext(ctx, limitsQuery, tenantId).Scan(&maxDecks, &maxCards)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		r.logger.WithContext(ctx).WithError(err).WithField(logging.TenantID, tenantId).Error("Error in loading tenant limits")
+		return nil, err
+	}
+
+	return r.resolveLimits(maxDecks, maxCards), nil
+}
+
+// Set the limits of a tenant, registering it if needed. Nil limits fall back
+// to the configured defaults.
+func (r *Repository) SetTenantLimits(ctx context.Context, tenantId string, maxDecks *int, maxCardsPerDeck *int) error {
+	ctx, done := startQuery(ctx, "set_tenant_limits")
+	defer done()
+
+	limitsStmt := `
+        INSERT INTO tenants(id, max_decks, max_cards_per_deck) VALUES(?, ?, ?)
+        ON CONFLICT(id) DO UPDATE SET max_decks = excluded.max_decks, max_cards_per_deck = excluded.max_cards_per_deck;
+    `
+	_, err := r.db.ExecContext(ctx, limitsStmt, tenantId, maxDecks, maxCardsPerDeck)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField(logging.TenantID, tenantId).Error("Error in setting tenant limits")
+		return err
+	}
+
+	return nil
+}
+
+// Usage of every registered tenant, ordered by id
+func (r *Repository) ListTenantUsage(ctx context.Context) ([]models.TenantUsage, error) {
+	ctx, done := startQuery(ctx, "list_tenant_usage")
+	defer done()
+	return r.tenantUsage(ctx, "")
+}
+
+// Usage of a single tenant, nil when it isn't registered
+func (r *Repository) TenantUsage(ctx context.Context, tenantId string) (*models.TenantUsage, error) {
+	ctx, done := startQuery(ctx, "tenant_usage")
+	defer done()
+
+	usage, err := r.tenantUsage(ctx, "WHERE t.id = ?", tenantId)
+	if err != nil || len(usage) == 0 {
+		return nil, err
+	}
+	return &usage[0], nil
+}
+
+func (r *Repository) tenantUsage(ctx context.Context, where string, args ...interface{}) ([]models.TenantUsage, error) {
+
+	usageQuery := `
+        SELECT t.id, t.max_decks, t.max_cards_per_deck, t.created_at,
+            (SELECT count(*) FROM decks WHERE decks.tenant_id = t.id AND ` + limitedDeck + `),
+            (SELECT coalesce(sum(d.remaining), 0) FROM decks d WHERE d.tenant_id = t.id),
+            (SELECT count(*) FROM api_keys k WHERE k.tenant_id = t.id AND k.revoked_at IS NULL),
+            (SELECT count(*) FROM webhooks w WHERE w.tenant_id = t.id)
+        FROM tenants t
+    ` + where + `
+        ORDER BY t.id
+    `
+	rows, err := r.db.QueryContext(ctx, usageQuery, args...)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in querying tenant usage")
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []models.TenantUsage{}
+	for rows.Next() {
+		var tenant models.TenantUsage
+		var maxDecks, maxCards sql.NullInt64
+		err := rows.Scan(&tenant.TenantID, &maxDecks, &maxCards, &tenant.CreatedAt,
+			&tenant.Decks, &tenant.Cards, &tenant.APIKeys, &tenant.Webhooks)
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).Error("Error in scanning tenant usage")
+			return nil, err
+		}
+		tenant.Limits = *r.resolveLimits(maxDecks, maxCards)
+		tenant.CreatedAt = tenant.CreatedAt.UTC()
+		usage = append(usage, tenant)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in retriving")
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// fill limits a tenant doesn't set with the configured defaults
+func (r *Repository) resolveLimits(maxDecks sql.NullInt64, maxCards sql.NullInt64) *models.TenantLimits {
+	conf := r.config.Current()
+	limits := &models.TenantLimits{MaxDecks: conf.MaxDecksPerTenant, MaxCardsPerDeck: conf.MaxCardsPerDeck}
+	if maxDecks.Valid {
+		limits.MaxDecks = int(maxDecks.Int64)
+	}
+	if maxCards.Valid {
+		limits.MaxCardsPerDeck = int(maxCards.Int64)
+	}
+	return limits
+}
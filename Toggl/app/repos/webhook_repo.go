@@ -0,0 +1,287 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+	"toggl/app/logging"
+	"toggl/app/models"
+	"toggl/app/utils"
+)
+
+// Store a new webhook
+func (r *Repository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	ctx, done := startQuery(ctx, "create_webhook")
+	defer done()
+
+	err := ensureTenant(ctx, r.db, webhook.TenantID)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField(logging.TenantID, webhook.TenantID).Error("Error in registering tenant")
+		return err
+	}
+
+	webhook.ID = utils.Generate_uuid()
+	webhook.CreatedAt = time.Now().UTC()
+
+	webhookStmt := `
+        INSERT INTO webhooks(id, tenant_id, url, secret, events, created_at) VALUES(?, ?, ?, ?, ?, ?);
+    `
+	_, err = r.db.ExecContext(ctx, webhookStmt, webhook.ID, webhook.TenantID, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.CreatedAt)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in inserting webhook")
+		return err
+	}
+
+	return nil
+}
+
+// List webhooks of a tenant, oldest first
+func (r *Repository) ListWebhooks(ctx context.Context, tenantId string) ([]models.Webhook, error) {
+	ctx, done := startQuery(ctx, "list_webhooks")
+	defer done()
+
+	webhooksQuery := `
+        SELECT id, url, secret, events, created_at
+        FROM webhooks
+        WHERE tenant_id = ?
+        ORDER BY created_at, id
+    `
+	rows, err := r.db.QueryContext(ctx, webhooksQuery, tenantId)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in listing webhooks")
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook := models.Webhook{TenantID: tenantId}
+		var events string
+		err := rows.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &events, &webhook.CreatedAt)
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).Error("Error in scanning webhook")
+			return nil, err
+		}
+		webhook.Events = strings.Split(events, ",")
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in retriving")
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Delete a webhook of a tenant with its deliveries, false when it doesn't exist
+func (r *Repository) DeleteWebhook(ctx context.Context, tenantId string, webhookId string) (bool, error) {
+	ctx, done := startQuery(ctx, "delete_webhook")
+	defer done()
+
+	deleteStmt := `
+        DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE id = ? AND tenant_id = ?);
+        DELETE FROM webhooks WHERE id = ? AND tenant_id = ?;
+    `
+	result, err := r.db.ExecContext(ctx, deleteStmt, webhookId, tenantId, webhookId, tenantId)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField("webhook_id", webhookId).Error("Error in deleting webhook")
+		return false, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+// Check if a webhook exists and is owned by the tenant
+func (r *Repository) CheckWebhookExist(ctx context.Context, tenantId string, webhookId string) (bool, error) {
+	ctx, done := startQuery(ctx, "check_webhook_exist")
+	defer done()
+
+	var exist bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM webhooks WHERE id = ? AND tenant_id = ?)`, webhookId, tenantId).Scan(&exist)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField("webhook_id", webhookId).Error("Error in checking webhook exists")
+		return false, err
+	}
+
+	return exist, nil
+}
+
+// body of a delivery request
+type webhookPayload struct {
+	Type       string            `json:"type"`
+	DeckID     string            `json:"deck_id"`
+	Remaining  int               `json:"remaining"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	OccurredAt time.Time         `json:"occurred_at"`
+}
+
+// queue a delivery of a deck event to every webhook of its tenant subscribed
+// to it, in the transaction of the change. The dispatcher sends them.
+func enqueueDeliveries(ctx context.Context, tx *sql.Tx, event *models.DeckEvent) error {
+	eventType := models.WebhookEvent(*event)
+	if eventType == "" {
+		return nil
+	}
+
+	webhookIds, err := subscribedWebhooks(ctx, tx, event.TenantID, eventType)
+	if err != nil || len(webhookIds) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(webhookPayload{
+		Type:       eventType,
+		DeckID:     event.DeckID,
+		Remaining:  event.Remaining,
+		Metadata:   event.Metadata,
+		OccurredAt: event.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	deliveryStmt := `
+        INSERT INTO webhook_deliveries(id, webhook_id, event_type, deck_id, payload, status, next_attempt_at, created_at) VALUES
+    `
+	now := time.Now().UTC()
+	args := make([]interface{}, 0, len(webhookIds)*8)
+	placeholders := make([]string, 0, len(webhookIds))
+	for _, webhookId := range webhookIds {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, utils.Generate_uuid(), webhookId, eventType, event.DeckID, string(payload), models.DeliveryPending, now, now)
+	}
+	deliveryStmt += strings.Join(placeholders, ", ")
+	_, err = tx.ExecContext(ctx, deliveryStmt, args...)
+	return err
+}
+
+// ids of the webhooks of a tenant subscribed to an event type
+func subscribedWebhooks(ctx context.Context, db queryer, tenantId string, eventType string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id FROM webhooks WHERE tenant_id = ? AND ',' || events || ',' LIKE '%,' || ? || ',%'`, tenantId, eventType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Pending deliveries due at the given time, oldest first, with their target
+func (r *Repository) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	ctx, done := startQuery(ctx, "due_deliveries")
+	defer done()
+
+	deliveriesQuery := `
+        SELECT d.id, d.webhook_id, d.event_type, d.deck_id, d.payload, d.status, d.attempts,
+            d.last_status_code, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at, w.url, w.secret
+        FROM webhook_deliveries d
+        JOIN webhooks w ON w.id = d.webhook_id
+        WHERE d.status = ? AND d.next_attempt_at <= ?
+        ORDER BY d.next_attempt_at, d.id
+        LIMIT ?
+    `
+	rows, err := r.db.QueryContext(ctx, deliveriesQuery, models.DeliveryPending, now.UTC(), limit)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in querying webhook deliveries")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var payload string
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &delivery.DeckID, &payload, &delivery.Status, &delivery.Attempts,
+			&delivery.LastStatusCode, &delivery.LastError, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.DeliveredAt, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).Error("Error in scanning delivery")
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in retriving")
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Store the outcome of a delivery attempt
+func (r *Repository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	ctx, done := startQuery(ctx, "update_delivery")
+	defer done()
+
+	updateStmt := `
+        UPDATE webhook_deliveries
+        SET status = ?, attempts = ?, last_status_code = ?, last_error = ?, next_attempt_at = ?, delivered_at = ?
+        WHERE id = ?;
+    `
+	_, err := r.db.ExecContext(ctx, updateStmt, delivery.Status, delivery.Attempts, delivery.LastStatusCode, delivery.LastError,
+		delivery.NextAttemptAt.UTC(), delivery.DeliveredAt, delivery.ID)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).WithField("delivery_id", delivery.ID).Error("Error in updating webhook delivery")
+		return err
+	}
+
+	return nil
+}
+
+// Deliveries of a webhook, newest first
+func (r *Repository) ListDeliveries(ctx context.Context, webhookId string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, done := startQuery(ctx, "list_deliveries")
+	defer done()
+
+	deliveriesQuery := `
+        SELECT id, webhook_id, event_type, deck_id, payload, status, attempts,
+            last_status_code, last_error, next_attempt_at, created_at, delivered_at
+        FROM webhook_deliveries
+        WHERE webhook_id = ?
+        ORDER BY created_at DESC, id
+        LIMIT ?
+    `
+	rows, err := r.db.QueryContext(ctx, deliveriesQuery, webhookId, limit)
+	if err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in querying webhook deliveries")
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var payload string
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &delivery.DeckID, &payload, &delivery.Status, &delivery.Attempts,
+			&delivery.LastStatusCode, &delivery.LastError, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.DeliveredAt)
+		if err != nil {
+			r.logger.WithContext(ctx).WithError(err).Error("Error in scanning delivery")
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithContext(ctx).WithError(err).Error("Error in retriving")
+		return nil, err
+	}
+
+	return deliveries, nil
+}
@@ -1,14 +1,129 @@
 package app
 
 import (
+	"net/http"
+	"time"
+	"toggl/app/auth"
+	"toggl/app/config"
 	"toggl/app/handlers"
+	"toggl/app/metrics"
+	"toggl/app/middleware"
+	"toggl/app/openapi"
+	"toggl/app/ratelimit"
 
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 )
 
-func RegisterRoutes(mux *mux.Router, deckHandler *handlers.DeckHandlerImpl) {
+func RegisterRoutes(mux *mux.Router, deckHandler *handlers.DeckHandlerImpl, webhookHandler *handlers.WebhookHandlerImpl, authHandler *handlers.AuthHandlerImpl, tenantHandler *handlers.TenantHandlerImpl, healthHandler *handlers.HealthHandlerImpl, authenticator auth.Authenticator, limiter ratelimit.Store, idempotencyStore middleware.IdempotencyStore, logger *logrus.Logger, source config.Source) {
+	conf := source.Current()
+
+	useMiddleware(mux, logger)
+
+	// Metrics and probes move to the admin port when there is one
+	if conf.AdminPort == 0 {
+		RegisterOpsRoutes(mux, healthHandler, conf)
+	}
+
+	// The OpenAPI document of the routes below and a page rendering it
+	mux.Handle("/openapi.json", openapi.Handler()).Methods("GET")
+	mux.Handle("/docs", openapi.DocsHandler()).Methods("GET")
+
+	// Admin routes take the admin key instead of an API key
+	admin := mux.PathPrefix("/v1/admin").Subrouter()
+	admin.Use(middleware.AdminKey(conf.AdminKey))
+	admin.Use(idempotency(idempotencyStore, conf, "admin", logger))
+	admin.HandleFunc("/api-keys", authHandler.CreateAPIKeyHandler).Methods("POST")
+	admin.HandleFunc("/api-keys/{key_id}", authHandler.RevokeAPIKeyHandler).Methods("DELETE")
+	admin.HandleFunc("/tenants", tenantHandler.ListTenantsHandler).Methods("GET")
+	admin.HandleFunc("/tenants/{tenant_id}", tenantHandler.TenantUsageHandler).Methods("GET")
+	admin.HandleFunc("/tenants/{tenant_id}", tenantHandler.UpdateTenantHandler).Methods("PUT")
+
+	// Event streams stay open, so they are registered before the timeout applies
+	apiKey := middleware.APIKey(authenticator, conf.RequireAPIKey)
+	mux.Handle("/v1/decks/{deck_id}/events", apiKey(http.HandlerFunc(deckHandler.DeckEventsHandler))).Methods("GET")
+
+	api := mux.PathPrefix("/v1").Subrouter()
+	api.Use(apiKey)
+	if conf.Timeout > 0 {
+		api.Use(middleware.Timeout(time.Duration(conf.Timeout) * time.Second))
+	}
+	// Within the timeout, so a request that timed out still keeps its response for a retry
+	api.Use(idempotency(idempotencyStore, conf, "api", logger))
+
+	// Creating and drawing are limited per client, draws also per deck. The
+	// limits are read for every request, so reloading them applies right away.
+	createLimit := middleware.RateLimit(limiter, rateLimit(func() config.RateLimit { return source.Current().CreateRateLimit }), middleware.ClientKey("create"), logger)
+	drawLimit := middleware.RateLimit(limiter, rateLimit(func() config.RateLimit { return source.Current().DrawRateLimit }), middleware.ClientKey("draw"), logger)
+	deckDrawLimit := middleware.RateLimit(limiter, rateLimit(func() config.RateLimit { return source.Current().DeckDrawRateLimit }), middleware.DrawDeckKey, logger)
+
 	// Register the handlers with the HTTP server
-	mux.HandleFunc("/v1/create-deck", deckHandler.CreateNewDeckHandler).Methods("POST")
-	mux.HandleFunc("/v1/open-deck", deckHandler.OpenDeckHandler).Methods("GET")
-	mux.HandleFunc("/v1/draw-cards", deckHandler.DrawCardHandler).Methods("POST")
+	api.Handle("/create-deck", createLimit(http.HandlerFunc(deckHandler.CreateNewDeckHandler))).Methods("POST")
+	api.HandleFunc("/open-deck", deckHandler.OpenDeckHandler).Methods("GET")
+	api.Handle("/draw-cards", drawLimit(deckDrawLimit(http.HandlerFunc(deckHandler.DrawCardHandler)))).Methods("POST")
+	api.HandleFunc("/decks", deckHandler.ListDecksHandler).Methods("GET")
+	api.HandleFunc("/decks/{deck_id}", deckHandler.UpdateDeckHandler).Methods("PATCH")
+	api.HandleFunc("/decks/{deck_id}", deckHandler.DeleteDeckHandler).Methods("DELETE")
+	api.HandleFunc("/decks/{deck_id}/history", deckHandler.DeckHistoryHandler).Methods("GET")
+	api.HandleFunc("/decks/{deck_id}/history/{seq}", deckHandler.DeckStateHandler).Methods("GET")
+	api.HandleFunc("/webhooks", webhookHandler.CreateWebhookHandler).Methods("POST")
+	api.HandleFunc("/webhooks", webhookHandler.ListWebhooksHandler).Methods("GET")
+	api.HandleFunc("/webhooks/{webhook_id}", webhookHandler.DeleteWebhookHandler).Methods("DELETE")
+	api.HandleFunc("/webhooks/{webhook_id}/deliveries", webhookHandler.ListWebhookDeliveriesHandler).Methods("GET")
+}
+
+// Register metrics, probes and build metadata, which take no key, on the API
+// router or the one of the admin port
+func RegisterOpsRoutes(mux *mux.Router, healthHandler *handlers.HealthHandlerImpl, conf *config.Config) {
+	// Prometheus scrapes metrics without a key, unless disabled with an empty path
+	if conf.MetricsPath != "" {
+		mux.Handle(conf.MetricsPath, metrics.Handler()).Methods("GET")
+	}
+
+	// Probes and build metadata, outside the versioned API and without a key
+	mux.HandleFunc("/healthz", healthHandler.HealthzHandler).Methods("GET")
+	mux.HandleFunc("/readyz", healthHandler.ReadyzHandler).Methods("GET")
+	mux.HandleFunc("/version", healthHandler.VersionHandler).Methods("GET")
+}
+
+// a router serving only metrics, probes and build metadata, for the admin port
+func newOpsRouter(healthHandler *handlers.HealthHandlerImpl, logger *logrus.Logger, conf *config.Config) *mux.Router {
+	router := mux.NewRouter()
+	useMiddleware(router, logger)
+	RegisterOpsRoutes(router, healthHandler, conf)
+	return router
+}
+
+// Middlewares run in the order they are added, for every matched route
+func useMiddleware(mux *mux.Router, logger *logrus.Logger) {
+	mux.Use(middleware.RequestID)
+	mux.Use(middleware.AccessLog(logger))
+	mux.Use(middleware.Metrics)
+	mux.Use(middleware.Tracing)
+	mux.Use(middleware.Recover(logger))
+}
+
+func rateLimit(limit func() config.RateLimit) ratelimit.LimitSource {
+	return ratelimit.LimitFunc(func() ratelimit.Limit {
+		current := limit()
+		return ratelimit.PerMinute(current.PerMinute, current.Burst)
+	})
+}
+
+// replay responses to retried requests, unless the window is zero
+func idempotency(store middleware.IdempotencyStore, config *config.Config, scope string, logger *logrus.Logger) mux.MiddlewareFunc {
+	if config.IdempotencyWindow <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return middleware.Idempotency(store, time.Duration(config.IdempotencyWindow)*time.Second, idempotencyLease(config), scope, logger)
+}
+
+// how long a request holds its idempotency key before it counts as abandoned.
+// No response can be written after WriteTimeout, without one a request has
+// a minute to answer.
+func idempotencyLease(config *config.Config) time.Duration {
+	if config.WriteTimeout > 0 {
+		return time.Duration(config.WriteTimeout) * time.Second
+	}
+	return time.Minute
 }
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"toggl/app/auth"
+	"toggl/app/dtos"
+	"toggl/app/models"
+	"toggl/app/repos"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrAPIKeyNotFound = errors.New("API key doesn't exist")
+
+type AuthService interface {
+	Authenticate(ctx context.Context, key string) (*auth.Principal, error)
+	CreateAPIKey(ctx context.Context, req dtos.ReqCreateAPIKey) (*dtos.RespAPIKey, error)
+	RevokeAPIKey(ctx context.Context, keyId string) error
+}
+
+type AuthServiceImpl struct {
+	logger *logrus.Logger
+	repo   *repos.Repository
+}
+
+// New Auth service setup using dependencies
+func NewAuthService(logger *logrus.Logger, repo *repos.Repository) *AuthServiceImpl {
+	return &AuthServiceImpl{logger: logger, repo: repo}
+}
+
+// Resolve an API key to the tenant it acts for
+func (s *AuthServiceImpl) Authenticate(ctx context.Context, key string) (*auth.Principal, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Authenticate")
+	defer span.End()
+
+	apiKey, err := s.repo.FindAPIKey(ctx, auth.HashKey(key))
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error in finding API key")
+		return nil, err
+	}
+	if apiKey == nil {
+		return nil, auth.ErrInvalidKey
+	}
+
+	return &auth.Principal{KeyID: apiKey.ID, TenantID: apiKey.TenantID}, nil
+}
+
+// Issue a new API key for a tenant. The key is only part of this response.
+func (s *AuthServiceImpl) CreateAPIKey(ctx context.Context, req dtos.ReqCreateAPIKey) (*dtos.RespAPIKey, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.CreateAPIKey")
+	defer span.End()
+
+	key, err := auth.GenerateKey()
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error generating API key")
+		return nil, err
+	}
+
+	apiKey := &models.APIKey{TenantID: req.TenantID, Name: req.Name, KeyHash: auth.HashKey(key)}
+	err = s.repo.CreateAPIKey(ctx, apiKey)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error in creating API key")
+		return nil, err
+	}
+
+	return &dtos.RespAPIKey{
+		ID:        apiKey.ID,
+		TenantID:  apiKey.TenantID,
+		Name:      apiKey.Name,
+		Key:       key,
+		CreatedAt: apiKey.CreatedAt,
+	}, nil
+}
+
+// Revoke an API key, requests with it are rejected from then on
+func (s *AuthServiceImpl) RevokeAPIKey(ctx context.Context, keyId string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.RevokeAPIKey")
+	defer span.End()
+
+	revoked, err := s.repo.RevokeAPIKey(ctx, keyId)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).WithField("key_id", keyId).Error("Error in revoking API key")
+		return err
+	}
+	if !revoked {
+		s.logger.WithContext(ctx).WithField("key_id", keyId).Error("API key does not exist")
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"toggl/app/dtos"
+	"toggl/app/logging"
+	"toggl/app/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The recorded events of a deck of the tenant, oldest first
+func (s *DeckServiceImpl) DeckHistory(ctx context.Context, tenantId string, deckId string) (*dtos.RespDeckHistory, error) {
+	ctx, span := tracer.Start(ctx, "DeckService.DeckHistory", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+		attribute.String("deck.id", deckId),
+	))
+	defer span.End()
+	ctx = logging.With(ctx, logging.DeckID, deckId)
+
+	history, err := s.loadHistory(ctx, tenantId, deckId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &dtos.RespDeckHistory{DeckID: deckId, Events: make([]dtos.RespDeckEvent, len(history))}
+	for i, event := range history {
+		resp.Events[i] = DeckEventResponse(event)
+	}
+
+	return resp, nil
+}
+
+// Rebuild a deck as it was right after the event with the given sequence number
+func (s *DeckServiceImpl) DeckStateAt(ctx context.Context, tenantId string, deckId string, seq int) (*dtos.RespOpenDeck, error) {
+	ctx, span := tracer.Start(ctx, "DeckService.DeckStateAt", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+		attribute.String("deck.id", deckId),
+	))
+	defer span.End()
+	ctx = logging.With(ctx, logging.DeckID, deckId)
+
+	history, err := s.loadHistory(ctx, tenantId, deckId)
+	if err != nil {
+		return nil, err
+	}
+	if seq < 1 || seq > len(history) {
+		s.logger.WithContext(ctx).WithField("seq", seq).Error("Deck event does not exist")
+		return nil, ErrEventNotFound
+	}
+
+	deck := replay(history[:seq])
+
+	resp := &dtos.RespOpenDeck{
+		DeckID:    deckId,
+		Shuffled:  deck.Shuffled,
+		Remaining: len(deck.Cards),
+		Cards:     []dtos.RespOpenDeckCard{},
+		Metadata:  deck.Metadata,
+	}
+	for _, card := range deck.Cards {
+		resp.Cards = append(resp.Cards, dtos.RespOpenDeckCard{Code: card.Code, Value: card.Value, Suit: card.Suit})
+	}
+
+	return resp, nil
+}
+
+// Convert an event into its response, the same shape as streamed events
+func DeckEventResponse(event models.DeckEvent) dtos.RespDeckEvent {
+	resp := dtos.RespDeckEvent{
+		Seq:       event.Seq,
+		Type:      event.Type,
+		DeckID:    event.DeckID,
+		Remaining: event.Remaining,
+		Shuffled:  event.Shuffled,
+		Metadata:  event.Metadata,
+		CreatedAt: event.CreatedAt,
+	}
+	for _, card := range event.Cards {
+		resp.Cards = append(resp.Cards, dtos.RespDrawCard{Code: card.Code, Value: card.Value, Suit: card.Suit})
+	}
+	return resp
+}
+
+// a deck without history was never created
+func (s *DeckServiceImpl) loadHistory(ctx context.Context, tenantId string, deckId string) ([]models.DeckEvent, error) {
+	history, err := s.repo.DeckHistory(ctx, tenantId, deckId)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error in loading deck history")
+		return nil, err
+	}
+	if len(history) == 0 {
+		s.logger.WithContext(ctx).Error("Deck does not exist")
+		return nil, ErrDeckNotFound
+	}
+	return history, nil
+}
+
+// apply events in order, starting from the cards the deck was created with
+func replay(history []models.DeckEvent) models.Deck {
+	var deck models.Deck
+	for _, event := range history {
+		switch event.Type {
+		case models.DeckCreated:
+			deck.Shuffled = event.Shuffled
+			deck.Cards = append([]models.Card(nil), event.Cards...)
+			deck.Metadata = event.Metadata
+		case models.CardsDrawn:
+			for _, drawn := range event.Cards {
+				deck.Cards = removeCard(deck.Cards, drawn.Code)
+			}
+		case models.DeckUpdated:
+			deck.Metadata = event.Metadata
+		}
+	}
+	deck.Remaining = len(deck.Cards)
+	return deck
+}
+
+// remove the first card with the given code, decks may hold duplicates
+func removeCard(cards []models.Card, code string) []models.Card {
+	for i, card := range cards {
+		if card.Code == code {
+			return append(cards[:i], cards[i+1:]...)
+		}
+	}
+	return cards
+}
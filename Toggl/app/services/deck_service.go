@@ -1,41 +1,78 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"math/big"
 	"strings"
+	"time"
 	"toggl/app/dtos"
+	"toggl/app/events"
+	"toggl/app/logging"
+	"toggl/app/metrics"
 	"toggl/app/models"
 	"toggl/app/repos"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // suits and values of cards type
 var suits = []string{"SPADES", "HEARTS", "DIAMONDS", "CLUBS"}
 var values = []string{"ACE", "2", "3", "4", "5", "6", "7", "8", "9", "10", "JACK", "QUEEN", "KING"}
 
+// page size limits for listing decks
+const DefaultListLimit = 20
+const MaxListLimit = 100
+
+// limits of the metadata attached to a deck
+const MaxMetadataKeys = 32
+const MaxMetadataKeyLength = 64
+const MaxMetadataValueLength = 256
+
+var tracer = otel.Tracer("toggl/app/services")
+
+var ErrDeckNotFound = errors.New("Id doesn't exist")
+var ErrInvalidCursor = errors.New("Invalid cursor")
+var ErrInvalidMetadata = errors.New("Invalid metadata")
+var ErrNotEnoughCards = errors.New("Requested count exceeds remaining cards in deck")
+var ErrEventNotFound = errors.New("Event doesn't exist")
+var ErrTooManyCards = errors.New("Number of cards exceeded")
+var ErrDeckLimitReached = errors.New("Deck limit of the tenant reached")
+var ErrVersionMismatch = errors.New("Deck was changed, its version doesn't match")
+
 type DeckService interface {
-	CreateNewDeck(shuffled bool, cards string) (*dtos.RespCreateDeck, error)
-	OpenDeck(deckId string) (*dtos.RespOpenDeck, error)
-	DrawCard(deckId string, count int) (*dtos.RespDrawDeck, error)
+	CreateNewDeck(ctx context.Context, tenantId string, shuffled bool, cards string, metadata map[string]string) (*dtos.RespCreateDeck, error)
+	OpenDeck(ctx context.Context, tenantId string, deckId string) (*dtos.RespOpenDeck, error)
+	DrawCard(ctx context.Context, tenantId string, deckId string, count int, version int) (*dtos.RespDrawDeck, error)
+	ListDecks(ctx context.Context, tenantId string, filter models.DeckFilter) (*dtos.RespListDecks, error)
+	UpdateDeck(ctx context.Context, tenantId string, deckId string, update dtos.ReqUpdateDeck, version int) (*dtos.RespOpenDeck, error)
+	DeleteDeck(ctx context.Context, tenantId string, deckId string, version int) error
+	SubscribeDeckEvents(ctx context.Context, tenantId string, deckId string) (*events.Subscription, error)
+	DeckHistory(ctx context.Context, tenantId string, deckId string) (*dtos.RespDeckHistory, error)
+	DeckStateAt(ctx context.Context, tenantId string, deckId string, seq int) (*dtos.RespOpenDeck, error)
 }
 
 type DeckServiceImpl struct {
 	logger *logrus.Logger
 	repo   *repos.Repository
+	broker *events.Broker
 }
 
 // New Deck service setup using dependencies
-func NewDeckService(logger *logrus.Logger, repo *repos.Repository) *DeckServiceImpl {
-	return &DeckServiceImpl{logger: logger, repo: repo}
+func NewDeckService(logger *logrus.Logger, repo *repos.Repository, broker *events.Broker) *DeckServiceImpl {
+	return &DeckServiceImpl{logger: logger, repo: repo, broker: broker}
 }
 
 // parse cards and validate for creating deck
-func parseCode(code string, logger *logrus.Logger) (*models.Card, error) {
+func parseCode(code string) (*models.Card, error) {
 	if len(code) != 2 {
-		logger.Error("Invalid card")
 		return nil, errors.New("Invalid card")
 	}
 
@@ -48,7 +85,6 @@ func parseCode(code string, logger *logrus.Logger) (*models.Card, error) {
 	}
 
 	if value == "" {
-		logger.Error("Invalid value")
 		return nil, errors.New("Invalid value")
 	}
 
@@ -61,13 +97,18 @@ func parseCode(code string, logger *logrus.Logger) (*models.Card, error) {
 	}
 
 	if suit == "" {
-		logger.Error("Invalid suit")
 		return nil, errors.New("Invalid suit")
 	}
 
 	return &models.Card{Value: value, Suit: suit, Code: code}, nil
 }
 
+// Validate a card code such as AS or 1H, the value followed by the suit
+func ValidateCardCode(code string) error {
+	_, err := parseCode(code)
+	return err
+}
+
 func contains(arr []string, str string) bool {
 	for _, a := range arr {
 		if a == str {
@@ -92,20 +133,37 @@ func CreateFullDeck() []models.Card {
 	return deckCards
 }
 
-// create a new deck with params
-func (s *DeckServiceImpl) CreateNewDeck(shuffled bool, cards string) (*dtos.RespCreateDeck, error) {
+// create a new deck with params, owned by the tenant
+func (s *DeckServiceImpl) CreateNewDeck(ctx context.Context, tenantId string, shuffled bool, cards string, metadata map[string]string) (*dtos.RespCreateDeck, error) {
+	ctx, span := tracer.Start(ctx, "DeckService.CreateNewDeck", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+	))
+	defer span.End()
+
+	err := validateMetadata(metadata)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Invalid deck metadata")
+		return nil, err
+	}
+
+	limits, err := s.repo.TenantLimits(ctx, tenantId)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error in loading tenant limits")
+		return nil, err
+	}
 
 	var lstCards = strings.Split(cards, ",")
 	var deckCards []models.Card
-	if len(lstCards) != 1 && lstCards[0] != "" {
+	if cards != "" {
 
-		if len(lstCards) > 52 {
-			s.logger.Error("Number of cards exceeded")
+		if limits.MaxCardsPerDeck > 0 && len(lstCards) > limits.MaxCardsPerDeck {
+			s.logger.WithContext(ctx).WithFields(logrus.Fields{"cards": len(lstCards), "limit": limits.MaxCardsPerDeck}).Error("Deck exceeds the card limit")
+			return nil, fmt.Errorf("%w: at most %d cards are allowed", ErrTooManyCards, limits.MaxCardsPerDeck)
 		}
 		for _, code := range lstCards {
-			parsedCard, err := parseCode(code, s.logger)
+			parsedCard, err := parseCode(code)
 			if err != nil {
-				s.logger.Error("%s is not a valid code\n", code)
+				s.logger.WithContext(ctx).WithField("code", code).Error("Invalid card code")
 				return nil, err
 			}
 
@@ -114,6 +172,10 @@ func (s *DeckServiceImpl) CreateNewDeck(shuffled bool, cards string) (*dtos.Resp
 
 	} else {
 		deckCards = CreateFullDeck()
+		if limits.MaxCardsPerDeck > 0 && len(deckCards) > limits.MaxCardsPerDeck {
+			s.logger.WithContext(ctx).WithFields(logrus.Fields{"cards": len(deckCards), "limit": limits.MaxCardsPerDeck}).Error("Deck exceeds the card limit")
+			return nil, fmt.Errorf("%w: at most %d cards are allowed", ErrTooManyCards, limits.MaxCardsPerDeck)
+		}
 	}
 
 	if shuffled == true {
@@ -124,14 +186,27 @@ func (s *DeckServiceImpl) CreateNewDeck(shuffled bool, cards string) (*dtos.Resp
 		Shuffled:  shuffled,
 		Remaining: len(deckCards),
 		Cards:     deckCards,
+		Metadata:  metadata,
+		TenantID:  tenantId,
 	}
 
-	result, err := s.repo.CreateDeck(deck)
+	event, err := s.repo.CreateDeck(ctx, deck, limits.MaxDecks)
 	if err != nil {
-		s.logger.WithError(err).Error("Error in creating deck")
+		s.logger.WithContext(ctx).WithError(err).Error("Error in creating deck")
+		return nil, err
+	}
+	if event == nil {
+		s.logger.WithContext(ctx).WithField("limit", limits.MaxDecks).Error("Tenant reached its deck limit")
+		return nil, fmt.Errorf("%w: at most %d decks are allowed", ErrDeckLimitReached, limits.MaxDecks)
 	}
 
-	var resp = dtos.RespCreateDeck{DeckID: result, Remaining: deck.Remaining, Shuffled: deck.Shuffled}
+	// subscribers see the deck, but not the order of its cards
+	published := *event
+	published.Cards = nil
+	s.broker.Publish(published)
+	metrics.DeckCreated(deck.Shuffled)
+
+	var resp = dtos.RespCreateDeck{DeckID: event.DeckID, Remaining: deck.Remaining, Shuffled: deck.Shuffled, Metadata: deck.Metadata, Version: event.Version}
 
 	return &resp, nil
 }
@@ -149,19 +224,26 @@ func shuffleCards(deck []models.Card) []models.Card {
 	return deck
 }
 
-// open a new deck based on id
-func (s *DeckServiceImpl) OpenDeck(deckId string) (*dtos.RespOpenDeck, error) {
-	exist, err := s.repo.CheckDeckExist(deckId)
+// open a deck of the tenant based on id
+func (s *DeckServiceImpl) OpenDeck(ctx context.Context, tenantId string, deckId string) (*dtos.RespOpenDeck, error) {
+	ctx, span := tracer.Start(ctx, "DeckService.OpenDeck", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+		attribute.String("deck.id", deckId),
+	))
+	defer span.End()
+	ctx = logging.With(ctx, logging.DeckID, deckId)
+
+	exist, err := s.repo.CheckDeckExist(ctx, tenantId, deckId)
 	if err != nil {
-		s.logger.Errorf("Error in checking id %s", deckId)
+		s.logger.WithContext(ctx).Error("Error in checking deck exists")
 		return nil, err
 	}
 	if !exist {
-		s.logger.Errorf("Deck with id %s does not exist", deckId)
-		return nil, errors.New("Id doesn't exist")
+		s.logger.WithContext(ctx).Error("Deck does not exist")
+		return nil, ErrDeckNotFound
 	}
 
-	deck, err := s.repo.OpenDeck(deckId)
+	deck, err := s.repo.OpenDeck(ctx, tenantId, deckId)
 	if err != nil {
 		return nil, err
 	}
@@ -169,36 +251,255 @@ func (s *DeckServiceImpl) OpenDeck(deckId string) (*dtos.RespOpenDeck, error) {
 	return deck, nil
 }
 
-// Draw number of cards from deck based on id
-func (s *DeckServiceImpl) DrawCard(deckId string, count int) (*dtos.RespDrawDeck, error) {
+// Draw number of cards from a deck of the tenant based on id. A non zero
+// version must be the current version of the deck.
+func (s *DeckServiceImpl) DrawCard(ctx context.Context, tenantId string, deckId string, count int, version int) (*dtos.RespDrawDeck, error) {
+	ctx, span := tracer.Start(ctx, "DeckService.DrawCard", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+		attribute.String("deck.id", deckId),
+		attribute.Int("deck.draw_count", count),
+	))
+	defer span.End()
+	ctx = logging.With(ctx, logging.DeckID, deckId)
+
 	// Check if deck exists
-	exist, err := s.repo.CheckDeckExist(deckId)
+	exist, err := s.repo.CheckDeckExist(ctx, tenantId, deckId)
 	if err != nil {
-		s.logger.Errorf("Error in checking id %s", deckId)
+		s.logger.WithContext(ctx).Error("Error in checking deck exists")
+		metrics.DrawFailed(metrics.DrawError)
 		return nil, err
 	}
 	if !exist {
-		s.logger.Errorf("Deck with id %s does not exist", deckId)
-		return nil, errors.New("Id doesn't exist")
+		s.logger.WithContext(ctx).Error("Deck does not exist")
+		metrics.DrawFailed(metrics.DrawNotFound)
+		return nil, ErrDeckNotFound
 	}
 
-	// Check if count is less than remaining cards
-	deck, err := s.repo.OpenDeck(deckId)
+	// Draw cards. The remaining cards and the version are checked in the
+	// transaction that draws them, so concurrent draws can't both pass.
+	event, err := s.repo.DrawCard(ctx, tenantId, deckId, count, version)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.WithContext(ctx).Error("Deck was deleted before drawing")
+		metrics.DrawFailed(metrics.DrawNotFound)
+		return nil, ErrDeckNotFound
+	}
+	if errors.Is(err, repos.ErrNotEnoughCards) {
+		s.logger.WithContext(ctx).WithError(err).WithField("count", count).Error("Not enough cards in deck")
+		metrics.DrawFailed(metrics.DrawNotEnoughCards)
+		return nil, ErrNotEnoughCards
+	}
 	if err != nil {
+		s.logger.WithContext(ctx).WithField("count", count).Error("Error in drawing cards")
+		metrics.DrawFailed(metrics.DrawError)
 		return nil, err
 	}
-	remaining := len(deck.Cards)
-	if count > remaining {
-		s.logger.Errorf("Requested count %d exceeds remaining cards %d in deck", count, remaining)
-		return nil, errors.New("Requested count exceeds remaining cards in deck")
+	if event == nil {
+		s.logger.WithContext(ctx).WithField("expected_version", version).Error("Deck version changed")
+		metrics.DrawFailed(metrics.DrawVersionChanged)
+		return nil, ErrVersionMismatch
+	}
+	s.broker.Publish(*event)
+	metrics.CardsDrawn(len(event.Cards))
+
+	cards := &dtos.RespDrawDeck{Version: event.Version}
+	for _, card := range event.Cards {
+		cards.Cards = append(cards.Cards, dtos.RespDrawCard{Code: card.Code, Value: card.Value, Suit: card.Suit})
 	}
 
-	// Draw cards
-	cards, err := s.repo.DrawCard(deckId, count)
+	return cards, nil
+}
+
+// Update the metadata of a deck of the tenant. A non zero version must be the
+// current version of the deck.
+func (s *DeckServiceImpl) UpdateDeck(ctx context.Context, tenantId string, deckId string, update dtos.ReqUpdateDeck, version int) (*dtos.RespOpenDeck, error) {
+	ctx, span := tracer.Start(ctx, "DeckService.UpdateDeck", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+		attribute.String("deck.id", deckId),
+	))
+	defer span.End()
+	ctx = logging.With(ctx, logging.DeckID, deckId)
+
+	deck, err := s.OpenDeck(ctx, tenantId, deckId)
 	if err != nil {
-		s.logger.Errorf("Error in draw %d cards from deck %s", count, remaining)
 		return nil, err
 	}
+	if version != 0 && deck.Version != version {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{"version": deck.Version, "expected_version": version}).Error("Deck version changed")
+		return nil, ErrVersionMismatch
+	}
 
-	return cards, nil
+	// validate the metadata the deck ends up with
+	merged := make(map[string]string, len(deck.Metadata))
+	for key, value := range deck.Metadata {
+		merged[key] = value
+	}
+	for key, value := range update.Metadata {
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = *value
+		}
+	}
+	err = validateMetadata(merged)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Invalid deck metadata")
+		return nil, err
+	}
+
+	event, err := s.repo.UpdateDeckMetadata(ctx, tenantId, deckId, update.Metadata, version)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error in updating deck metadata")
+		return nil, err
+	}
+	if event == nil {
+		s.logger.WithContext(ctx).WithField("expected_version", version).Error("Deck changed before updating")
+		return nil, ErrVersionMismatch
+	}
+	s.broker.Publish(*event)
+
+	deck.Metadata = event.Metadata
+	deck.Version = event.Version
+
+	return deck, nil
+}
+
+// Delete a deck of the tenant, its history is kept. A non zero version must be
+// the current version of the deck.
+func (s *DeckServiceImpl) DeleteDeck(ctx context.Context, tenantId string, deckId string, version int) error {
+	ctx, span := tracer.Start(ctx, "DeckService.DeleteDeck", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+		attribute.String("deck.id", deckId),
+	))
+	defer span.End()
+	ctx = logging.With(ctx, logging.DeckID, deckId)
+
+	exist, err := s.repo.CheckDeckExist(ctx, tenantId, deckId)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("Error in checking deck exists")
+		return err
+	}
+	if !exist {
+		s.logger.WithContext(ctx).Error("Deck does not exist")
+		return ErrDeckNotFound
+	}
+
+	event, err := s.repo.DeleteDeck(ctx, tenantId, deckId, version)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error in deleting deck")
+		return err
+	}
+	if event == nil {
+		s.logger.WithContext(ctx).WithField("expected_version", version).Error("Deck version changed")
+		return ErrVersionMismatch
+	}
+	s.broker.Publish(*event)
+
+	return nil
+}
+
+// Subscribe to the events of an existing deck of the tenant
+func (s *DeckServiceImpl) SubscribeDeckEvents(ctx context.Context, tenantId string, deckId string) (*events.Subscription, error) {
+	ctx, span := tracer.Start(ctx, "DeckService.SubscribeDeckEvents", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+		attribute.String("deck.id", deckId),
+	))
+	defer span.End()
+	ctx = logging.With(ctx, logging.DeckID, deckId)
+
+	exist, err := s.repo.CheckDeckExist(ctx, tenantId, deckId)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("Error in checking deck exists")
+		return nil, err
+	}
+	if !exist {
+		s.logger.WithContext(ctx).Error("Deck does not exist")
+		return nil, ErrDeckNotFound
+	}
+
+	return s.broker.Subscribe(deckId), nil
+}
+
+// check number and size of metadata entries
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > MaxMetadataKeys {
+		return fmt.Errorf("%w: at most %d keys are allowed", ErrInvalidMetadata, MaxMetadataKeys)
+	}
+
+	for key, value := range metadata {
+		if key == "" || len(key) > MaxMetadataKeyLength {
+			return fmt.Errorf("%w: keys must be 1 to %d characters", ErrInvalidMetadata, MaxMetadataKeyLength)
+		}
+		if len(value) > MaxMetadataValueLength {
+			return fmt.Errorf("%w: value of %s exceeds %d characters", ErrInvalidMetadata, key, MaxMetadataValueLength)
+		}
+	}
+
+	return nil
+}
+
+// List decks of the tenant matching the filter, one page at a time
+func (s *DeckServiceImpl) ListDecks(ctx context.Context, tenantId string, filter models.DeckFilter) (*dtos.RespListDecks, error) {
+	ctx, span := tracer.Start(ctx, "DeckService.ListDecks", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+	))
+	defer span.End()
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	var after *models.DeckCursor
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			s.logger.WithContext(ctx).WithField("cursor", filter.Cursor).Error("Invalid cursor")
+			return nil, ErrInvalidCursor
+		}
+		after = cursor
+	}
+
+	// fetch one extra deck to know if there is a next page
+	decks, err := s.repo.ListDecks(ctx, tenantId, filter, after, limit+1)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error in listing decks")
+		return nil, err
+	}
+
+	resp := &dtos.RespListDecks{Decks: decks}
+	if len(decks) > limit {
+		resp.Decks = decks[:limit]
+		last := resp.Decks[limit-1]
+		resp.NextCursor = encodeCursor(models.DeckCursor{CreatedAt: last.CreatedAt, DeckID: last.DeckID})
+	}
+
+	return resp, nil
+}
+
+// cursors are opaque to clients, the creation time and id of the last deck of a page
+func encodeCursor(cursor models.DeckCursor) string {
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.DeckID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (*models.DeckCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.DeckCursor{CreatedAt: createdAt, DeckID: parts[1]}, nil
 }
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"toggl/app/dtos"
+	"toggl/app/logging"
+	"toggl/app/models"
+	"toggl/app/repos"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrTenantNotFound = errors.New("Tenant doesn't exist")
+
+type TenantService interface {
+	ListTenants(ctx context.Context) (*dtos.RespListTenants, error)
+	TenantUsage(ctx context.Context, tenantId string) (*dtos.RespTenantUsage, error)
+	UpdateTenant(ctx context.Context, tenantId string, req dtos.ReqUpdateTenant) (*dtos.RespTenantUsage, error)
+}
+
+type TenantServiceImpl struct {
+	logger *logrus.Logger
+	repo   *repos.Repository
+}
+
+// New Tenant service setup using dependencies
+func NewTenantService(logger *logrus.Logger, repo *repos.Repository) *TenantServiceImpl {
+	return &TenantServiceImpl{logger: logger, repo: repo}
+}
+
+// List every tenant with what it uses and its limits
+func (s *TenantServiceImpl) ListTenants(ctx context.Context) (*dtos.RespListTenants, error) {
+	ctx, span := tracer.Start(ctx, "TenantService.ListTenants")
+	defer span.End()
+
+	usage, err := s.repo.ListTenantUsage(ctx)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error in listing tenants")
+		return nil, err
+	}
+
+	resp := &dtos.RespListTenants{Tenants: make([]dtos.RespTenantUsage, len(usage))}
+	for i := range usage {
+		resp.Tenants[i] = toRespTenantUsage(usage[i])
+	}
+	return resp, nil
+}
+
+// Usage and limits of a tenant
+func (s *TenantServiceImpl) TenantUsage(ctx context.Context, tenantId string) (*dtos.RespTenantUsage, error) {
+	ctx, span := tracer.Start(ctx, "TenantService.TenantUsage", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+	))
+	defer span.End()
+
+	usage, err := s.repo.TenantUsage(ctx, tenantId)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).WithField(logging.TenantID, tenantId).Error("Error in loading usage of tenant")
+		return nil, err
+	}
+	if usage == nil {
+		s.logger.WithContext(ctx).WithField(logging.TenantID, tenantId).Error("Tenant does not exist")
+		return nil, ErrTenantNotFound
+	}
+
+	resp := toRespTenantUsage(*usage)
+	return &resp, nil
+}
+
+// Set the limits of a tenant, registering it when it is new. Decks the tenant
+// already has are kept when it ends up over its limits.
+func (s *TenantServiceImpl) UpdateTenant(ctx context.Context, tenantId string, req dtos.ReqUpdateTenant) (*dtos.RespTenantUsage, error) {
+	ctx, span := tracer.Start(ctx, "TenantService.UpdateTenant", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+	))
+	defer span.End()
+
+	err := s.repo.SetTenantLimits(ctx, tenantId, req.MaxDecks, req.MaxCardsPerDeck)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).WithField(logging.TenantID, tenantId).Error("Error in updating limits of tenant")
+		return nil, err
+	}
+
+	return s.TenantUsage(ctx, tenantId)
+}
+
+func toRespTenantUsage(usage models.TenantUsage) dtos.RespTenantUsage {
+	return dtos.RespTenantUsage{
+		TenantID: usage.TenantID,
+		Decks:    usage.Decks,
+		Cards:    usage.Cards,
+		APIKeys:  usage.APIKeys,
+		Webhooks: usage.Webhooks,
+		Limits: dtos.RespTenantLimits{
+			MaxDecks:        usage.Limits.MaxDecks,
+			MaxCardsPerDeck: usage.Limits.MaxCardsPerDeck,
+		},
+		CreatedAt: usage.CreatedAt,
+	}
+}
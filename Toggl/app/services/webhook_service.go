@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"toggl/app/dtos"
+	"toggl/app/models"
+	"toggl/app/repos"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// events a webhook can subscribe to
+var WebhookEvents = []string{models.WebhookDeckCreated, models.WebhookDeckExhausted, models.WebhookDeckDeleted}
+
+// bounds of a webhook secret chosen by the client
+const MinWebhookSecretLength = 16
+const MaxWebhookSecretLength = 256
+
+// page size limits for listing deliveries
+const DefaultDeliveriesLimit = 50
+const MaxDeliveriesLimit = 200
+
+var ErrWebhookNotFound = errors.New("Webhook doesn't exist")
+
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, tenantId string, req dtos.ReqCreateWebhook) (*dtos.RespWebhook, error)
+	ListWebhooks(ctx context.Context, tenantId string) (*dtos.RespListWebhooks, error)
+	DeleteWebhook(ctx context.Context, tenantId string, webhookId string) error
+	ListDeliveries(ctx context.Context, tenantId string, webhookId string, limit int) (*dtos.RespWebhookDeliveries, error)
+}
+
+type WebhookServiceImpl struct {
+	logger *logrus.Logger
+	repo   *repos.Repository
+}
+
+// New Webhook service setup using dependencies
+func NewWebhookService(logger *logrus.Logger, repo *repos.Repository) *WebhookServiceImpl {
+	return &WebhookServiceImpl{logger: logger, repo: repo}
+}
+
+// Create a webhook notified of the decks of the tenant. The secret signing its
+// deliveries is generated unless the request has one, and is only part of
+// this response.
+func (s *WebhookServiceImpl) CreateWebhook(ctx context.Context, tenantId string, req dtos.ReqCreateWebhook) (*dtos.RespWebhook, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.CreateWebhook", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+	))
+	defer span.End()
+
+	secret := req.Secret
+	if secret == "" {
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		if err != nil {
+			s.logger.WithContext(ctx).WithError(err).Error("Error generating webhook secret")
+			return nil, err
+		}
+		secret = hex.EncodeToString(key)
+	}
+
+	webhook := &models.Webhook{TenantID: tenantId, URL: req.URL, Secret: secret, Events: req.Events}
+	err := s.repo.CreateWebhook(ctx, webhook)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error in creating webhook")
+		return nil, err
+	}
+
+	resp := webhookResponse(*webhook)
+	resp.Secret = webhook.Secret
+	return &resp, nil
+}
+
+// List webhooks of the tenant, without their secrets
+func (s *WebhookServiceImpl) ListWebhooks(ctx context.Context, tenantId string) (*dtos.RespListWebhooks, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.ListWebhooks", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+	))
+	defer span.End()
+
+	webhooks, err := s.repo.ListWebhooks(ctx, tenantId)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("Error in listing webhooks")
+		return nil, err
+	}
+
+	resp := &dtos.RespListWebhooks{Webhooks: make([]dtos.RespWebhook, len(webhooks))}
+	for i, webhook := range webhooks {
+		resp.Webhooks[i] = webhookResponse(webhook)
+	}
+	return resp, nil
+}
+
+// Delete a webhook of the tenant, pending deliveries are dropped
+func (s *WebhookServiceImpl) DeleteWebhook(ctx context.Context, tenantId string, webhookId string) error {
+	ctx, span := tracer.Start(ctx, "WebhookService.DeleteWebhook", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+		attribute.String("webhook.id", webhookId),
+	))
+	defer span.End()
+
+	deleted, err := s.repo.DeleteWebhook(ctx, tenantId, webhookId)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).WithField("webhook_id", webhookId).Error("Error in deleting webhook")
+		return err
+	}
+	if !deleted {
+		s.logger.WithContext(ctx).WithField("webhook_id", webhookId).Error("Webhook does not exist")
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// The delivery log of a webhook of the tenant, newest first
+func (s *WebhookServiceImpl) ListDeliveries(ctx context.Context, tenantId string, webhookId string, limit int) (*dtos.RespWebhookDeliveries, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.ListDeliveries", trace.WithAttributes(
+		attribute.String("tenant.id", tenantId),
+		attribute.String("webhook.id", webhookId),
+	))
+	defer span.End()
+
+	if limit <= 0 {
+		limit = DefaultDeliveriesLimit
+	}
+	if limit > MaxDeliveriesLimit {
+		limit = MaxDeliveriesLimit
+	}
+
+	exist, err := s.repo.CheckWebhookExist(ctx, tenantId, webhookId)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("webhook_id", webhookId).Error("Error in checking webhook exists")
+		return nil, err
+	}
+	if !exist {
+		s.logger.WithContext(ctx).WithField("webhook_id", webhookId).Error("Webhook does not exist")
+		return nil, ErrWebhookNotFound
+	}
+
+	deliveries, err := s.repo.ListDeliveries(ctx, webhookId, limit)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).WithField("webhook_id", webhookId).Error("Error in listing deliveries of webhook")
+		return nil, err
+	}
+
+	resp := &dtos.RespWebhookDeliveries{Deliveries: make([]dtos.RespWebhookDelivery, len(deliveries))}
+	for i, delivery := range deliveries {
+		resp.Deliveries[i] = dtos.RespWebhookDelivery{
+			ID:             delivery.ID,
+			EventType:      delivery.EventType,
+			DeckID:         delivery.DeckID,
+			Status:         delivery.Status,
+			Attempts:       delivery.Attempts,
+			LastStatusCode: delivery.LastStatusCode,
+			LastError:      delivery.LastError,
+			CreatedAt:      delivery.CreatedAt.UTC(),
+			DeliveredAt:    delivery.DeliveredAt,
+		}
+		if delivery.Status == models.DeliveryPending {
+			next := delivery.NextAttemptAt.UTC()
+			resp.Deliveries[i].NextAttemptAt = &next
+		}
+	}
+	return resp, nil
+}
+
+func webhookResponse(webhook models.Webhook) dtos.RespWebhook {
+	return dtos.RespWebhook{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		Events:    webhook.Events,
+		CreatedAt: webhook.CreatedAt.UTC(),
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Format a version as a strong ETag
+func Format_etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// Parse a strong ETag made by Format_etag back to its version
+func Parse_etag(etag string) (int, error) {
+	if len(etag) < 3 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, errors.New("not a strong ETag")
+	}
+
+	version, err := strconv.Atoi(etag[1 : len(etag)-1])
+	if err != nil || version <= 0 {
+		return 0, errors.New("not the ETag of a version")
+	}
+	return version, nil
+}
@@ -0,0 +1,42 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set at link time with
+//
+//	go build -ldflags "-X toggl/app/version.Version=v1.2.0 -X toggl/app/version.Commit=$(git rev-parse HEAD) -X toggl/app/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Build metadata of the running binary
+type Info struct {
+	Version   string
+	Commit    string
+	BuildTime string
+	GoVersion string
+}
+
+// The build metadata set at link time. The commit and build time fall back
+// to what the go tool records from version control, when it did.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+
+	return info
+}
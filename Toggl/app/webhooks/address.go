@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"syscall"
+)
+
+// Error of a webhook URL, or of a delivery, pointing at an address of this
+// host or its network, such as the cloud metadata endpoint 169.254.169.254
+var ErrPrivateAddress = errors.New("must not point at a loopback, private or link-local address")
+
+// Whether webhooks may be sent to ip: anything but loopback, private,
+// link-local, multicast and unspecified addresses
+func PublicIP(ip net.IP) bool {
+	return ip != nil &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+// Check the host of a webhook URL is public. Names are resolved and every
+// address must be public. A name that doesn't resolve yet is accepted, as
+// deliveries check the address they connect to again.
+func CheckURL(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	host := target.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !PublicIP(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if !PublicIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// refuse connections to addresses that aren't public, unless allowed. Runs
+// once the name of a delivery is resolved, so a name resolving to another
+// address than when the webhook was created is checked too.
+func dialControl(allowPrivate func() bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if allowPrivate() {
+			return nil
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if !PublicIP(net.ParseIP(host)) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+}
@@ -0,0 +1,232 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"toggl/app/models"
+	"toggl/app/repos"
+
+	"github.com/sirupsen/logrus"
+)
+
+// headers of a delivery request
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// defaults of the dispatcher settings
+const (
+	DefaultMaxAttempts  = 8
+	DefaultBaseBackoff  = 5 * time.Second
+	DefaultMaxBackoff   = 10 * time.Minute
+	DefaultPollInterval = time.Second
+	DefaultTimeout      = 10 * time.Second
+)
+
+// deliveries sent per poll of the repository
+const batchSize = 20
+
+// Sends deck lifecycle events to webhooks. Deliveries are queued in the
+// repository with the change of the event and sent by a background worker,
+// so they survive restarts and slow receivers don't hold up requests.
+type Dispatcher struct {
+	logger *logrus.Logger
+	repo   *repos.Repository
+	client *http.Client
+	wake   chan struct{}
+
+	// attempts before a delivery is given up, retried with exponential backoff
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+
+	// send to loopback, private and link-local addresses too, for receivers
+	// on this host or network
+	AllowPrivateAddresses bool
+}
+
+// Setup a new dispatcher with default settings
+func NewDispatcher(logger *logrus.Logger, repo *repos.Repository) *Dispatcher {
+	d := &Dispatcher{
+		logger:       logger,
+		repo:         repo,
+		wake:         make(chan struct{}, 1),
+		MaxAttempts:  DefaultMaxAttempts,
+		BaseBackoff:  DefaultBaseBackoff,
+		MaxBackoff:   DefaultMaxBackoff,
+		PollInterval: DefaultPollInterval,
+	}
+
+	// Connect to receivers directly, not through a proxy, so the address
+	// checked is the receiver's
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl(func() bool { return d.AllowPrivateAddresses }),
+	}).DialContext
+
+	d.client = &http.Client{
+		Transport: transport,
+		Timeout:   DefaultTimeout,
+		// a redirect counts as the receiver's response, following it could
+		// reach an address the webhook couldn't be created with
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return d
+}
+
+// Wake the worker for the deliveries of a deck event, which the repository
+// queued with the change. Meant to be registered as a listener of the event
+// broker, it never blocks the publisher.
+func (d *Dispatcher) Handle(event models.DeckEvent) {
+	if models.WebhookEvent(event) == "" {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Send due deliveries until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// send every delivery that is due, a batch at a time
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := d.repo.DueDeliveries(ctx, time.Now(), batchSize)
+		if err != nil {
+			d.logger.WithError(err).Error("Error loading due webhook deliveries")
+			return
+		}
+
+		for i := range deliveries {
+			d.attempt(ctx, &deliveries[i])
+		}
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// make one attempt at a delivery and store its outcome
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	now := time.Now().UTC()
+	statusCode, err := d.send(ctx, delivery, now)
+	if ctx.Err() != nil {
+		// shutting down, the delivery stays due and is sent after a restart
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+	}
+
+	logger := d.logger.WithFields(logrus.Fields{
+		"delivery_id": delivery.ID,
+		"webhook_id":  delivery.WebhookID,
+		"event":       delivery.EventType,
+		"attempts":    delivery.Attempts,
+		"status":      delivery.Status,
+	})
+	if err != nil {
+		logger.WithError(err).Warn("Webhook delivery failed")
+	}
+
+	err = d.repo.UpdateDelivery(ctx, delivery)
+	if err != nil {
+		logger.WithError(err).Error("Error storing webhook delivery")
+	}
+}
+
+// post a delivery, an error for anything but a 2xx response
+func (d *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// wait before the next attempt, doubling after every failed attempt
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.BaseBackoff
+	for i := 1; i < attempts && wait < d.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.MaxBackoff {
+		wait = d.MaxBackoff
+	}
+	return wait
+}
+
+// Signature of a delivery: the hex HMAC-SHA256 of the timestamp, a dot and the
+// body, keyed with the webhook secret. Receivers recompute it to verify the
+// sender, and reject old timestamps to stop replays.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -1,46 +1,78 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"toggl/app"
 	"toggl/app/config"
+	"toggl/app/logging"
+
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG"), "path of the YAML config file, "+config.DefaultPath+" when it exists by default")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration, secrets redacted, and exit")
+	flag.Parse()
+
+	// Log as JSON until the configuration says otherwise
+	logger := logrus.New()
+	logging.Configure(logger, logging.FormatJSON, "")
+
 	// Load configuration
-	config, err := config.LoadConfig(false)
+	path := config.FindFile(*configPath)
+	config, err := config.Load(path)
 	if err != nil {
-		log.Fatalf("failed to load config: %s", err)
+		logger.WithError(err).WithField("path", path).Fatal("Failed to load config")
 	}
 
-	// Create a new instance of the app
-	app, err := app.NewApp(config)
+	if *printConfig {
+		out, err := json.MarshalIndent(config.Redacted(), "", "  ")
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to print config")
+		}
+		fmt.Println(string(out))
+	}
+
+	err = config.Validate()
 	if err != nil {
-		log.Fatalf("failed to create app: %s", err)
+		logger.WithError(err).Fatal("Invalid config")
+	}
+	if *printConfig {
+		return
 	}
 
-	// Start the app
-	go func() {
-		if err := app.Start(); err != nil {
-			log.Fatalf("failed to start app: %s", err)
-		}
-	}()
+	// Log in the configured format and level from here on
+	logger = logrus.New()
+	err = logging.Configure(logger, config.LogFormat, config.LogLevel)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to configure logging")
+	}
 
-	// Wait for SIGINT or SIGTERM signal to gracefully stop the app
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+	// Create a new instance of the app
+	app, err := app.NewApp(config, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create app")
+	}
+	if path != "" {
+		app.WatchConfig(path)
+	}
 
-	log.Println("Received interrupt signal. Stopping app...")
+	// Run the app until SIGINT or SIGTERM, then stop it gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// Stop the app
-	if err := app.Stop(); err != nil {
-		log.Fatalf("failed to stop app: %s", err)
+	err = app.Run(ctx)
+	if err != nil {
+		logger.WithError(err).Error("App stopped")
+		os.Exit(1)
 	}
 
-	log.Println("App stopped gracefully.")
+	logger.Info("App stopped gracefully")
 }
@@ -0,0 +1,348 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"toggl/app"
+	"toggl/app/config"
+	"toggl/app/dtos"
+	"toggl/tests/unit/testcerts"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// an app on a free port, without gRPC or API keys
+func newTestApp(t *testing.T) *app.App {
+	conf := &config.Config{
+		DrainTimeout: 5,
+		Database:     config.Database{ProdPath: filepath.Join(t.TempDir(), "deck.db")},
+	}
+	a, err := app.NewApp(conf, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// run the app until the returned function stops it and reports how Run returned
+func runApp(t *testing.T, a *app.App) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- a.Run(ctx) }()
+
+	select {
+	case <-a.Listening():
+	case err := <-done:
+		t.Fatal(err)
+	}
+
+	return func() error {
+		cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(10 * time.Second):
+			t.Fatal("app did not stop")
+			return nil
+		}
+	}
+}
+
+func TestRunServesUntilCancelled(t *testing.T) {
+	a := newTestApp(t)
+	stop := runApp(t, a)
+	url := "http://" + a.HTTPAddr()
+
+	resp, err := http.Get(url + "/readyz")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	assert.NoError(t, stop())
+
+	// no longer listening
+	_, err = http.Get(url + "/healthz")
+	assert.Error(t, err)
+}
+
+func TestStopDrainsTheRunningApp(t *testing.T) {
+	a := newTestApp(t)
+	done := make(chan error, 1)
+	go func() { done <- a.Run(context.Background()) }()
+	<-a.Listening()
+	url := "http://" + a.HTTPAddr()
+
+	resp, err := http.Get(url + "/readyz")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// Stop returns once Run has shut down, with its result
+	assert.NoError(t, a.Stop())
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	default:
+		t.Fatal("Run is still running after Stop returned")
+	}
+	assert.NoError(t, a.Stop())
+
+	_, err = http.Get(url + "/healthz")
+	assert.Error(t, err)
+}
+
+func TestRunEndsEventStreamsOnShutdown(t *testing.T) {
+	a := newTestApp(t)
+	stop := runApp(t, a)
+	url := "http://" + a.HTTPAddr()
+
+	resp, err := http.Post(url+"/v1/create-deck", "application/json", strings.NewReader(`{"cards":["AS","2S"]}`))
+	if !assert.NoError(t, err) {
+		stop()
+		return
+	}
+	var deck dtos.RespCreateDeck
+	json.NewDecoder(resp.Body).Decode(&deck)
+	resp.Body.Close()
+
+	stream, err := http.Get(url + "/v1/decks/" + deck.DeckID + "/events")
+	if !assert.NoError(t, err) {
+		stop()
+		return
+	}
+	defer stream.Body.Close()
+	line, _ := bufio.NewReader(stream.Body).ReadString('\n')
+	assert.Equal(t, ": subscribed\n", line)
+
+	// the open stream doesn't hold up shutdown until the drain timeout
+	start := time.Now()
+	assert.NoError(t, stop())
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	_, err = io.ReadAll(stream.Body)
+	assert.NoError(t, err)
+}
+
+func TestRunReloadsConfigWhenFileChanges(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	write := func(burst string) {
+		content := "Port: 0\nGrpcPort: 0\nRequireAPIKey: false\nCreateRateLimit:\n   Burst: " + burst + "\nDatabase:\n   ProdPath: " + filepath.Join(dir, "deck.db") + "\n"
+		err := os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("5")
+
+	conf, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := app.NewApp(conf, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.WatchConfig(path)
+	stop := runApp(t, a)
+	defer stop()
+
+	createLimit := func() string {
+		resp, err := http.Post("http://"+a.HTTPAddr()+"/v1/create-deck", "application/json", strings.NewReader(`{"cards":["AS"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("RateLimit-Limit")
+	}
+	assert.Equal(t, "5", createLimit())
+
+	write("7")
+	assert.Eventually(t, func() bool { return createLimit() == "7" }, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestRunServesHTTP2OverTLSToClientsWithCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcerts.NewCA(t, dir, "ca")
+	certFile, keyFile := ca.Issue("server")
+	conf := &config.Config{
+		DrainTimeout: 5,
+		TLS:          config.TLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: ca.File},
+		Database:     config.Database{ProdPath: filepath.Join(dir, "deck.db")},
+	}
+	a, err := app.NewApp(conf, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := runApp(t, a)
+	defer stop()
+
+	get := func(clientCerts ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			ForceAttemptHTTP2: true,
+			TLSClientConfig:   &tls.Config{RootCAs: ca.Pool(), ServerName: "localhost", Certificates: clientCerts},
+		}}
+		defer client.CloseIdleConnections()
+		return client.Get("https://" + a.HTTPAddr() + "/healthz")
+	}
+
+	resp, err := get(ca.ClientCertificate("client"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+
+	_, err = get()
+	assert.Error(t, err)
+}
+
+func TestRunServesTheAPIOnAUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "api.sock")
+
+	// a socket left behind by a crashed run is replaced
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	conf := &config.Config{
+		DrainTimeout: 5,
+		UnixSocket:   config.UnixSocket{Path: socket, Mode: "0600"},
+		Database:     config.Database{ProdPath: filepath.Join(dir, "deck.db")},
+		// anonymous clients of the socket aren't limited as one client
+		CreateRateLimit: config.RateLimit{PerMinute: 60, Burst: 1},
+	}
+	a, err := app.NewApp(conf, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := runApp(t, a)
+
+	info, err := os.Stat(socket)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post("http://unix/v1/create-deck", "application/json", strings.NewReader(`{"cards":["AS"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("RateLimit-Limit"))
+	}
+	client.CloseIdleConnections()
+
+	// the API is still served over TCP, and both stop together
+	resp, err := http.Get("http://" + a.HTTPAddr() + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.NoError(t, stop())
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunRefusesASocketPathThatIsNotASocket(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.sock")
+	err := os.WriteFile(path, []byte("keep me"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.Config{
+		UnixSocket: config.UnixSocket{Path: path, Mode: "0660"},
+		Database:   config.Database{ProdPath: filepath.Join(dir, "deck.db")},
+	}
+	a, err := app.NewApp(conf, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.Run(context.Background())
+
+	assert.ErrorContains(t, err, "exists and is not a socket")
+	content, _ := os.ReadFile(path)
+	assert.Equal(t, "keep me", string(content))
+}
+
+func TestNewAppWithInvalidSocketModeOpensNoDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "deck.db")
+	conf := &config.Config{
+		Database:   config.Database{ProdPath: dbPath},
+		UnixSocket: config.UnixSocket{Path: filepath.Join(t.TempDir(), "api.sock"), Mode: "rw"},
+	}
+
+	_, err := app.NewApp(conf, logrus.New())
+
+	assert.ErrorContains(t, err, "octal permissions")
+	assert.NoFileExists(t, dbPath)
+}
+
+func TestRunServesMetricsAndProbesOnTheAdminPort(t *testing.T) {
+	// find a free port for the admin server
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminPort := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	conf := &config.Config{
+		AdminPort:    adminPort,
+		MetricsPath:  "/metrics",
+		DrainTimeout: 5,
+		Database:     config.Database{ProdPath: filepath.Join(t.TempDir(), "deck.db")},
+	}
+	a, err := app.NewApp(conf, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := runApp(t, a)
+	defer stop()
+
+	status := func(addr string, path string) int {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, status(a.AdminAddr(), "/healthz"))
+	assert.Equal(t, http.StatusOK, status(a.AdminAddr(), "/readyz"))
+	assert.Equal(t, http.StatusOK, status(a.AdminAddr(), "/metrics"))
+	assert.Equal(t, http.StatusNotFound, status(a.AdminAddr(), "/v1/decks"))
+
+	assert.Equal(t, http.StatusNotFound, status(a.HTTPAddr(), "/healthz"))
+	assert.Equal(t, http.StatusNotFound, status(a.HTTPAddr(), "/metrics"))
+	assert.Equal(t, http.StatusOK, status(a.HTTPAddr(), "/v1/decks"))
+}
@@ -0,0 +1,140 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"testing"
+	"time"
+	"toggl/app/certs"
+	"toggl/tests/unit/testcerts"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// the common name of the certificate a TLS server on addr presents
+func servedName(t *testing.T, addr string, ca *testcerts.CA) string {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: ca.Pool(), ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+// accept TLS connections on a free port with config until the test ends
+func listenTLS(t *testing.T, config *tls.Config) string {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestReloaderServesRenewedCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcerts.NewCA(t, dir, "ca")
+	certFile, keyFile := ca.Issue("server")
+
+	reloader, err := certs.NewReloader(certFile, keyFile, "", logrus.New())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx)
+
+	addr := listenTLS(t, reloader.TLSConfig())
+	first := reloader.Certificate().SerialNumber
+	assert.Equal(t, "server", servedName(t, addr, ca))
+
+	// renew the certificate in place, the key is rewritten first
+	ca.Issue("server")
+
+	assert.Eventually(t, func() bool {
+		return reloader.Certificate().SerialNumber.Cmp(first) != 0
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, "server", servedName(t, addr, ca))
+}
+
+func TestReloadKeepsCertificateWhenFilesAreInvalid(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcerts.NewCA(t, dir, "ca")
+	certFile, keyFile := ca.Issue("server")
+
+	reloader, err := certs.NewReloader(certFile, keyFile, "", logrus.New())
+	assert.NoError(t, err)
+	serial := reloader.Certificate().SerialNumber
+
+	err = os.WriteFile(certFile, []byte("not a certificate"), 0o600)
+	assert.NoError(t, err)
+
+	assert.ErrorContains(t, reloader.Reload(), "loading TLS certificate")
+	assert.Equal(t, serial, reloader.Certificate().SerialNumber)
+}
+
+func TestNewReloaderFailsWithoutClientCAs(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcerts.NewCA(t, dir, "ca")
+	certFile, keyFile := ca.Issue("server")
+
+	_, err := certs.NewReloader(certFile, keyFile, keyFile, logrus.New())
+
+	assert.ErrorContains(t, err, "loading client CAs: no certificates in")
+}
+
+func TestGrpcRequiresClientCertificatesFromClientCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcerts.NewCA(t, dir, "ca")
+	other := testcerts.NewCA(t, t.TempDir(), "other")
+	certFile, keyFile := ca.Issue("server")
+
+	reloader, err := certs.NewReloader(certFile, keyFile, ca.File, logrus.New())
+	assert.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(reloader.TLSConfig())))
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+	defer server.Stop()
+
+	check := func(clientCerts ...tls.Certificate) error {
+		conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			RootCAs:      ca.Pool(),
+			ServerName:   "localhost",
+			Certificates: clientCerts,
+		})))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		return err
+	}
+
+	assert.NoError(t, check(ca.ClientCertificate("client")))
+	assert.Error(t, check())
+	assert.Error(t, check(other.ClientCertificate("client")))
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"toggl/app/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadReadsFileAndAppliesDefaults(t *testing.T) {
+	path := writeConfig(t, "Port: 8181\nAdminKey: s3cret\nDrawRateLimit:\n   Burst: 5\nDatabase:\n   ProdPath: /var/lib/deck.db\n")
+
+	conf, err := config.Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 8181, conf.Port)
+	assert.Equal(t, 5, conf.DrawRateLimit.Burst)
+	assert.Equal(t, 600, conf.DrawRateLimit.PerMinute)
+	assert.Equal(t, "/var/lib/deck.db", conf.Database.ProdPath)
+	assert.Equal(t, "toggl-deck", conf.Tracing.ServiceName)
+	assert.NoError(t, conf.Validate())
+}
+
+func TestLoadWithEnvironmentOverridesFile(t *testing.T) {
+	path := writeConfig(t, "Port: 8181\nRequireAPIKey: true\n")
+	t.Setenv("POCKER_PORT", "9000")
+	t.Setenv("POCKER_DATABASE_PATH", "/data/deck.db")
+	t.Setenv("POCKER_REQUIRE_API_KEY", "false")
+	t.Setenv("POCKER_DECK_DRAW_RATE_LIMIT_PER_MINUTE", "12")
+	t.Setenv("POCKER_TRACING_SAMPLE_RATIO", "0.25")
+
+	conf, err := config.Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 9000, conf.Port)
+	assert.Equal(t, "/data/deck.db", conf.Database.ProdPath)
+	assert.False(t, conf.RequireAPIKey)
+	assert.Equal(t, 12, conf.DeckDrawRateLimit.PerMinute)
+	assert.Equal(t, 0.25, conf.Tracing.SampleRatio)
+}
+
+func TestLoadWithMissingFileReturnError(t *testing.T) {
+	_, err := config.Load(filepath.Join(t.TempDir(), "missing.yml"))
+	assert.Error(t, err)
+}
+
+func TestLoadWithInvalidEnvironmentReturnError(t *testing.T) {
+	t.Setenv("POCKER_PORT", "eighty")
+
+	_, err := config.Load(writeConfig(t, "Port: 8181\n"))
+	assert.ErrorContains(t, err, "Port")
+}
+
+func TestValidateReportsEveryInvalidSetting(t *testing.T) {
+	conf, err := config.Load(writeConfig(t, "Port: 8181\n"))
+	assert.NoError(t, err)
+	conf.Port = 70000
+	conf.DrainTimeout = -1
+	conf.LogFormat = "xml"
+	conf.Tracing.SampleRatio = 2
+	conf.Database.ProdPath = ""
+
+	err = conf.Validate()
+
+	assert.EqualError(t, err, "invalid configuration: "+
+		"AdminKey (POCKER_ADMIN_KEY): is required when RequireAPIKey is set, API keys can't be issued without it\n"+
+		"Database.ProdPath (POCKER_DATABASE_PATH): is required\n"+
+		"DrainTimeout (POCKER_DRAIN_TIMEOUT): must not be negative, got -1\n"+
+		"LogFormat (POCKER_LOG_FORMAT): must be json or text, got \"xml\"\n"+
+		"Port (POCKER_PORT): must be a port between 0 and 65535, got 70000\n"+
+		"Tracing.SampleRatio (POCKER_TRACING_SAMPLE_RATIO): must be between 0 and 1, got 2")
+}
+
+func TestValidateNeedsCertificateAndKeyForTLS(t *testing.T) {
+	conf, err := config.Load(writeConfig(t, "AdminKey: s3cret\nTLS:\n   CertFile: cert.pem\n"))
+	assert.NoError(t, err)
+	assert.EqualError(t, conf.Validate(), "invalid configuration: TLS.KeyFile (POCKER_TLS_KEY_FILE): is required with TLS.CertFile")
+
+	t.Setenv("POCKER_TLS_CLIENT_CA_FILE", "ca.pem")
+	conf, err = config.Load(writeConfig(t, "Port: 8181\nAdminKey: s3cret\n"))
+	assert.NoError(t, err)
+	assert.EqualError(t, conf.Validate(), "invalid configuration: TLS.ClientCAFile (POCKER_TLS_CLIENT_CA_FILE): needs TLS.CertFile and TLS.KeyFile")
+}
+
+func TestValidateChecksAdminPortAndSocketMode(t *testing.T) {
+	conf, err := config.Load(writeConfig(t, "Port: 8181\nAdminKey: s3cret\nAdminPort: 8181\nUnixSocket:\n   Path: /run/toggl.sock\n   Mode: rw\n"))
+	assert.NoError(t, err)
+
+	assert.EqualError(t, conf.Validate(), "invalid configuration: "+
+		"AdminPort (POCKER_ADMIN_PORT): must differ from Port and GrpcPort, got 8181\n"+
+		"UnixSocket.Mode (POCKER_UNIX_SOCKET_MODE): must be octal permissions such as 0660, got \"rw\"")
+
+	conf.AdminPort = 9100
+	conf.UnixSocket.Mode = "0660"
+	assert.NoError(t, conf.Validate())
+}
+
+func TestValidateNeedsAdminKeyToIssueRequiredAPIKeys(t *testing.T) {
+	// the defaults, as a fresh install starts with
+	conf, err := config.Load("")
+	assert.NoError(t, err)
+	assert.True(t, conf.RequireAPIKey)
+
+	assert.EqualError(t, conf.Validate(), "invalid configuration: "+
+		"AdminKey (POCKER_ADMIN_KEY): is required when RequireAPIKey is set, API keys can't be issued without it")
+
+	// either an admin key to issue keys with
+	t.Setenv("POCKER_ADMIN_KEY", "s3cret")
+	conf, err = config.Load("")
+	assert.NoError(t, err)
+	assert.NoError(t, conf.Validate())
+
+	// or no keys at all
+	conf.AdminKey = ""
+	conf.RequireAPIKey = false
+	assert.NoError(t, conf.Validate())
+}
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	conf := config.Config{Port: 8080, AdminKey: "s3cret"}
+
+	redacted := conf.Redacted()
+
+	assert.Equal(t, "REDACTED", redacted.AdminKey)
+	assert.Equal(t, 8080, redacted.Port)
+	assert.Equal(t, "s3cret", conf.AdminKey)
+}
+
+func TestReloadSwapsRuntimeSettingsOnly(t *testing.T) {
+	path := writeConfig(t, "LogLevel: info\nPort: 8181\nMaxCardsPerDeck: 52\nAdminKey: first\n")
+	conf, err := config.Load(path)
+	assert.NoError(t, err)
+	live := config.NewLive(conf)
+
+	err = os.WriteFile(path, []byte("LogLevel: debug\nPort: 9191\nMaxCardsPerDeck: 10\nAdminKey: second\nDrawRateLimit:\n   Burst: 5\n"), 0o600)
+	assert.NoError(t, err)
+
+	applied, restart, err := live.Reload(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`LogLevel: "info" -> "debug"`, "MaxCardsPerDeck: 52 -> 10", "DrawRateLimit.Burst: 60 -> 5"}, applied)
+	assert.Equal(t, []string{"Port: 8181 -> 9191", "AdminKey changed"}, restart)
+	assert.Equal(t, "debug", live.Current().LogLevel)
+	assert.Equal(t, 10, live.Current().MaxCardsPerDeck)
+	assert.Equal(t, 8181, live.Current().Port)
+	assert.Equal(t, "first", live.Current().AdminKey)
+
+	// the configuration it started from is left alone
+	assert.Equal(t, 52, conf.MaxCardsPerDeck)
+}
+
+func TestReloadWithInvalidFileKeepsCurrentSettings(t *testing.T) {
+	path := writeConfig(t, "MaxCardsPerDeck: 52\n")
+	conf, err := config.Load(path)
+	assert.NoError(t, err)
+	live := config.NewLive(conf)
+
+	err = os.WriteFile(path, []byte("MaxCardsPerDeck: -1\n"), 0o600)
+	assert.NoError(t, err)
+
+	_, _, err = live.Reload(path)
+
+	assert.ErrorContains(t, err, "MaxCardsPerDeck")
+	assert.Same(t, conf, live.Current())
+}
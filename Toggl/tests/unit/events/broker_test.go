@@ -0,0 +1,77 @@
+package events
+
+import (
+	"testing"
+	"toggl/app/events"
+	"toggl/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishSendsEventToSubscribersOfDeck(t *testing.T) {
+	broker := events.NewBroker(0)
+	first := broker.Subscribe("deck-1")
+	defer first.Close()
+	second := broker.Subscribe("deck-1")
+	defer second.Close()
+	other := broker.Subscribe("deck-2")
+	defer other.Close()
+
+	broker.Publish(models.DeckEvent{Type: models.CardsDrawn, DeckID: "deck-1", Remaining: 51})
+
+	assert.Equal(t, models.CardsDrawn, (<-first.Events()).Type)
+	assert.Equal(t, 51, (<-second.Events()).Remaining)
+	assert.Len(t, other.Events(), 0)
+}
+
+func TestPublishDisconnectsSlowSubscriber(t *testing.T) {
+	broker := events.NewBroker(2)
+	slow := broker.Subscribe("deck-1")
+	defer slow.Close()
+
+	for i := 0; i < 3; i++ {
+		broker.Publish(models.DeckEvent{Type: models.CardsDrawn, DeckID: "deck-1", Remaining: 52 - i})
+	}
+
+	// the buffered events are still delivered before the channel closes
+	var received int
+	for range slow.Events() {
+		received++
+	}
+	assert.Equal(t, 2, received)
+	assert.True(t, slow.Overflowed())
+	assert.Equal(t, 0, broker.Subscribers("deck-1"))
+}
+
+func TestCloseUnsubscribes(t *testing.T) {
+	broker := events.NewBroker(0)
+	sub := broker.Subscribe("deck-1")
+
+	sub.Close()
+	sub.Close()
+	broker.Publish(models.DeckEvent{Type: models.CardsDrawn, DeckID: "deck-1"})
+
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	assert.False(t, sub.Overflowed())
+	assert.Equal(t, 0, broker.Subscribers("deck-1"))
+}
+
+func TestCloseBrokerEndsSubscriptions(t *testing.T) {
+	broker := events.NewBroker(0)
+	sub := broker.Subscribe("deck-1")
+	defer sub.Close()
+
+	broker.Close()
+
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	assert.False(t, sub.Overflowed())
+	assert.Equal(t, 0, broker.Subscribers("deck-1"))
+
+	// subscribing after the broker closed ends right away
+	late := broker.Subscribe("deck-1")
+	defer late.Close()
+	_, ok = <-late.Events()
+	assert.False(t, ok)
+}
@@ -0,0 +1,224 @@
+package grpcserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"toggl/app/auth"
+	"toggl/app/dtos"
+	"toggl/app/grpcserver"
+	"toggl/app/pb/deckv1"
+	"toggl/tests/unit/handlers/mock_services"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// start a gRPC server on an in-memory listener and connect a client to it
+func newClient(t *testing.T, mockDeckService *mock_services.MockDeckService, logger *logrus.Logger, opts ...grpc.ServerOption) deckv1.DeckServiceClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(opts...)
+	deckv1.RegisterDeckServiceServer(server, grpcserver.NewDeckServer(mockDeckService, logger))
+	go server.Serve(listener)
+	t.Cleanup(server.GracefulStop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return deckv1.NewDeckServiceClient(conn)
+}
+
+func TestCreateNewDeckRpcReturnSuccess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	client := newClient(t, mockDeckService, logger)
+
+	expectedDeck := &dtos.RespCreateDeck{
+		DeckID:    "a251071b-662f-44b6-ba11-e24863039c59",
+		Shuffled:  true,
+		Remaining: 2,
+	}
+	mockDeckService.ExpectCreateNewDeck("", true, "AS,2S", map[string]string(nil), expectedDeck, nil)
+
+	deck, err := client.CreateNewDeck(context.Background(), &deckv1.CreateDeckRequest{Shuffle: true, Cards: []string{"AS", "2S"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "a251071b-662f-44b6-ba11-e24863039c59", deck.DeckId)
+	assert.Equal(t, true, deck.Shuffled)
+	assert.Equal(t, int32(2), deck.Remaining)
+}
+
+func TestCreateNewDeckRpcWithInvalidCardReturnInvalidArgument(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	client := newClient(t, mockDeckService, logger)
+
+	_, err := client.CreateNewDeck(context.Background(), &deckv1.CreateDeckRequest{Cards: []string{"SA"}})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "SA is not a valid card code: Invalid value", status.Convert(err).Message())
+}
+
+func TestOpenDeckRpcReturnSuccess(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	client := newClient(t, mockDeckService, logger)
+
+	expectedDeck := &dtos.RespOpenDeck{
+		DeckID:    id,
+		Remaining: 1,
+		Cards:     []dtos.RespOpenDeckCard{{Code: "AS", Value: "ACE", Suit: "SPADES"}},
+		Metadata:  map[string]string{"table_id": "7"},
+	}
+	mockDeckService.ExpectOpenDeck("", id, expectedDeck, nil)
+
+	deck, err := client.OpenDeck(context.Background(), &deckv1.OpenDeckRequest{DeckId: id})
+
+	assert.NoError(t, err)
+	assert.Equal(t, id, deck.DeckId)
+	assert.Len(t, deck.Cards, 1)
+	assert.Equal(t, "AS", deck.Cards[0].Code)
+	assert.Equal(t, "7", deck.Metadata["table_id"])
+}
+
+func TestDrawCardRpcWithInvalidParamsReturnInvalidArgument(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	client := newClient(t, mockDeckService, logger)
+
+	_, err := client.DrawCard(context.Background(), &deckv1.DrawCardsRequest{DeckId: "invalid", Count: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.DrawCard(context.Background(), &deckv1.DrawCardsRequest{DeckId: "a251071b-662f-44b6-ba11-e24863039c59"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "Count parameter must be a positive integer", status.Convert(err).Message())
+}
+
+func TestDrawCardStreamRpcSendsEachCard(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	client := newClient(t, mockDeckService, logger)
+
+	expectedDeck := &dtos.RespDrawDeck{
+		Cards: []dtos.RespDrawCard{
+			{Code: "AS", Value: "ACE", Suit: "SPADES"},
+			{Code: "2S", Value: "2", Suit: "SPADES"},
+		},
+	}
+	mockDeckService.ExpectDrawCard("", id, 2, 0, expectedDeck, nil)
+
+	stream, err := client.DrawCardStream(context.Background(), &deckv1.DrawCardsRequest{DeckId: id, Count: 2})
+	assert.NoError(t, err)
+
+	var codes []string
+	for {
+		card, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		codes = append(codes, card.Code)
+	}
+	assert.Equal(t, []string{"AS", "2S"}, codes)
+}
+
+func TestCreateNewDeckStreamRpcCreatesDeckPerRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	client := newClient(t, mockDeckService, logger)
+
+	mockDeckService.ExpectCreateNewDeck("", false, "", map[string]string(nil), &dtos.RespCreateDeck{DeckID: "first", Remaining: 52}, nil)
+	mockDeckService.ExpectCreateNewDeck("", false, "AS", map[string]string(nil), &dtos.RespCreateDeck{DeckID: "second", Remaining: 1}, nil)
+
+	stream, err := client.CreateNewDeckStream(context.Background())
+	assert.NoError(t, err)
+
+	assert.NoError(t, stream.Send(&deckv1.CreateDeckRequest{}))
+	first, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", first.DeckId)
+
+	assert.NoError(t, stream.Send(&deckv1.CreateDeckRequest{Cards: []string{"AS"}}))
+	second, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "second", second.DeckId)
+	assert.Equal(t, int32(1), second.Remaining)
+
+	assert.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+// an authenticator knowing a single key
+type staticAuthenticator struct{}
+
+func (staticAuthenticator) Authenticate(ctx context.Context, key string) (*auth.Principal, error) {
+	if key != "tk_valid" {
+		return nil, auth.ErrInvalidKey
+	}
+	return &auth.Principal{KeyID: "key-1", TenantID: "team-a"}, nil
+}
+
+func TestRpcWithoutAPIKeyReturnUnauthenticated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	client := newClient(t, mockDeckService, logger,
+		grpc.UnaryInterceptor(grpcserver.UnaryAuthInterceptor(staticAuthenticator{}, true)),
+		grpc.StreamInterceptor(grpcserver.StreamAuthInterceptor(staticAuthenticator{}, true)),
+	)
+
+	_, err := client.OpenDeck(context.Background(), &deckv1.OpenDeckRequest{DeckId: "a251071b-662f-44b6-ba11-e24863039c59"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer tk_revoked")
+	_, err = client.OpenDeck(ctx, &deckv1.OpenDeckRequest{DeckId: "a251071b-662f-44b6-ba11-e24863039c59"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRpcWithAPIKeyUseItsTenant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	client := newClient(t, mockDeckService, logger,
+		grpc.UnaryInterceptor(grpcserver.UnaryAuthInterceptor(staticAuthenticator{}, true)),
+	)
+
+	expectedDeck := &dtos.RespOpenDeck{DeckID: "a251071b-662f-44b6-ba11-e24863039c59", Remaining: 0}
+	mockDeckService.ExpectOpenDeck("team-a", "a251071b-662f-44b6-ba11-e24863039c59", expectedDeck, nil)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "tk_valid")
+	deck, err := client.OpenDeck(ctx, &deckv1.OpenDeckRequest{DeckId: "a251071b-662f-44b6-ba11-e24863039c59"})
+	assert.NoError(t, err)
+	assert.Equal(t, "a251071b-662f-44b6-ba11-e24863039c59", deck.DeckId)
+}
@@ -1,19 +1,30 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+	"toggl/app/auth"
 	"toggl/app/dtos"
+	"toggl/app/events"
 	"toggl/app/handlers"
+	"toggl/app/models"
+	"toggl/app/pb/deckv1"
+	"toggl/app/render"
+	"toggl/app/services"
 	"toggl/tests/unit/handlers/mock_services"
 
 	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestCreateNewDeckHandlerWithoutParamsReturnSuccess(t *testing.T) {
@@ -32,7 +43,7 @@ func TestCreateNewDeckHandlerWithoutParamsReturnSuccess(t *testing.T) {
 	}
 
 	expectedErr := errors.New("some error")
-	mockDeckService.ExpectCreateNewDeck(false, "", expectedDeck, expectedErr)
+	mockDeckService.ExpectCreateNewDeck("", false, "", nil, expectedDeck, expectedErr)
 
 	// Set up the HTTP request and response
 	req, errs := http.NewRequest("POST", "/v1/create-deck", nil)
@@ -71,7 +82,7 @@ func TestCreateDeckHandlerWithCardsParmsReturnSuccess(t *testing.T) {
 	}
 
 	expectedErr := errors.New("some error")
-	mockDeckService.ExpectCreateNewDeck(true, cards, expectedDeck, expectedErr)
+	mockDeckService.ExpectCreateNewDeck("", true, cards, nil, expectedDeck, expectedErr)
 	req, err := http.NewRequest("POST", "/v1/create-deck?cards="+cards+"&shuffle="+shuffled, nil)
 	assert.NoError(t, err)
 
@@ -106,8 +117,7 @@ func TestOpenDeckHandlerWithParamsReturnSuccess(t *testing.T) {
 		},
 	}
 
-	expectedErr := errors.New("some error")
-	mockDeckService.ExpectOpenDeck(id, expectedDeck, expectedErr)
+	mockDeckService.ExpectOpenDeck("", id, expectedDeck, nil)
 	req, err := http.NewRequest("GET", "/open-deck?deck_id="+id, nil)
 	assert.NoError(t, err)
 
@@ -139,7 +149,7 @@ func TestOpenDeckHandlerWithEmptyParamsReturnsError(t *testing.T) {
 
 	expectedErr := errors.New("some error")
 	// Expect that the service layer is not called
-	mockDeckService.ExpectOpenDeck("", expectedDeck, expectedErr).Times(0)
+	mockDeckService.ExpectOpenDeck("", "", expectedDeck, expectedErr).Times(0)
 
 	// Call the handler
 	handler.OpenDeckHandler(w, req)
@@ -169,7 +179,7 @@ func TestOpenDeckHandlerWithInvalidParamsReturnsError(t *testing.T) {
 
 	expectedErr := errors.New("some error")
 	// Expect that the service layer is not called
-	mockDeckService.ExpectOpenDeck("", expectedDeck, expectedErr).Times(0)
+	mockDeckService.ExpectOpenDeck("", "", expectedDeck, expectedErr).Times(0)
 
 	// Call the handler
 	handler.OpenDeckHandler(w, req)
@@ -200,8 +210,7 @@ func TestDrawCardHandlerWithParamsReturnSuccess(t *testing.T) {
 		},
 	}
 
-	expectedErr := errors.New("some error")
-	mockDeckService.ExpectDrawCard(id, count, expectedDeck, expectedErr)
+	mockDeckService.ExpectDrawCard("", id, count, 0, expectedDeck, nil)
 
 	req, err := http.NewRequest("GET", "/v1/draw-cards?deck_id="+id+"&count="+fmt.Sprintf("%d", count), nil)
 	assert.NoError(t, err)
@@ -234,7 +243,7 @@ func TestDrawCardHandlerWithEmptyDeckIdParamsReturnError(t *testing.T) {
 
 	expectedErr := errors.New("some error")
 	// Expect that the service layer is not called
-	mockDeckService.ExpectDrawCard("", 3, expectedDeck, expectedErr).Times(0)
+	mockDeckService.ExpectDrawCard("", "", 3, 0, expectedDeck, expectedErr).Times(0)
 
 	// Call the handler
 	handler.DrawCardHandler(w, req)
@@ -265,7 +274,7 @@ func TestDrawCardHandlerWithInvalidDeckIdParamReturnError(t *testing.T) {
 
 	expectedErr := errors.New("some error")
 	// Expect that the service layer is not called
-	mockDeckService.ExpectDrawCard(id, 3, expectedDeck, expectedErr).Times(0)
+	mockDeckService.ExpectDrawCard("", id, 3, 0, expectedDeck, expectedErr).Times(0)
 
 	// Call the handler
 	handler.DrawCardHandler(w, req)
@@ -296,7 +305,7 @@ func TestDrawCardHandlerWithInvalidCountParamReturnError(t *testing.T) {
 
 	expectedErr := errors.New("some error")
 	// Expect that the service layer is not called
-	mockDeckService.ExpectDrawCard(id, 0, expectedDeck, expectedErr).Times(0)
+	mockDeckService.ExpectDrawCard("", id, 0, 0, expectedDeck, expectedErr).Times(0)
 
 	// Call the handler
 	handler.DrawCardHandler(w, req)
@@ -308,3 +317,806 @@ func TestDrawCardHandlerWithInvalidCountParamReturnError(t *testing.T) {
 	assert.Equal(t, expected, actual)
 
 }
+
+func TestListDecksHandlerWithFiltersReturnSuccess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	shuffled := true
+	minRemaining := 1
+	createdAfter := time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC)
+	expectedFilter := models.DeckFilter{
+		Shuffled:     &shuffled,
+		MinRemaining: &minRemaining,
+		CreatedAfter: &createdAfter,
+		Cursor:       "abc",
+		Limit:        1,
+	}
+	expectedDecks := &dtos.RespListDecks{
+		Decks: []dtos.RespDeckSummary{
+			{DeckID: "a251071b-662f-44b6-ba11-e24863039c59", Shuffled: true, Remaining: 52, CreatedAt: createdAfter},
+		},
+		NextCursor: "def",
+	}
+	mockDeckService.ExpectListDecks("", expectedFilter, expectedDecks, nil)
+
+	req, err := http.NewRequest("GET", "/v1/decks?shuffled=true&min_remaining=1&created_after=2023-04-01T10:00:00Z&cursor=abc&limit=1", nil)
+	assert.NoError(t, err)
+
+	resRec := httptest.NewRecorder()
+
+	handler.ListDecksHandler(resRec, req)
+
+	assert.Equal(t, http.StatusOK, resRec.Code)
+
+	expected := `{"decks":[{"deck_id":"a251071b-662f-44b6-ba11-e24863039c59","shuffled":true,"remaining":52,"created_at":"2023-04-01T10:00:00Z"}],"next_cursor":"def"}`
+	actual := resRec.Body.String()
+	assert.Equal(t, expected, actual)
+}
+
+func TestListDecksHandlerWithInvalidParamsReturnError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	var cases = map[string]string{
+		"limit=0":                "Limit parameter must be a positive integer up to 100",
+		"shuffled=maybe":         "Shuffled parameter must be true or false",
+		"created_before=today":   "created_before parameter must be an RFC 3339 timestamp",
+		"max_remaining=-1":       "max_remaining parameter must be a non-negative integer",
+		"min_remaining=a&limit=": "min_remaining parameter must be a non-negative integer",
+	}
+
+	// Expect that the service layer is not called
+	mockDeckService.ExpectListDecks("", models.DeckFilter{}, &dtos.RespListDecks{}, nil).Times(0)
+
+	for query, message := range cases {
+		req, _ := http.NewRequest("GET", "/v1/decks?"+query, nil)
+		w := httptest.NewRecorder()
+
+		handler.ListDecksHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, message, strings.TrimSpace(w.Body.String()))
+	}
+}
+
+func TestListDecksHandlerWithInvalidCursorReturnError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	mockDeckService.ExpectListDecks("", models.DeckFilter{Cursor: "bad"}, nil, services.ErrInvalidCursor)
+
+	req, _ := http.NewRequest("GET", "/v1/decks?cursor=bad", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListDecksHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid cursor", strings.TrimSpace(w.Body.String()))
+}
+
+func TestCreateDeckHandlerWithMetadataParamsReturnSuccess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	metadata := map[string]string{"table_id": "7", "game_type": "poker"}
+	expectedDeck := &dtos.RespCreateDeck{
+		DeckID:    "a251071b-662f-44b6-ba11-e24863039c59",
+		Shuffled:  false,
+		Remaining: 52,
+		Metadata:  metadata,
+	}
+	mockDeckService.ExpectCreateNewDeck("", false, "", metadata, expectedDeck, nil)
+
+	req, err := http.NewRequest("POST", "/v1/create-deck?metadata[table_id]=7&metadata[game_type]=poker", nil)
+	assert.NoError(t, err)
+
+	resRec := httptest.NewRecorder()
+
+	handler.CreateNewDeckHandler(resRec, req)
+
+	assert.Equal(t, http.StatusOK, resRec.Code)
+
+	expected := `{"deck_id":"a251071b-662f-44b6-ba11-e24863039c59","shuffled":false,"remaining":52,"metadata":{"game_type":"poker","table_id":"7"}}`
+	actual := resRec.Body.String()
+	assert.Equal(t, expected, actual)
+}
+
+func TestUpdateDeckHandlerWithMetadataReturnSuccess(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	table := "9"
+	expectedUpdate := dtos.ReqUpdateDeck{Metadata: map[string]*string{"table_id": &table, "game_type": nil}}
+	expectedDeck := &dtos.RespOpenDeck{
+		DeckID:    id,
+		Remaining: 1,
+		Cards:     []dtos.RespOpenDeckCard{{Code: "AS", Value: "ACE", Suit: "SPADES"}},
+		Metadata:  map[string]string{"table_id": "9"},
+	}
+	mockDeckService.ExpectUpdateDeck("", id, expectedUpdate, 0, expectedDeck, nil)
+
+	req, err := http.NewRequest("PATCH", "/v1/decks/"+id, strings.NewReader(`{"metadata":{"table_id":"9","game_type":null}}`))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+
+	resRec := httptest.NewRecorder()
+
+	handler.UpdateDeckHandler(resRec, req)
+
+	assert.Equal(t, http.StatusOK, resRec.Code)
+
+	expected := `{"deck_id":"a251071b-662f-44b6-ba11-e24863039c59","shuffled":false,"remaining":1,"cards":[{"code":"AS","value":"ACE","suit":"SPADES"}],"metadata":{"table_id":"9"}}`
+	actual := resRec.Body.String()
+	assert.Equal(t, expected, actual)
+}
+
+func TestUpdateDeckHandlerWithUnknownDeckReturnNotFound(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	mockDeckService.ExpectUpdateDeck("", id, dtos.ReqUpdateDeck{}, 0, nil, services.ErrDeckNotFound)
+
+	req, _ := http.NewRequest("PATCH", "/v1/decks/"+id, strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.UpdateDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"Id doesn't exist"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestUpdateDeckHandlerWithInvalidBodyReturnFieldErrors(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	send := func(contentType string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", "/v1/decks/"+id, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+		w := httptest.NewRecorder()
+		handler.UpdateDeckHandler(w, req)
+		return w
+	}
+
+	w := send("application/json", `{"metadata":{"table_id":"9"},"shuffled":true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"Invalid request body","fields":[{"field":"shuffled","message":"is not a known field"}]}`, strings.TrimSpace(w.Body.String()))
+
+	w = send("application/json", `{"metadata":"9"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"Invalid request body","fields":[{"field":"metadata","message":"must be an object"}]}`, strings.TrimSpace(w.Body.String()))
+
+	w = send("application/json", `{"metadata":{"note":"`+strings.Repeat("x", 1<<20)+`"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "must not exceed 1048576 bytes")
+
+	w = send("text/plain", `metadata`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+func TestOpenDeckHandlerWithMatchingIfNoneMatchReturnNotModified(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	expectedDeck := &dtos.RespOpenDeck{DeckID: id, Remaining: 0, Cards: []dtos.RespOpenDeckCard{}, Version: 3}
+	mockDeckService.ExpectOpenDeck("", id, expectedDeck, nil).Times(2)
+
+	req, _ := http.NewRequest("GET", "/open-deck?deck_id="+id, nil)
+	req.Header.Set("If-None-Match", `"2"`)
+	w := httptest.NewRecorder()
+
+	handler.OpenDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	req.Header.Set("If-None-Match", `"2", W/"3"`)
+	w = httptest.NewRecorder()
+
+	handler.OpenDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestUpdateDeckHandlerWithIfMatchReturnNewETag(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	expectedDeck := &dtos.RespOpenDeck{DeckID: id, Cards: []dtos.RespOpenDeckCard{}, Version: 5}
+	mockDeckService.ExpectUpdateDeck("", id, dtos.ReqUpdateDeck{}, 4, expectedDeck, nil)
+
+	req, _ := http.NewRequest("PATCH", "/v1/decks/"+id, strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"4"`)
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.UpdateDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+}
+
+func TestUpdateDeckHandlerWithStaleIfMatchReturnPreconditionFailed(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	mockDeckService.ExpectUpdateDeck("", id, dtos.ReqUpdateDeck{}, 2, nil, services.ErrVersionMismatch)
+
+	req, _ := http.NewRequest("PATCH", "/v1/decks/"+id, strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"2"`)
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.UpdateDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, `{"error":"`+services.ErrVersionMismatch.Error()+`"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestDeleteDeckHandlerWithInvalidIfMatchReturnPreconditionFailed(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	mockDeckService.ExpectDeleteDeck("", id, 0, nil).Times(0)
+
+	req, _ := http.NewRequest("DELETE", "/v1/decks/"+id, nil)
+	req.Header.Set("If-Match", `W/"2"`)
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.DeleteDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestUpdateDeckHandlerWithExpiredDeadlineReturnGatewayTimeout(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	mockDeckService.ExpectUpdateDeck("", id, dtos.ReqUpdateDeck{}, 0, nil, fmt.Errorf("open deck: %w", context.DeadlineExceeded))
+
+	req, _ := http.NewRequest("PATCH", "/v1/decks/"+id, strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.UpdateDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"error":"Request timed out"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestDeleteDeckHandlerWithCancelledRequestReturnServiceUnavailable(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	mockDeckService.ExpectDeleteDeck("", id, 0, context.Canceled)
+
+	req, _ := http.NewRequest("DELETE", "/v1/decks/"+id, nil)
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.DeleteDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"error":"Request was cancelled"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestCreateDeckHandlerWithJSONBodyReturnSuccess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	expectedDeck := &dtos.RespCreateDeck{
+		DeckID:    "a251071b-662f-44b6-ba11-e24863039c59",
+		Shuffled:  true,
+		Remaining: 2,
+		Metadata:  map[string]string{"table_id": "7"},
+	}
+	mockDeckService.ExpectCreateNewDeck("", true, "AS,2S", map[string]string{"table_id": "7"}, expectedDeck, nil)
+
+	body := `{"shuffle":true,"cards":["AS","2S"],"metadata":{"table_id":"7"}}`
+	req, err := http.NewRequest("POST", "/v1/create-deck?shuffle=false", strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resRec := httptest.NewRecorder()
+
+	handler.CreateNewDeckHandler(resRec, req)
+
+	assert.Equal(t, http.StatusOK, resRec.Code)
+
+	expected := `{"deck_id":"a251071b-662f-44b6-ba11-e24863039c59","shuffled":true,"remaining":2,"metadata":{"table_id":"7"}}`
+	actual := resRec.Body.String()
+	assert.Equal(t, expected, actual)
+}
+
+func TestCreateDeckHandlerWithInvalidJSONBodyReturnFieldErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	var cases = map[string]string{
+		`{"cards":["AS","SA","ASS"]}`: `{"error":"Invalid request body","fields":[{"field":"cards[1]","message":"SA is not a valid card code: Invalid value"},{"field":"cards[2]","message":"ASS is not a valid card code: Invalid card"}]}`,
+		`{"shuffle":"yes"}`:           `{"error":"Invalid request body","fields":[{"field":"shuffle","message":"must be a boolean"}]}`,
+		`{"cards":"AS,2S"}`:           `{"error":"Invalid request body","fields":[{"field":"cards","message":"must be an array of strings"}]}`,
+		`{"cards":[]}`:                `{"error":"Invalid request body","fields":[{"field":"cards","message":"must not be empty, leave it out for a full deck"}]}`,
+		`{"count":1}`:                 `{"error":"Invalid request body","fields":[{"field":"count","message":"is not a known field"}]}`,
+		`{"shuffle":`:                 `{"error":"Invalid request body","fields":[{"field":"body","message":"malformed JSON, unexpected end of body"}]}`,
+		`{"shuffle":tru}`:             `{"error":"Invalid request body","fields":[{"field":"body","message":"malformed JSON at offset 15"}]}`,
+		``:                            `{"error":"Invalid request body","fields":[{"field":"body","message":"must not be empty"}]}`,
+	}
+
+	// Expect that the service layer is not called
+	mockDeckService.ExpectCreateNewDeck("", false, "", nil, &dtos.RespCreateDeck{}, nil).Times(0)
+
+	for body, expected := range cases {
+		req, _ := http.NewRequest("POST", "/v1/create-deck", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler.CreateNewDeckHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, expected, strings.TrimSpace(w.Body.String()))
+	}
+}
+
+func TestCreateDeckHandlerWithUnsupportedBodyReturnError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	req, _ := http.NewRequest("POST", "/v1/create-deck", strings.NewReader(`<deck/>`))
+	req.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+
+	handler.CreateNewDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "Content-Type must be application/json", strings.TrimSpace(w.Body.String()))
+}
+
+func TestDrawCardHandlerWithJSONBodyReturnSuccess(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	expectedDeck := &dtos.RespDrawDeck{
+		Cards: []dtos.RespDrawCard{{Code: "AS", Value: "ACE", Suit: "SPADES"}},
+	}
+	mockDeckService.ExpectDrawCard("", id, 1, 0, expectedDeck, nil)
+
+	req, err := http.NewRequest("POST", "/v1/draw-cards", strings.NewReader(`{"deck_id":"`+id+`","count":1}`))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	resRec := httptest.NewRecorder()
+
+	handler.DrawCardHandler(resRec, req)
+
+	assert.Equal(t, http.StatusOK, resRec.Code)
+
+	expected := `{"cards":[{"code":"AS","value":"ACE","suit":"SPADES"}]}`
+	actual := resRec.Body.String()
+	assert.Equal(t, expected, actual)
+}
+
+func TestDrawCardHandlerWithInvalidJSONBodyReturnFieldErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	var cases = map[string]string{
+		`{}`:                              `{"error":"Invalid request body","fields":[{"field":"deck_id","message":"is required"},{"field":"count","message":"must be a positive integer"}]}`,
+		`{"deck_id":"invalid","count":2}`: `{"error":"Invalid request body","fields":[{"field":"deck_id","message":"must be a valid UUID"}]}`,
+		`{"deck_id":"a251071b-662f-44b6-ba11-e24863039c59","count":"2"}`: `{"error":"Invalid request body","fields":[{"field":"count","message":"must be an integer"}]}`,
+	}
+
+	// Expect that the service layer is not called
+	mockDeckService.ExpectDrawCard("", "", 0, 0, &dtos.RespDrawDeck{}, nil).Times(0)
+
+	for body, expected := range cases {
+		req, _ := http.NewRequest("POST", "/v1/draw-cards", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler.DrawCardHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, expected, strings.TrimSpace(w.Body.String()))
+	}
+}
+
+func TestOpenDeckHandlerWithMsgpackAcceptReturnMsgpack(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	expectedDeck := &dtos.RespOpenDeck{
+		DeckID:    id,
+		Shuffled:  true,
+		Remaining: 1,
+		Cards:     []dtos.RespOpenDeckCard{{Code: "AS", Value: "ACE", Suit: "SPADES"}},
+	}
+	mockDeckService.ExpectOpenDeck("", id, expectedDeck, nil)
+
+	req, err := http.NewRequest("GET", "/v1/open-deck?deck_id="+id, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/x-msgpack")
+
+	resRec := httptest.NewRecorder()
+
+	handler.OpenDeckHandler(resRec, req)
+
+	assert.Equal(t, http.StatusOK, resRec.Code)
+	assert.Equal(t, render.MediaTypeMsgpack, resRec.Header().Get("Content-Type"))
+
+	// decoded with the JSON field names
+	var actual map[string]interface{}
+	assert.NoError(t, msgpack.Unmarshal(resRec.Body.Bytes(), &actual))
+	assert.Equal(t, id, actual["deck_id"])
+	assert.Equal(t, true, actual["shuffled"])
+	assert.EqualValues(t, 1, actual["remaining"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"code": "AS", "value": "ACE", "suit": "SPADES"}}, actual["cards"])
+}
+
+func TestDrawCardHandlerWithProtobufAcceptReturnProtobuf(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	expectedDeck := &dtos.RespDrawDeck{
+		Cards: []dtos.RespDrawCard{
+			{Code: "AS", Value: "ACE", Suit: "SPADES"},
+			{Code: "1H", Value: "10", Suit: "HEARTS"},
+		},
+	}
+	mockDeckService.ExpectDrawCard("", id, 2, 0, expectedDeck, nil)
+
+	req, err := http.NewRequest("POST", "/v1/draw-cards?deck_id="+id+"&count=2", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept", "application/json;q=0.5, application/x-protobuf")
+
+	resRec := httptest.NewRecorder()
+
+	handler.DrawCardHandler(resRec, req)
+
+	assert.Equal(t, http.StatusOK, resRec.Code)
+	assert.Equal(t, render.MediaTypeProtobuf, resRec.Header().Get("Content-Type"))
+
+	var actual deckv1.DrawCardsResponse
+	assert.NoError(t, proto.Unmarshal(resRec.Body.Bytes(), &actual))
+	assert.Len(t, actual.Cards, 2)
+	assert.Equal(t, "1H", actual.Cards[1].Code)
+	assert.Equal(t, "HEARTS", actual.Cards[1].Suit)
+}
+
+func TestCreateDeckHandlerWithUnsupportedAcceptReturnError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	// Expect that no deck is created
+	mockDeckService.ExpectCreateNewDeck("", false, "", nil, &dtos.RespCreateDeck{}, nil).Times(0)
+
+	req, _ := http.NewRequest("POST", "/v1/create-deck", nil)
+	req.Header.Set("Accept", "text/html, application/json;q=0")
+	w := httptest.NewRecorder()
+
+	handler.CreateNewDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+}
+
+func TestOpenDeckHandlerWithJSONAcceptReturnsJSONError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	req, _ := http.NewRequest("GET", "/v1/open-deck?deck_id=invalid_id", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.OpenDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"error":"Invalid deck id"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestDeckEventsHandlerStreamsEventsUntilSubscriberFallsBehind(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	// a buffer of one event, the second event overflows it
+	broker := events.NewBroker(1)
+	sub := broker.Subscribe(id)
+	broker.Publish(models.DeckEvent{Seq: 2, Type: models.CardsDrawn, DeckID: id, Remaining: 51})
+	broker.Publish(models.DeckEvent{Seq: 3, Type: models.CardsDrawn, DeckID: id, Remaining: 50})
+	mockDeckService.ExpectSubscribeDeckEvents("", id, sub, nil)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	req, _ := http.NewRequest("GET", "/v1/decks/"+id+"/events", nil)
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.DeckEventsHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(t, body, "id: 2\nevent: deck.drawn\ndata: {\"seq\":2,\"type\":\"deck.drawn\",\"deck_id\":\""+id+"\",\"remaining\":51,")
+	assert.NotContains(t, body, `"remaining":50`)
+	assert.True(t, strings.HasSuffix(body, "event: overflow\ndata: {}\n\n"))
+}
+
+func TestDeckEventsHandlerWithUnknownDeckReturnNotFound(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	mockDeckService.ExpectSubscribeDeckEvents("", id, nil, services.ErrDeckNotFound)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	req, _ := http.NewRequest("GET", "/v1/decks/"+id+"/events", nil)
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.DeckEventsHandler(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDeckEventsHandlerWithLastEventIdSendsMissedEvents(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	// event 3 is both in the history and published live, it is sent once
+	broker := events.NewBroker(1)
+	sub := broker.Subscribe(id)
+	broker.Publish(models.DeckEvent{Seq: 3, Type: models.CardsDrawn, DeckID: id, Remaining: 49})
+	broker.Publish(models.DeckEvent{Seq: 4, Type: models.CardsDrawn, DeckID: id, Remaining: 48})
+	mockDeckService.ExpectSubscribeDeckEvents("", id, sub, nil)
+	mockDeckService.ExpectDeckHistory("", id, &dtos.RespDeckHistory{DeckID: id, Events: []dtos.RespDeckEvent{
+		{Seq: 1, Type: models.DeckCreated, DeckID: id, Remaining: 52},
+		{Seq: 2, Type: models.CardsDrawn, DeckID: id, Remaining: 51},
+		{Seq: 3, Type: models.CardsDrawn, DeckID: id, Remaining: 49},
+	}}, nil)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	req, _ := http.NewRequest("GET", "/v1/decks/"+id+"/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.DeckEventsHandler(w, req)
+
+	body := w.Body.String()
+	assert.NotContains(t, body, "id: 1\n")
+	assert.Contains(t, body, "id: 2\n")
+	assert.Equal(t, 1, strings.Count(body, "id: 3\n"))
+	assert.NotContains(t, body, "id: 4\n")
+}
+
+func TestDeckHistoryHandlerReturnEvents(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	createdAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockDeckService.ExpectDeckHistory("", id, &dtos.RespDeckHistory{DeckID: id, Events: []dtos.RespDeckEvent{
+		{Seq: 1, Type: models.DeckCreated, DeckID: id, Remaining: 1, Cards: []dtos.RespDrawCard{{Code: "AS", Value: "ACE", Suit: "SPADES"}}, CreatedAt: createdAt},
+	}}, nil)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	req, _ := http.NewRequest("GET", "/v1/decks/"+id+"/history", nil)
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.DeckHistoryHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	expected := `{"deck_id":"` + id + `","events":[{"seq":1,"type":"deck.created","deck_id":"` + id + `","remaining":1,"cards":[{"code":"AS","value":"ACE","suit":"SPADES"}],"created_at":"2023-05-01T12:00:00Z"}]}`
+	assert.Equal(t, expected, w.Body.String())
+}
+
+func TestDeckStateHandlerWithInvalidSeqReturnError(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	mockDeckService.ExpectDeckStateAt("", id, 9, nil, services.ErrEventNotFound)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	req, _ := http.NewRequest("GET", "/v1/decks/"+id+"/history/0", nil)
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id, "seq": "0"})
+	w := httptest.NewRecorder()
+	handler.DeckStateHandler(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req, _ = http.NewRequest("GET", "/v1/decks/"+id+"/history/9", nil)
+	req = mux.SetURLVars(req, map[string]string{"deck_id": id, "seq": "9"})
+	w = httptest.NewRecorder()
+	handler.DeckStateHandler(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOpenDeckHandlerWithDeckOfAnotherTenantReturnNotFound(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	// the deck belongs to team-a, so team-b doesn't find it
+	mockDeckService.ExpectOpenDeck("team-b", id, nil, services.ErrDeckNotFound)
+
+	req, _ := http.NewRequest("GET", "/v1/open-deck?deck_id="+id, nil)
+	req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{KeyID: "key-b", TenantID: "team-b"}))
+	w := httptest.NewRecorder()
+
+	handler.OpenDeckHandler(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Id doesn't exist", strings.TrimSpace(w.Body.String()))
+}
+
+func TestDrawCardHandlerWithDeckOfAnotherTenantReturnNotFound(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	mockDeckService.ExpectDrawCard("team-b", id, 2, 0, nil, services.ErrDeckNotFound)
+
+	req, _ := http.NewRequest("POST", "/v1/draw-cards?deck_id="+id+"&count=2", nil)
+	req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{KeyID: "key-b", TenantID: "team-b"}))
+	w := httptest.NewRecorder()
+
+	handler.DrawCardHandler(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Id doesn't exist", strings.TrimSpace(w.Body.String()))
+}
+
+func TestDrawCardHandlerWithTooManyCardsReturnConflict(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	mockDeckService.ExpectDrawCard("", id, 53, 0, nil, services.ErrNotEnoughCards)
+
+	req, _ := http.NewRequest("POST", "/v1/draw-cards?deck_id="+id+"&count=53", nil)
+	w := httptest.NewRecorder()
+
+	handler.DrawCardHandler(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, services.ErrNotEnoughCards.Error(), strings.TrimSpace(w.Body.String()))
+}
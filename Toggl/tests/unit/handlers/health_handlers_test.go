@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"toggl/app/dtos"
+	"toggl/app/handlers"
+	"toggl/app/version"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeChecker struct {
+	err error
+}
+
+func (c fakeChecker) CheckSchema(ctx context.Context) error {
+	return c.err
+}
+
+func TestHealthzHandlerReturnOk(t *testing.T) {
+	handler := handlers.NewHealthHandler(fakeChecker{err: errors.New("database is locked")}, logrus.New())
+
+	r, _ := http.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+
+	handler.HealthzHandler(w, r)
+
+	// alive even when the repository isn't
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadyzHandlerReturnOkWhenRepositoryIsReady(t *testing.T) {
+	handler := handlers.NewHealthHandler(fakeChecker{}, logrus.New())
+
+	r, _ := http.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+
+	handler.ReadyzHandler(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadyzHandlerWithUnreachableRepositoryReturnServiceUnavailable(t *testing.T) {
+	handler := handlers.NewHealthHandler(fakeChecker{err: errors.New("schema at migration 3 of 7")}, logrus.New())
+
+	r, _ := http.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+
+	handler.ReadyzHandler(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"status":"unavailable","error":"Repository unavailable"}`, w.Body.String())
+}
+
+func TestReadyzHandlerWhileDrainingReturnServiceUnavailable(t *testing.T) {
+	handler := handlers.NewHealthHandler(fakeChecker{}, logrus.New())
+	handler.Drain()
+
+	r, _ := http.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+
+	handler.ReadyzHandler(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"status":"unavailable","error":"Shutting down"}`, w.Body.String())
+
+	// still alive though
+	w = httptest.NewRecorder()
+	handler.HealthzHandler(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestVersionHandlerReturnBuildMetadata(t *testing.T) {
+	defer func(v, c, b string) { version.Version, version.Commit, version.BuildTime = v, c, b }(version.Version, version.Commit, version.BuildTime)
+	version.Version = "v1.4.0"
+	version.Commit = "4bf92f3577b34da6a3ce929d0e0e4736a3ce929d"
+	version.BuildTime = "2023-06-01T10:00:00Z"
+
+	handler := handlers.NewHealthHandler(fakeChecker{}, logrus.New())
+
+	r, _ := http.NewRequest("GET", "/version", nil)
+	w := httptest.NewRecorder()
+
+	handler.VersionHandler(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp dtos.RespVersion
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, dtos.RespVersion{
+		Version:   "v1.4.0",
+		Commit:    "4bf92f3577b34da6a3ce929d0e0e4736a3ce929d",
+		BuildTime: "2023-06-01T10:00:00Z",
+		GoVersion: runtime.Version(),
+	}, resp)
+}
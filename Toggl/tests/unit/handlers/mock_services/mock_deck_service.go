@@ -1,7 +1,10 @@
 package mock_services
 
 import (
+	"context"
 	"toggl/app/dtos"
+	"toggl/app/events"
+	"toggl/app/models"
 
 	"github.com/golang/mock/gomock"
 	"github.com/sirupsen/logrus"
@@ -22,34 +25,111 @@ func NewMockDeckService(logger *logrus.Logger, ctrl *gomock.Controller) *MockDec
 }
 
 // CreateNewDeck is a mock implementation of the CreateNewDeck method
-func (m *MockDeckService) CreateNewDeck(shuffle bool, cards string) (*dtos.RespCreateDeck, error) {
-	ret := m.ctrl.Call(m, "CreateNewDeck", shuffle, cards)
+func (m *MockDeckService) CreateNewDeck(ctx context.Context, tenantId string, shuffle bool, cards string, metadata map[string]string) (*dtos.RespCreateDeck, error) {
+	ret := m.ctrl.Call(m, "CreateNewDeck", ctx, tenantId, shuffle, cards, metadata)
 	return ret[0].(*dtos.RespCreateDeck), nil
 }
 
 // EXPECTCreateNewDeck is a helper method for configuring expectations for the CreateNewDeck method
-func (m *MockDeckService) ExpectCreateNewDeck(shuffle bool, cards string, deck *dtos.RespCreateDeck, err error) *gomock.Call {
-	return m.ctrl.RecordCall(m, "CreateNewDeck", shuffle, cards).Return(deck, err)
+func (m *MockDeckService) ExpectCreateNewDeck(tenantId string, shuffle bool, cards string, metadata map[string]string, deck *dtos.RespCreateDeck, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "CreateNewDeck", gomock.Any(), tenantId, shuffle, cards, metadata).Return(deck, err)
 }
 
 // OpenDeck is a mock implementation of the OpenDeck method
-func (m *MockDeckService) OpenDeck(deckId string) (*dtos.RespOpenDeck, error) {
-	ret := m.ctrl.Call(m, "OpenDeck", deckId)
-	return ret[0].(*dtos.RespOpenDeck), nil
+func (m *MockDeckService) OpenDeck(ctx context.Context, tenantId string, deckId string) (*dtos.RespOpenDeck, error) {
+	ret := m.ctrl.Call(m, "OpenDeck", ctx, tenantId, deckId)
+	return ret[0].(*dtos.RespOpenDeck), toError(ret[1])
 }
 
 // ExpectOpenDeck is a helper method for configuring expectations for the OpenDeck method
-func (m *MockDeckService) ExpectOpenDeck(deckId string, resp *dtos.RespOpenDeck, err error) *gomock.Call {
-	return m.ctrl.RecordCall(m, "OpenDeck", deckId).Return(resp, err)
+func (m *MockDeckService) ExpectOpenDeck(tenantId string, deckId string, resp *dtos.RespOpenDeck, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "OpenDeck", gomock.Any(), tenantId, deckId).Return(resp, err)
 }
 
 // DrawCard is a mock implementation of the DrawCard method
-func (m *MockDeckService) DrawCard(deckId string, count int) (*dtos.RespDrawDeck, error) {
-	ret := m.ctrl.Call(m, "DrawCard", deckId, count)
-	return ret[0].(*dtos.RespDrawDeck), nil
+func (m *MockDeckService) DrawCard(ctx context.Context, tenantId string, deckId string, count int, version int) (*dtos.RespDrawDeck, error) {
+	ret := m.ctrl.Call(m, "DrawCard", ctx, tenantId, deckId, count, version)
+	return ret[0].(*dtos.RespDrawDeck), toError(ret[1])
 }
 
 // EXPECTDrawCard is a helper method for configuring expectations for the DrawCard method
-func (m *MockDeckService) ExpectDrawCard(deckId string, count int, resp *dtos.RespDrawDeck, err error) *gomock.Call {
-	return m.ctrl.RecordCall(m, "DrawCard", deckId, count).Return(resp, err)
+func (m *MockDeckService) ExpectDrawCard(tenantId string, deckId string, count int, version int, resp *dtos.RespDrawDeck, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "DrawCard", gomock.Any(), tenantId, deckId, count, version).Return(resp, err)
+}
+
+// ListDecks is a mock implementation of the ListDecks method
+func (m *MockDeckService) ListDecks(ctx context.Context, tenantId string, filter models.DeckFilter) (*dtos.RespListDecks, error) {
+	ret := m.ctrl.Call(m, "ListDecks", ctx, tenantId, filter)
+	return ret[0].(*dtos.RespListDecks), toError(ret[1])
+}
+
+// ExpectListDecks is a helper method for configuring expectations for the ListDecks method
+func (m *MockDeckService) ExpectListDecks(tenantId string, filter models.DeckFilter, resp *dtos.RespListDecks, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "ListDecks", gomock.Any(), tenantId, filter).Return(resp, err)
+}
+
+// UpdateDeck is a mock implementation of the UpdateDeck method
+func (m *MockDeckService) UpdateDeck(ctx context.Context, tenantId string, deckId string, update dtos.ReqUpdateDeck, version int) (*dtos.RespOpenDeck, error) {
+	ret := m.ctrl.Call(m, "UpdateDeck", ctx, tenantId, deckId, update, version)
+	return ret[0].(*dtos.RespOpenDeck), toError(ret[1])
+}
+
+// ExpectUpdateDeck is a helper method for configuring expectations for the UpdateDeck method
+func (m *MockDeckService) ExpectUpdateDeck(tenantId string, deckId string, update dtos.ReqUpdateDeck, version int, resp *dtos.RespOpenDeck, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "UpdateDeck", gomock.Any(), tenantId, deckId, update, version).Return(resp, err)
+}
+
+// DeleteDeck is a mock implementation of the DeleteDeck method
+func (m *MockDeckService) DeleteDeck(ctx context.Context, tenantId string, deckId string, version int) error {
+	ret := m.ctrl.Call(m, "DeleteDeck", ctx, tenantId, deckId, version)
+	return toError(ret[0])
+}
+
+// ExpectDeleteDeck is a helper method for configuring expectations for the DeleteDeck method
+func (m *MockDeckService) ExpectDeleteDeck(tenantId string, deckId string, version int, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "DeleteDeck", gomock.Any(), tenantId, deckId, version).Return(err)
+}
+
+// SubscribeDeckEvents is a mock implementation of the SubscribeDeckEvents method
+func (m *MockDeckService) SubscribeDeckEvents(ctx context.Context, tenantId string, deckId string) (*events.Subscription, error) {
+	ret := m.ctrl.Call(m, "SubscribeDeckEvents", ctx, tenantId, deckId)
+	sub, _ := ret[0].(*events.Subscription)
+	return sub, toError(ret[1])
+}
+
+// ExpectSubscribeDeckEvents is a helper method for configuring expectations for the SubscribeDeckEvents method
+func (m *MockDeckService) ExpectSubscribeDeckEvents(tenantId string, deckId string, sub *events.Subscription, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "SubscribeDeckEvents", gomock.Any(), tenantId, deckId).Return(sub, err)
+}
+
+// DeckHistory is a mock implementation of the DeckHistory method
+func (m *MockDeckService) DeckHistory(ctx context.Context, tenantId string, deckId string) (*dtos.RespDeckHistory, error) {
+	ret := m.ctrl.Call(m, "DeckHistory", ctx, tenantId, deckId)
+	history, _ := ret[0].(*dtos.RespDeckHistory)
+	return history, toError(ret[1])
+}
+
+// ExpectDeckHistory is a helper method for configuring expectations for the DeckHistory method
+func (m *MockDeckService) ExpectDeckHistory(tenantId string, deckId string, resp *dtos.RespDeckHistory, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "DeckHistory", gomock.Any(), tenantId, deckId).Return(resp, err)
+}
+
+// DeckStateAt is a mock implementation of the DeckStateAt method
+func (m *MockDeckService) DeckStateAt(ctx context.Context, tenantId string, deckId string, seq int) (*dtos.RespOpenDeck, error) {
+	ret := m.ctrl.Call(m, "DeckStateAt", ctx, tenantId, deckId, seq)
+	deck, _ := ret[0].(*dtos.RespOpenDeck)
+	return deck, toError(ret[1])
+}
+
+// ExpectDeckStateAt is a helper method for configuring expectations for the DeckStateAt method
+func (m *MockDeckService) ExpectDeckStateAt(tenantId string, deckId string, seq int, resp *dtos.RespOpenDeck, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "DeckStateAt", gomock.Any(), tenantId, deckId, seq).Return(resp, err)
+}
+
+// toError converts a recorded return value into an error
+func toError(ret interface{}) error {
+	if ret == nil {
+		return nil
+	}
+	return ret.(error)
 }
@@ -0,0 +1,59 @@
+package mock_services
+
+import (
+	"context"
+	"toggl/app/dtos"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+)
+
+// MockTenantService is a mock implementation of the TenantService interface
+type MockTenantService struct {
+	logger *logrus.Logger
+	ctrl   *gomock.Controller
+}
+
+// NewMockTenantService creates a new mock of the TenantService interface
+func NewMockTenantService(logger *logrus.Logger, ctrl *gomock.Controller) *MockTenantService {
+	return &MockTenantService{
+		logger: logger,
+		ctrl:   ctrl,
+	}
+}
+
+// ListTenants is a mock implementation of the ListTenants method
+func (m *MockTenantService) ListTenants(ctx context.Context) (*dtos.RespListTenants, error) {
+	ret := m.ctrl.Call(m, "ListTenants", ctx)
+	tenants, _ := ret[0].(*dtos.RespListTenants)
+	return tenants, toError(ret[1])
+}
+
+// ExpectListTenants is a helper method for configuring expectations for the ListTenants method
+func (m *MockTenantService) ExpectListTenants(resp *dtos.RespListTenants, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "ListTenants", gomock.Any()).Return(resp, err)
+}
+
+// TenantUsage is a mock implementation of the TenantUsage method
+func (m *MockTenantService) TenantUsage(ctx context.Context, tenantId string) (*dtos.RespTenantUsage, error) {
+	ret := m.ctrl.Call(m, "TenantUsage", ctx, tenantId)
+	usage, _ := ret[0].(*dtos.RespTenantUsage)
+	return usage, toError(ret[1])
+}
+
+// ExpectTenantUsage is a helper method for configuring expectations for the TenantUsage method
+func (m *MockTenantService) ExpectTenantUsage(tenantId string, resp *dtos.RespTenantUsage, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "TenantUsage", gomock.Any(), tenantId).Return(resp, err)
+}
+
+// UpdateTenant is a mock implementation of the UpdateTenant method
+func (m *MockTenantService) UpdateTenant(ctx context.Context, tenantId string, req dtos.ReqUpdateTenant) (*dtos.RespTenantUsage, error) {
+	ret := m.ctrl.Call(m, "UpdateTenant", ctx, tenantId, req)
+	usage, _ := ret[0].(*dtos.RespTenantUsage)
+	return usage, toError(ret[1])
+}
+
+// ExpectUpdateTenant is a helper method for configuring expectations for the UpdateTenant method
+func (m *MockTenantService) ExpectUpdateTenant(tenantId string, req dtos.ReqUpdateTenant, resp *dtos.RespTenantUsage, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "UpdateTenant", gomock.Any(), tenantId, req).Return(resp, err)
+}
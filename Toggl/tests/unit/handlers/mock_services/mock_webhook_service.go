@@ -0,0 +1,70 @@
+package mock_services
+
+import (
+	"context"
+	"toggl/app/dtos"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+)
+
+// MockWebhookService is a mock implementation of the WebhookService interface
+type MockWebhookService struct {
+	logger *logrus.Logger
+	ctrl   *gomock.Controller
+}
+
+// NewMockWebhookService creates a new mock of the WebhookService interface
+func NewMockWebhookService(logger *logrus.Logger, ctrl *gomock.Controller) *MockWebhookService {
+	return &MockWebhookService{
+		logger: logger,
+		ctrl:   ctrl,
+	}
+}
+
+// CreateWebhook is a mock implementation of the CreateWebhook method
+func (m *MockWebhookService) CreateWebhook(ctx context.Context, tenantId string, req dtos.ReqCreateWebhook) (*dtos.RespWebhook, error) {
+	ret := m.ctrl.Call(m, "CreateWebhook", ctx, tenantId, req)
+	webhook, _ := ret[0].(*dtos.RespWebhook)
+	return webhook, toError(ret[1])
+}
+
+// ExpectCreateWebhook is a helper method for configuring expectations for the CreateWebhook method
+func (m *MockWebhookService) ExpectCreateWebhook(tenantId string, req dtos.ReqCreateWebhook, resp *dtos.RespWebhook, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "CreateWebhook", gomock.Any(), tenantId, req).Return(resp, err)
+}
+
+// ListWebhooks is a mock implementation of the ListWebhooks method
+func (m *MockWebhookService) ListWebhooks(ctx context.Context, tenantId string) (*dtos.RespListWebhooks, error) {
+	ret := m.ctrl.Call(m, "ListWebhooks", ctx, tenantId)
+	webhooks, _ := ret[0].(*dtos.RespListWebhooks)
+	return webhooks, toError(ret[1])
+}
+
+// ExpectListWebhooks is a helper method for configuring expectations for the ListWebhooks method
+func (m *MockWebhookService) ExpectListWebhooks(tenantId string, resp *dtos.RespListWebhooks, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "ListWebhooks", gomock.Any(), tenantId).Return(resp, err)
+}
+
+// DeleteWebhook is a mock implementation of the DeleteWebhook method
+func (m *MockWebhookService) DeleteWebhook(ctx context.Context, tenantId string, webhookId string) error {
+	ret := m.ctrl.Call(m, "DeleteWebhook", ctx, tenantId, webhookId)
+	return toError(ret[0])
+}
+
+// ExpectDeleteWebhook is a helper method for configuring expectations for the DeleteWebhook method
+func (m *MockWebhookService) ExpectDeleteWebhook(tenantId string, webhookId string, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "DeleteWebhook", gomock.Any(), tenantId, webhookId).Return(err)
+}
+
+// ListDeliveries is a mock implementation of the ListDeliveries method
+func (m *MockWebhookService) ListDeliveries(ctx context.Context, tenantId string, webhookId string, limit int) (*dtos.RespWebhookDeliveries, error) {
+	ret := m.ctrl.Call(m, "ListDeliveries", ctx, tenantId, webhookId, limit)
+	deliveries, _ := ret[0].(*dtos.RespWebhookDeliveries)
+	return deliveries, toError(ret[1])
+}
+
+// ExpectListDeliveries is a helper method for configuring expectations for the ListDeliveries method
+func (m *MockWebhookService) ExpectListDeliveries(tenantId string, webhookId string, limit int, resp *dtos.RespWebhookDeliveries, err error) *gomock.Call {
+	return m.ctrl.RecordCall(m, "ListDeliveries", gomock.Any(), tenantId, webhookId, limit).Return(resp, err)
+}
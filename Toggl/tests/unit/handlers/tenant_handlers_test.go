@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"toggl/app/dtos"
+	"toggl/app/handlers"
+	"toggl/app/services"
+	"toggl/tests/unit/handlers/mock_services"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListTenantsHandlerReturnUsage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockTenantService := mock_services.NewMockTenantService(logger, ctrl)
+	mockTenantService.ExpectListTenants(&dtos.RespListTenants{Tenants: []dtos.RespTenantUsage{{
+		TenantID:  "team-a",
+		Decks:     2,
+		Cards:     60,
+		APIKeys:   1,
+		Webhooks:  0,
+		Limits:    dtos.RespTenantLimits{MaxDecks: 1000, MaxCardsPerDeck: 52},
+		CreatedAt: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+	}}}, nil)
+
+	handler := handlers.NewTenantHandler(mockTenantService, logger)
+
+	r, _ := http.NewRequest("GET", "/v1/admin/tenants", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListTenantsHandler(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	expected := `{"tenants":[{"tenant_id":"team-a","decks":2,"cards":60,"api_keys":1,"webhooks":0,` +
+		`"limits":{"max_decks":1000,"max_cards_per_deck":52},"created_at":"2023-05-01T12:00:00Z"}]}`
+	assert.Equal(t, expected, w.Body.String())
+}
+
+func TestTenantUsageHandlerWithUnknownTenantReturnNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockTenantService := mock_services.NewMockTenantService(logger, ctrl)
+	mockTenantService.ExpectTenantUsage("team-z", nil, services.ErrTenantNotFound)
+
+	handler := handlers.NewTenantHandler(mockTenantService, logger)
+
+	r, _ := http.NewRequest("GET", "/v1/admin/tenants/team-z", nil)
+	r = mux.SetURLVars(r, map[string]string{"tenant_id": "team-z"})
+	w := httptest.NewRecorder()
+
+	handler.TenantUsageHandler(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUpdateTenantHandlerSetsLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockTenantService := mock_services.NewMockTenantService(logger, ctrl)
+
+	maxCards := 312
+	mockTenantService.ExpectUpdateTenant("team-a", dtos.ReqUpdateTenant{MaxCardsPerDeck: &maxCards}, &dtos.RespTenantUsage{
+		TenantID:  "team-a",
+		Limits:    dtos.RespTenantLimits{MaxDecks: 1000, MaxCardsPerDeck: 312},
+		CreatedAt: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+	}, nil)
+
+	handler := handlers.NewTenantHandler(mockTenantService, logger)
+
+	r, _ := http.NewRequest("PUT", "/v1/admin/tenants/team-a", strings.NewReader(`{"max_cards_per_deck":312}`))
+	r.Header.Set("Content-Type", "application/json")
+	r = mux.SetURLVars(r, map[string]string{"tenant_id": "team-a"})
+	w := httptest.NewRecorder()
+
+	handler.UpdateTenantHandler(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"limits":{"max_decks":1000,"max_cards_per_deck":312}`)
+}
+
+func TestUpdateTenantHandlerWithNegativeLimitReturnFieldErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockTenantService := mock_services.NewMockTenantService(logger, ctrl)
+
+	handler := handlers.NewTenantHandler(mockTenantService, logger)
+
+	r, _ := http.NewRequest("PUT", "/v1/admin/tenants/team-a", strings.NewReader(`{"max_decks":-1}`))
+	r.Header.Set("Content-Type", "application/json")
+	r = mux.SetURLVars(r, map[string]string{"tenant_id": "team-a"})
+	w := httptest.NewRecorder()
+
+	handler.UpdateTenantHandler(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	expected := `{"error":"Invalid request body","fields":[{"field":"max_decks","message":"must not be negative"}]}`
+	assert.Equal(t, expected, strings.TrimSpace(w.Body.String()))
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"toggl/app/dtos"
+	"toggl/app/handlers"
+	"toggl/app/services"
+	"toggl/tests/unit/handlers/mock_services"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateWebhookHandlerReturnCreated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockWebhookService := mock_services.NewMockWebhookService(logger, ctrl)
+
+	req := dtos.ReqCreateWebhook{URL: "https://example.com/hooks", Events: []string{"deck.created"}}
+	mockWebhookService.ExpectCreateWebhook("", req, &dtos.RespWebhook{
+		ID:        "5f0c3a9e-0d6b-4c43-9f5e-0e6f7f0b6a11",
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    "secret",
+		CreatedAt: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+	}, nil)
+
+	handler := handlers.NewWebhookHandler(mockWebhookService, logger)
+
+	r, _ := http.NewRequest("POST", "/v1/webhooks", strings.NewReader(`{"url":"https://example.com/hooks","events":["deck.created"]}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CreateWebhookHandler(w, r)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	expected := `{"id":"5f0c3a9e-0d6b-4c43-9f5e-0e6f7f0b6a11","url":"https://example.com/hooks","events":["deck.created"],"secret":"secret","created_at":"2023-05-01T12:00:00Z"}`
+	assert.Equal(t, expected, w.Body.String())
+}
+
+func TestCreateWebhookHandlerWithInvalidBodyReturnFieldErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockWebhookService := mock_services.NewMockWebhookService(logger, ctrl)
+
+	handler := handlers.NewWebhookHandler(mockWebhookService, logger)
+
+	r, _ := http.NewRequest("POST", "/v1/webhooks", strings.NewReader(`{"url":"ftp://example.com","events":["deck.drawn"],"secret":"short"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CreateWebhookHandler(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	expected := `{"error":"Invalid request body","fields":[` +
+		`{"field":"url","message":"must be an absolute http or https URL"},` +
+		`{"field":"events[0]","message":"deck.drawn is not a webhook event"},` +
+		`{"field":"secret","message":"must be 16 to 256 characters"}]}`
+	assert.Equal(t, expected, strings.TrimSpace(w.Body.String()))
+}
+
+func TestCreateWebhookHandlerWithPrivateAddressReturnBadRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockWebhookService := mock_services.NewMockWebhookService(logger, ctrl)
+
+	handler := handlers.NewWebhookHandler(mockWebhookService, logger)
+
+	for _, target := range []string{"http://127.0.0.1:8080/hooks", "http://169.254.169.254/latest/meta-data", "https://10.0.0.7/hooks", "http://[::1]/hooks", "http://localhost/hooks"} {
+		r, _ := http.NewRequest("POST", "/v1/webhooks", strings.NewReader(`{"url":"`+target+`","events":["deck.created"]}`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler.CreateWebhookHandler(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		expected := `{"error":"Invalid request body","fields":[{"field":"url","message":"must not point at a loopback, private or link-local address"}]}`
+		assert.Equal(t, expected, strings.TrimSpace(w.Body.String()), target)
+	}
+}
+
+func TestListWebhookDeliveriesHandlerWithUnknownWebhookReturnNotFound(t *testing.T) {
+	var id = `5f0c3a9e-0d6b-4c43-9f5e-0e6f7f0b6a11`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockWebhookService := mock_services.NewMockWebhookService(logger, ctrl)
+	mockWebhookService.ExpectListDeliveries("", id, 10, nil, services.ErrWebhookNotFound)
+
+	handler := handlers.NewWebhookHandler(mockWebhookService, logger)
+
+	r, _ := http.NewRequest("GET", "/v1/webhooks/"+id+"/deliveries?limit=10", nil)
+	r = mux.SetURLVars(r, map[string]string{"webhook_id": id})
+	w := httptest.NewRecorder()
+
+	handler.ListWebhookDeliveriesHandler(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDeleteDeckHandlerReturnNoContent(t *testing.T) {
+	var id = `a251071b-662f-44b6-ba11-e24863039c59`
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := logrus.New()
+	mockDeckService := mock_services.NewMockDeckService(logger, ctrl)
+	mockDeckService.ExpectDeleteDeck("", id, 0, nil)
+
+	handler := handlers.NewDeckHandler(mockDeckService, logger)
+
+	r, _ := http.NewRequest("DELETE", "/v1/decks/"+id, nil)
+	r = mux.SetURLVars(r, map[string]string{"deck_id": id})
+	w := httptest.NewRecorder()
+
+	handler.DeleteDeckHandler(w, r)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 0, w.Body.Len())
+}
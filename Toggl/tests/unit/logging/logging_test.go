@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"toggl/app/auth"
+	"toggl/app/logging"
+	"toggl/app/middleware"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a logger configured with format and level, writing to the returned buffer
+func newTestLogger(t *testing.T, format string, level string) (*logrus.Logger, *bytes.Buffer) {
+	logger := logrus.New()
+	err := logging.Configure(logger, format, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	logger.SetOutput(&out)
+	return logger, &out
+}
+
+// the fields of the single JSON entry in out
+func decodeEntry(t *testing.T, out *bytes.Buffer) map[string]interface{} {
+	var entry map[string]interface{}
+	err := json.Unmarshal(out.Bytes(), &entry)
+	if err != nil {
+		t.Fatalf("%s: %q", err, out.String())
+	}
+	return entry
+}
+
+func TestEntriesCarryTheFieldsOfTheirContext(t *testing.T) {
+	logger, out := newTestLogger(t, logging.FormatJSON, "info")
+
+	ctx := logging.With(context.Background(), logging.RequestID, "req-1")
+	ctx = auth.NewContext(ctx, &auth.Principal{KeyID: "key-1", TenantID: "team-a"})
+	ctx = logging.With(ctx, logging.DeckID, "deck-1")
+	logger.WithContext(ctx).WithField("count", 2).Info("Cards drawn")
+
+	entry := decodeEntry(t, out)
+	assert.Equal(t, "Cards drawn", entry["msg"])
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "req-1", entry[logging.RequestID])
+	assert.Equal(t, "team-a", entry[logging.TenantID])
+	assert.Equal(t, "deck-1", entry[logging.DeckID])
+	assert.Equal(t, float64(2), entry["count"])
+}
+
+func TestWithLeavesTheParentContextAlone(t *testing.T) {
+	parent := logging.With(context.Background(), logging.RequestID, "req-1")
+	child := logging.With(parent, logging.DeckID, "deck-1")
+
+	assert.Equal(t, logrus.Fields{logging.RequestID: "req-1"}, logging.Fields(parent))
+	assert.Equal(t, logrus.Fields{logging.RequestID: "req-1", logging.DeckID: "deck-1"}, logging.Fields(child))
+}
+
+func TestEntryFieldsWinOverContextFields(t *testing.T) {
+	logger, out := newTestLogger(t, logging.FormatJSON, "info")
+
+	ctx := logging.With(context.Background(), logging.DeckID, "deck-1")
+	logger.WithContext(ctx).WithField(logging.DeckID, "deck-2").Info("Deck replaced")
+
+	assert.Equal(t, "deck-2", decodeEntry(t, out)[logging.DeckID])
+}
+
+func TestEntriesCarryTheIdsOfTheirTrace(t *testing.T) {
+	logger, out := newTestLogger(t, logging.FormatJSON, "info")
+
+	span := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01},
+		SpanID:  trace.SpanID{0x02},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), span)
+	logger.WithContext(ctx).Info("Traced")
+
+	entry := decodeEntry(t, out)
+	assert.Equal(t, span.TraceID().String(), entry[logging.TraceID])
+	assert.Equal(t, span.SpanID().String(), entry[logging.SpanID])
+}
+
+func TestRequestIdIsLoggedByHandlers(t *testing.T) {
+	logger, out := newTestLogger(t, logging.FormatJSON, "info")
+
+	handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.WithContext(r.Context()).Info("Handled")
+	}))
+	req, _ := http.NewRequest("GET", "/v1/decks", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "req-42", decodeEntry(t, out)[logging.RequestID])
+}
+
+func TestTextFormatAndLevel(t *testing.T) {
+	logger, out := newTestLogger(t, logging.FormatText, "warn")
+
+	ctx := logging.With(context.Background(), logging.DeckID, "deck-1")
+	logger.WithContext(ctx).Info("Not logged")
+	logger.WithContext(ctx).Warn("Deck event subscriber fell behind")
+
+	assert.NotContains(t, out.String(), "Not logged")
+	assert.Contains(t, out.String(), `level=warning msg="Deck event subscriber fell behind" deck_id=deck-1`)
+}
+
+func TestConfigureRejectsUnknownFormatsAndLevels(t *testing.T) {
+	assert.EqualError(t, logging.Configure(logrus.New(), "xml", "info"), `unknown log format "xml"`)
+	assert.Error(t, logging.Configure(logrus.New(), logging.FormatJSON, "loud"))
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"toggl/app/auth"
+	"toggl/app/middleware"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// an authenticator knowing a single key
+type staticAuthenticator struct{}
+
+func (staticAuthenticator) Authenticate(ctx context.Context, key string) (*auth.Principal, error) {
+	if key != "tk_valid" {
+		return nil, auth.ErrInvalidKey
+	}
+	return &auth.Principal{KeyID: "key-1", TenantID: "team-a"}, nil
+}
+
+// router answering with the tenant of the caller
+func newAuthRouter(required bool) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(middleware.APIKey(staticAuthenticator{}, required))
+	router.HandleFunc("/v1/test", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tenant=" + auth.TenantID(r.Context())))
+	})
+	return router
+}
+
+func TestAPIKeyAuthenticatesBearerAndHeaderKeys(t *testing.T) {
+	router := newAuthRouter(true)
+
+	req, _ := http.NewRequest("GET", "/v1/test", nil)
+	req.Header.Set("Authorization", "Bearer tk_valid")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "tenant=team-a", w.Body.String())
+
+	req, _ = http.NewRequest("GET", "/v1/test", nil)
+	req.Header.Set(middleware.APIKeyHeader, "tk_valid")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "tenant=team-a", w.Body.String())
+}
+
+func TestAPIKeyRejectsMissingAndInvalidKeys(t *testing.T) {
+	router := newAuthRouter(true)
+
+	req, _ := http.NewRequest("GET", "/v1/test", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="toggl"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, `{"error":"API key is required"}`, strings.TrimSpace(w.Body.String()))
+
+	req, _ = http.NewRequest("GET", "/v1/test", nil)
+	req.Header.Set("Authorization", "Bearer tk_revoked")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `{"error":"Invalid API key"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestAPIKeyOptionalLetsAnonymousRequestsThrough(t *testing.T) {
+	router := newAuthRouter(false)
+
+	req, _ := http.NewRequest("GET", "/v1/test", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "tenant=", w.Body.String())
+
+	// a key that is sent must still be valid
+	req.Header.Set(middleware.APIKeyHeader, "tk_revoked")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAdminKeyGuardsRoutes(t *testing.T) {
+	newAdminRouter := func(adminKey string) *mux.Router {
+		router := mux.NewRouter()
+		router.Use(middleware.AdminKey(adminKey))
+		router.HandleFunc("/v1/admin/test", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("admin"))
+		})
+		return router
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/admin/test", nil)
+	req.Header.Set("Authorization", "Bearer secret-admin-key")
+
+	// without an admin key configured the routes don't exist
+	w := httptest.NewRecorder()
+	newAdminRouter("").ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	newAdminRouter("other-admin-key").ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	newAdminRouter("secret-admin-key").ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "admin", w.Body.String())
+}
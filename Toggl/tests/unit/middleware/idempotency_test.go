@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"toggl/app/auth"
+	"toggl/app/config"
+	"toggl/app/middleware"
+	"toggl/app/repos"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// a repository on a fresh database
+func newIdempotencyStore(t *testing.T) *repos.Repository {
+	conf := &config.Config{Database: config.Database{TestPath: filepath.Join(t.TempDir(), "test.db")}}
+	return repos.NewRepository(logrus.New(), true, conf)
+}
+
+// a handler counting its calls, answering with the given status
+func countingHandler(calls *int, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call":%d}`, *calls)
+	})
+}
+
+func sendWithKey(handler http.Handler, key string, body string, tenantId string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/v1/draw-cards", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	}
+	if tenantId != "" {
+		req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{KeyID: "key-" + tenantId, TenantID: tenantId}))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysResponseOfRetries(t *testing.T) {
+	var calls int
+	handler := middleware.Idempotency(newIdempotencyStore(t), time.Hour, time.Minute, "api", logrus.New())(countingHandler(&calls, http.StatusOK))
+
+	body := `{"deck_id":"a251071b-662f-44b6-ba11-e24863039c59","count":1}`
+	first := sendWithKey(handler, "draw-1", body, "team-a")
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, `{"call":1}`, first.Body.String())
+	assert.Empty(t, first.Header().Get(middleware.IdempotentReplayedHeader))
+
+	retry := sendWithKey(handler, "draw-1", body, "team-a")
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, `{"call":1}`, retry.Body.String())
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	assert.Equal(t, "true", retry.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	// keys belong to a tenant, and requests without one are handled every time
+	assert.Equal(t, `{"call":2}`, sendWithKey(handler, "draw-1", body, "team-b").Body.String())
+	assert.Equal(t, `{"call":3}`, sendWithKey(handler, "", body, "team-a").Body.String())
+	assert.Equal(t, `{"call":4}`, sendWithKey(handler, "", body, "team-a").Body.String())
+}
+
+func TestIdempotencyRejectsKeyReusedForOtherRequest(t *testing.T) {
+	var calls int
+	handler := middleware.Idempotency(newIdempotencyStore(t), time.Hour, time.Minute, "api", logrus.New())(countingHandler(&calls, http.StatusOK))
+
+	sendWithKey(handler, "draw-1", `{"deck_id":"a251071b-662f-44b6-ba11-e24863039c59","count":1}`, "team-a")
+	w := sendWithKey(handler, "draw-1", `{"deck_id":"a251071b-662f-44b6-ba11-e24863039c59","count":5}`, "team-a")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, `{"error":"Idempotency-Key was used for a different request"}`, strings.TrimSpace(w.Body.String()))
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotencyRejectsKeyInProgress(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := middleware.Idempotency(newIdempotencyStore(t), time.Hour, time.Minute, "api", logrus.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	}))
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- sendWithKey(handler, "draw-1", `{}`, "team-a")
+	}()
+	<-started
+
+	w := sendWithKey(handler, "draw-1", `{}`, "team-a")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, `{"error":"A request with this Idempotency-Key is still in progress"}`, strings.TrimSpace(w.Body.String()))
+
+	close(release)
+	assert.Equal(t, "done", (<-done).Body.String())
+	assert.Equal(t, "done", sendWithKey(handler, "draw-1", `{}`, "team-a").Body.String())
+}
+
+func TestIdempotencyDoesNotKeepServerErrors(t *testing.T) {
+	var calls int
+	handler := middleware.Idempotency(newIdempotencyStore(t), time.Hour, time.Minute, "api", logrus.New())(countingHandler(&calls, http.StatusInternalServerError))
+
+	assert.Equal(t, `{"call":1}`, sendWithKey(handler, "draw-1", `{}`, "team-a").Body.String())
+	assert.Equal(t, `{"call":2}`, sendWithKey(handler, "draw-1", `{}`, "team-a").Body.String())
+}
+
+func TestIdempotencyForgetsKeysAfterWindow(t *testing.T) {
+	var calls int
+	handler := middleware.Idempotency(newIdempotencyStore(t), -time.Second, time.Minute, "api", logrus.New())(countingHandler(&calls, http.StatusOK))
+
+	assert.Equal(t, `{"call":1}`, sendWithKey(handler, "draw-1", `{}`, "team-a").Body.String())
+	assert.Equal(t, `{"call":2}`, sendWithKey(handler, "draw-1", `{}`, "team-a").Body.String())
+}
+
+func TestIdempotencyReplaysResponseHeaders(t *testing.T) {
+	var calls int
+	handler := middleware.Idempotency(newIdempotencyStore(t), time.Hour, time.Minute, "api", logrus.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Location", "/v1/decks/a251071b-662f-44b6-ba11-e24863039c59")
+		w.Header().Set("ETag", `"1"`)
+		w.Header().Set("RateLimit-Remaining", fmt.Sprint(10-calls))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}))
+
+	sendWithKey(handler, "create-1", `{}`, "team-a")
+	retry := sendWithKey(handler, "create-1", `{}`, "team-a")
+
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "/v1/decks/a251071b-662f-44b6-ba11-e24863039c59", retry.Header().Get("Location"))
+	assert.Equal(t, `"1"`, retry.Header().Get("ETag"))
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	// rate limits are those of the request at hand, a replay has none
+	assert.Empty(t, retry.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotencyFreesKeyOfAbandonedRequest(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	stuck := make(chan struct{})
+	defer close(stuck)
+	handler := middleware.Idempotency(newIdempotencyStore(t), time.Hour, 2*time.Second, "api", logrus.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// never finishes, like the request of a process that crashed
+			close(started)
+			<-stuck
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+
+	go sendWithKey(handler, "draw-1", `{}`, "team-a")
+	<-started
+	assert.Equal(t, http.StatusConflict, sendWithKey(handler, "draw-1", `{}`, "team-a").Code)
+
+	assert.Eventually(t, func() bool {
+		return sendWithKey(handler, "draw-1", `{}`, "team-a").Body.String() == "done"
+	}, 5*time.Second, 100*time.Millisecond)
+}
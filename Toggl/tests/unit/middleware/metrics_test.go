@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"toggl/app/metrics"
+	"toggl/app/middleware"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsCountsRequestsPerRouteTemplate(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(middleware.Metrics)
+	router.HandleFunc("/v1/metrics-test/{deck_id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["deck_id"] == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	for _, path := range []string{"/v1/metrics-test/a", "/v1/metrics-test/b", "/v1/metrics-test/missing"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `toggl_http_requests_total{method="GET",route="/v1/metrics-test/{deck_id}",status="200"} 2`)
+	assert.Contains(t, body, `toggl_http_requests_total{method="GET",route="/v1/metrics-test/{deck_id}",status="404"} 1`)
+	assert.Contains(t, body, `toggl_http_request_duration_seconds_count{method="GET",route="/v1/metrics-test/{deck_id}"} 3`)
+	assert.NotContains(t, body, "/v1/metrics-test/a")
+}
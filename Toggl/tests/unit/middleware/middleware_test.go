@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"toggl/app/middleware"
+	"toggl/app/render"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// router with the same middleware chain as the app
+func newRouter(logger *logrus.Logger, timeout time.Duration, handler http.HandlerFunc) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Use(middleware.AccessLog(logger))
+	router.Use(middleware.Recover(logger))
+
+	api := router.PathPrefix("/v1").Subrouter()
+	api.Use(middleware.Timeout(timeout))
+	api.HandleFunc("/test", handler)
+	return router
+}
+
+func TestRequestIdIsGeneratedAndLogged(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	var requestId string
+	router := newRouter(logger, time.Second, func(w http.ResponseWriter, r *http.Request) {
+		requestId = middleware.RequestIDFromContext(r.Context())
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	req, _ := http.NewRequest("GET", "/v1/test", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "created", w.Body.String())
+	assert.NotEmpty(t, requestId)
+	assert.Equal(t, requestId, w.Header().Get(middleware.RequestIDHeader))
+
+	entry := hook.LastEntry()
+	assert.Equal(t, "Request served", entry.Message)
+	assert.Equal(t, requestId, entry.Data["request_id"])
+	assert.Equal(t, http.StatusCreated, entry.Data["status"])
+	assert.Equal(t, "/v1/test", entry.Data["path"])
+}
+
+func TestRequestIdFromClientIsKept(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	router := newRouter(logger, time.Second, func(w http.ResponseWriter, r *http.Request) {})
+
+	req, _ := http.NewRequest("GET", "/v1/test", nil)
+	req.Header.Set(middleware.RequestIDHeader, "client-id")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "client-id", w.Header().Get(middleware.RequestIDHeader))
+}
+
+func TestPanicInHandlerReturnsJSONError(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	router := newRouter(logger, time.Second, func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	req, _ := http.NewRequest("GET", "/v1/test", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"error":"Internal server error"}`, strings.TrimSpace(w.Body.String()))
+
+	// the panic and the request are both logged
+	assert.Len(t, hook.Entries, 2)
+	assert.Equal(t, "boom", hook.Entries[0].Data["panic"])
+	assert.Equal(t, http.StatusInternalServerError, hook.Entries[1].Data["status"])
+}
+
+func TestSlowHandlerReturnsTimeoutError(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	router := newRouter(logger, 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.Write([]byte("too late"))
+	})
+
+	req, _ := http.NewRequest("GET", "/v1/test", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"error":"Request timed out"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestTimeoutAnswersTheSameWhetherHandlerOrMiddlewareNoticesFirst(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+	router := newRouter(logger, 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		render.ServerError(w, r, r.Context().Err())
+	})
+
+	req, _ := http.NewRequest("GET", "/v1/test", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, `{"error":"Request timed out"}`, strings.TrimSpace(w.Body.String()))
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"toggl/app/auth"
+	"toggl/app/middleware"
+	"toggl/app/ratelimit"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// a store that is unavailable
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store unavailable")
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+func TestRateLimitRejectsClientOverLimit(t *testing.T) {
+	limit := middleware.RateLimit(ratelimit.NewMemoryStore(), ratelimit.PerMinute(60, 2), middleware.ClientKey("draw"), logrus.New())
+	handler := limit(http.HandlerFunc(okHandler))
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/v1/draw-cards", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Reset"))
+
+	// another port of the same host shares the bucket
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:4321").Code)
+
+	w = send("10.0.0.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, `{"error":"Too many requests, retry in 1 seconds"}`, strings.TrimSpace(w.Body.String()))
+
+	// other clients aren't affected
+	assert.Equal(t, http.StatusOK, send("10.0.0.2:1234").Code)
+}
+
+func TestRateLimitSkipsAnonymousClientsOfTheUnixSocket(t *testing.T) {
+	limit := middleware.RateLimit(ratelimit.NewMemoryStore(), ratelimit.PerMinute(60, 1), middleware.ClientKey("draw"), logrus.New())
+	handler := limit(http.HandlerFunc(okHandler))
+
+	socket := &net.UnixAddr{Name: "/run/toggl.sock", Net: "unix"}
+	send := func(principal *auth.Principal) *httptest.ResponseRecorder {
+		ctx := context.WithValue(context.Background(), http.LocalAddrContextKey, socket)
+		if principal != nil {
+			ctx = auth.NewContext(ctx, principal)
+		}
+		// every client of the socket has the same remote address
+		req, _ := http.NewRequestWithContext(ctx, "POST", "/v1/draw-cards", nil)
+		req.RemoteAddr = "@"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		w := send(nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+
+	// clients with a key are still limited by it
+	principal := &auth.Principal{KeyID: "k1", TenantID: "t1"}
+	assert.Equal(t, http.StatusOK, send(principal).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(principal).Code)
+}
+
+func TestRateLimitKeysDrawsByDeck(t *testing.T) {
+	limit := middleware.RateLimit(ratelimit.NewMemoryStore(), ratelimit.PerMinute(60, 1), middleware.DrawDeckKey, logrus.New())
+	var body string
+	handler := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		body = string(data)
+	}))
+
+	send := func(deckId string) int {
+		req, _ := http.NewRequest("POST", "/v1/draw-cards", strings.NewReader(`{"deck_id":"`+deckId+`","count":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("a251071b-662f-44b6-ba11-e24863039c59"))
+	// the handler still gets the whole body
+	assert.Equal(t, `{"deck_id":"a251071b-662f-44b6-ba11-e24863039c59","count":1}`, body)
+	assert.Equal(t, http.StatusTooManyRequests, send("a251071b-662f-44b6-ba11-e24863039c59"))
+	assert.Equal(t, http.StatusOK, send("5f0c3a9e-0d6b-4c43-9f5e-0e6f7f0b6a11"))
+
+	// draws by query string use the same bucket
+	req, _ := http.NewRequest("POST", "/v1/draw-cards?deck_id=a251071b-662f-44b6-ba11-e24863039c59&count=1", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestRateLimitKeysDeckDrawsByTenant(t *testing.T) {
+	limit := middleware.RateLimit(ratelimit.NewMemoryStore(), ratelimit.PerMinute(60, 1), middleware.DrawDeckKey, logrus.New())
+	handler := limit(http.HandlerFunc(okHandler))
+
+	send := func(tenantId string) int {
+		req, _ := http.NewRequest("POST", "/v1/draw-cards?deck_id=a251071b-662f-44b6-ba11-e24863039c59&count=1", nil)
+		req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{KeyID: "key-" + tenantId, TenantID: tenantId}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("team-a"))
+	assert.Equal(t, http.StatusTooManyRequests, send("team-a"))
+
+	// the same deck id of another tenant has a bucket of its own
+	assert.Equal(t, http.StatusOK, send("team-b"))
+}
+
+func TestRateLimitLetsRequestsThroughWhenStoreFails(t *testing.T) {
+	limit := middleware.RateLimit(failingStore{}, ratelimit.PerMinute(60, 1), middleware.ClientKey("create"), logrus.New())
+	handler := limit(http.HandlerFunc(okHandler))
+
+	req, _ := http.NewRequest("POST", "/v1/create-deck", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitFollowsChangedLimit(t *testing.T) {
+	current := ratelimit.PerMinute(60, 1)
+	limit := middleware.RateLimit(ratelimit.NewMemoryStore(), ratelimit.LimitFunc(func() ratelimit.Limit { return current }), middleware.ClientKey("draw"), logrus.New())
+	handler := limit(http.HandlerFunc(okHandler))
+
+	send := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/v1/draw-cards", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send().Code)
+	assert.Equal(t, http.StatusTooManyRequests, send().Code)
+
+	// turned off
+	current = ratelimit.Limit{}
+	w := send()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
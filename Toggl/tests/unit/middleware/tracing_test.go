@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"toggl/app/config"
+	"toggl/app/middleware"
+	"toggl/app/tracing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingContinuesTraceOfCaller(t *testing.T) {
+	// no exporter, only the propagator is installed
+	stop, err := tracing.Setup(context.Background(), config.Tracing{})
+	assert.NoError(t, err)
+	defer stop(context.Background())
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	var handlerSpan trace.SpanContext
+	router := mux.NewRouter()
+	router.Use(middleware.Tracing)
+	router.HandleFunc("/v1/decks/{deck_id}", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusBadGateway)
+	}).Methods("GET")
+
+	req, _ := http.NewRequest("GET", "/v1/decks/a251071b-662f-44b6-ba11-e24863039c59", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "GET /v1/decks/{deck_id}", span.Name())
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+		assert.Equal(t, codes.Error, span.Status().Code)
+		assert.Equal(t, span.SpanContext().SpanID(), handlerSpan.SpanID())
+	}
+}
+
+func TestTracingWithUnknownExporterReturnError(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), config.Tracing{Exporter: "zipkin"})
+	assert.Error(t, err)
+}
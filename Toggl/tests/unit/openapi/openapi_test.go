@@ -0,0 +1,196 @@
+package openapi
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"toggl/app"
+	"toggl/app/config"
+	"toggl/app/openapi"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// the parts of the OpenAPI document the tests check
+type document struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadDocument(t *testing.T) document {
+	var doc document
+	err := json.Unmarshal(openapi.Spec(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// every route RegisterRoutes registers, with metrics and probes, as
+// "METHOD /path/{param}"
+func registeredRoutes(t *testing.T) (*mux.Router, []string) {
+	router := mux.NewRouter()
+	conf := &config.Config{MetricsPath: "/metrics"}
+	app.RegisterRoutes(router, nil, nil, nil, nil, nil, nil, nil, nil, logrus.New(), conf)
+
+	var routes []string
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// a subrouter, its routes are walked on their own
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			routes = append(routes, method+" "+path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router, routes
+}
+
+func TestSpecDocumentsEveryRoute(t *testing.T) {
+	doc := loadDocument(t)
+	_, routes := registeredRoutes(t)
+	assert.NotEmpty(t, routes)
+
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		_, ok := doc.Paths[path][strings.ToLower(method)]
+		assert.True(t, ok, "%s is not in openapi.json", route)
+	}
+
+	// and nothing that isn't served
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			assert.Contains(t, routes, strings.ToUpper(method)+" "+path, "openapi.json documents a route that isn't registered")
+		}
+	}
+}
+
+func TestSpecDescribesEveryDtoField(t *testing.T) {
+	doc := loadDocument(t)
+
+	// read the types from the source, so new DTOs are checked as well
+	packages, err := parser.ParseDir(token.NewFileSet(), "../../../app/dtos", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dtos := 0
+	for _, file := range packages["dtos"].Files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			spec, ok := node.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			object, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return false
+			}
+			dtos++
+
+			schema, ok := doc.Components.Schemas[spec.Name.Name]
+			if !assert.True(t, ok, "%s has no schema in openapi.json", spec.Name.Name) {
+				return false
+			}
+
+			fields := map[string]bool{}
+			for _, field := range object.Fields.List {
+				name := jsonName(field)
+				if name == "-" {
+					continue
+				}
+				fields[name] = true
+				assert.Contains(t, schema.Properties, name, "%s.%s is not in openapi.json", spec.Name.Name, name)
+			}
+			for name := range schema.Properties {
+				assert.True(t, fields[name], "openapi.json has %s.%s, which the DTO doesn't", spec.Name.Name, name)
+			}
+			return false
+		})
+	}
+	assert.NotZero(t, dtos)
+}
+
+// the name a struct field is encoded as in JSON
+func jsonName(field *ast.Field) string {
+	if field.Tag != nil {
+		tag := reflect.StructTag(strings.Trim(field.Tag.Value, "`")).Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name != "" {
+			return name
+		}
+	}
+	return field.Names[0].Name
+}
+
+func TestSpecReferencesResolve(t *testing.T) {
+	var doc map[string]interface{}
+	err := json.Unmarshal(openapi.Spec(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			if ref, ok := node["$ref"].(string); ok {
+				var target interface{} = doc
+				for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+					object, _ := target.(map[string]interface{})
+					target = object[key]
+				}
+				assert.NotNil(t, target, "%s doesn't resolve", ref)
+			}
+			for _, child := range node {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range node {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+}
+
+func TestSpecAndDocsAreServed(t *testing.T) {
+	router, _ := registeredRoutes(t)
+
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, openapi.Spec(), w.Body.Bytes())
+
+	req, _ = http.NewRequest("GET", "/docs", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `fetch("openapi.json")`)
+}
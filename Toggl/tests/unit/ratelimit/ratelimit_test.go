@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+	"toggl/app/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a memory store with a clock moved by the test
+func newStore() (*ratelimit.MemoryStore, *time.Time) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := ratelimit.NewMemoryStore()
+	store.Now = func() time.Time { return now }
+	return store, &now
+}
+
+func TestMemoryStoreAllowsBurstThenRejects(t *testing.T) {
+	store, _ := newStore()
+	limit := ratelimit.PerMinute(60, 3)
+
+	for i := 2; i >= 0; i-- {
+		result, err := store.Take(context.Background(), "client", limit)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	result, err := store.Take(context.Background(), "client", limit)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// other keys have their own bucket
+	result, _ = store.Take(context.Background(), "other", limit)
+	assert.True(t, result.Allowed)
+}
+
+func TestMemoryStoreRefillsOverTime(t *testing.T) {
+	store, now := newStore()
+	limit := ratelimit.PerMinute(60, 2)
+
+	store.Take(context.Background(), "client", limit)
+	store.Take(context.Background(), "client", limit)
+	result, _ := store.Take(context.Background(), "client", limit)
+	assert.False(t, result.Allowed)
+
+	// one token a second
+	*now = now.Add(time.Second)
+	result, _ = store.Take(context.Background(), "client", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// never more than the burst
+	*now = now.Add(time.Hour)
+	result, _ = store.Take(context.Background(), "client", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+}
+
+func TestDisabledLimit(t *testing.T) {
+	assert.False(t, ratelimit.PerMinute(0, 10).Enabled())
+	assert.False(t, ratelimit.PerMinute(60, 0).Enabled())
+	assert.True(t, ratelimit.PerMinute(60, 10).Enabled())
+}
@@ -1,16 +1,30 @@
 package services
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"toggl/app/auth"
 	"toggl/app/config"
+	"toggl/app/dtos"
+	"toggl/app/events"
+	"toggl/app/metrics"
+	"toggl/app/models"
 	"toggl/app/repos"
 	"toggl/app/services"
 	"toggl/app/utils"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestMain(m *testing.M) {
@@ -58,7 +72,7 @@ func createTempDB() (string, error) {
 
 func setConfig() (*config.Config, error) {
 
-	var conf, err = config.LoadConfig(true)
+	var conf, err = config.Load("../../../app/config/config.yml")
 	if err != nil {
 		return nil, err
 	}
@@ -75,10 +89,10 @@ func TestCheckIfCreateNewDeckReturnValidDeckId(t *testing.T) {
 	repo := repos.NewRepository(logger, true, conf)
 
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
 	// Call the CreateNewDeck method with false for shuffle
-	deck, err := service.CreateNewDeck(false, "")
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "", nil)
 
 	// Ensure that no error was returned
 	assert.NoError(t, err)
@@ -102,10 +116,10 @@ func TestCheckIfCreateNewDeckReturnValidRemainingForGivenCards(t *testing.T) {
 	repo := repos.NewRepository(logger, true, conf)
 
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
 	// Call the CreateNewDeck method with false for shuffle
-	deck, err := service.CreateNewDeck(false, sample)
+	deck, err := service.CreateNewDeck(context.Background(), "", false, sample, nil)
 
 	// Ensure that no error was returned
 	assert.NoError(t, err)
@@ -129,10 +143,10 @@ func TestCheckIfCreateNewDeckReturnInValidForInvalidCards(t *testing.T) {
 	repo := repos.NewRepository(logger, true, conf)
 
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
 	// Call the CreateNewDeck method with false for shuffle
-	_, errCn := service.CreateNewDeck(false, sample)
+	_, errCn := service.CreateNewDeck(context.Background(), "", false, sample, nil)
 
 	// Ensure that no error was returned
 	assert.EqualError(t, errCn, "Invalid card")
@@ -152,12 +166,12 @@ func TestCheckIfCreateNewDeckNonShufulledCardsSameOrder(t *testing.T) {
 	repo := repos.NewRepository(logger, true, conf)
 
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
 	// Call the CreateNewDeck method with false for shuffle
-	deck, _ := service.CreateNewDeck(false, stringSample)
+	deck, _ := service.CreateNewDeck(context.Background(), "", false, stringSample, nil)
 
-	deckOpend, _ := service.OpenDeck(deck.DeckID)
+	deckOpend, _ := service.OpenDeck(context.Background(), "", deck.DeckID)
 
 	for index, card := range deckOpend.Cards {
 
@@ -180,12 +194,12 @@ func TestCheckIfCreateNewDeckShufulledCardsDifferetOrder(t *testing.T) {
 	repo := repos.NewRepository(logger, true, conf)
 
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
 	// Call the CreateNewDeck method with true for shuffle
-	deck, _ := service.CreateNewDeck(shuffled, stringSample)
+	deck, _ := service.CreateNewDeck(context.Background(), "", shuffled, stringSample, nil)
 
-	deckOpend, _ := service.OpenDeck(deck.DeckID)
+	deckOpend, _ := service.OpenDeck(context.Background(), "", deck.DeckID)
 
 	for index, card := range deckOpend.Cards {
 
@@ -207,10 +221,10 @@ func TestCheckIfCreateNewDeckIfCodeSuitPositionChangeReturnError(t *testing.T) {
 	repo := repos.NewRepository(logger, true, conf)
 
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
 	// Call the CreateNewDeck method with false for shuffle
-	_, errCn := service.CreateNewDeck(false, sample)
+	_, errCn := service.CreateNewDeck(context.Background(), "", false, sample, nil)
 
 	// Ensure that no error was returned
 	assert.EqualError(t, errCn, "Invalid value")
@@ -232,12 +246,12 @@ func TestCheckIfOpenDeckWithValidIdReturnCorrectData(t *testing.T) {
 	repo := repos.NewRepository(logger, true, conf)
 
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
 	// Call the CreateNewDeck method with false for shuffle
-	deck, _ := service.CreateNewDeck(shuffled, stringSample)
+	deck, _ := service.CreateNewDeck(context.Background(), "", shuffled, stringSample, nil)
 	newDeckId := deck.DeckID
-	deckOpend, _ := service.OpenDeck(newDeckId)
+	deckOpend, _ := service.OpenDeck(context.Background(), "", newDeckId)
 
 	for index, card := range deckOpend.Cards {
 
@@ -263,10 +277,10 @@ func TestCheckIfOpenDeckWithNonExistIdReturnError(t *testing.T) {
 	repo := repos.NewRepository(logger, true, conf)
 
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
 	// Call the CreateNewDeck method with false for shuffle
-	_, errOd := service.OpenDeck(sample)
+	_, errOd := service.OpenDeck(context.Background(), "", sample)
 
 	// Ensure that no error was returned
 	assert.EqualError(t, errOd, "Id doesn't exist")
@@ -288,12 +302,12 @@ func TestCheckIfDrawCardWithValidIdReturnSuccess(t *testing.T) {
 	repo := repos.NewRepository(logger, true, conf)
 
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
 	// Call the CreateNewDeck method with false for shuffle
-	deck, _ := service.CreateNewDeck(shuffled, stringSample)
+	deck, _ := service.CreateNewDeck(context.Background(), "", shuffled, stringSample, nil)
 	newDeckId := deck.DeckID
-	drawnCards, _ := service.DrawCard(newDeckId, count)
+	drawnCards, _ := service.DrawCard(context.Background(), "", newDeckId, count, 0)
 
 	for index, card := range drawnCards.Cards {
 
@@ -317,12 +331,12 @@ func TestCheckIfDrawnCardWithMoreThanRemainingCountReturnError(t *testing.T) {
 	// Create a new repository in test mode
 	repo := repos.NewRepository(logger, true, conf)
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
 	// Call the CreateNewDeck method with false for shuffle
-	deck, _ := service.CreateNewDeck(shuffled, stringSample)
+	deck, _ := service.CreateNewDeck(context.Background(), "", shuffled, stringSample, nil)
 	newDeckId := deck.DeckID
-	_, errDc := service.DrawCard(newDeckId, count)
+	_, errDc := service.DrawCard(context.Background(), "", newDeckId, count, 0)
 
 	assert.EqualError(t, errDc, "Requested count exceeds remaining cards in deck")
 
@@ -340,10 +354,799 @@ func TestCheckIfDrawnCardsNonExisitingIdReturnError(t *testing.T) {
 	repo := repos.NewRepository(logger, true, conf)
 
 	// Create a new deck service using the repository
-	service := services.NewDeckService(logger, repo)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
 
-	_, errDc := service.DrawCard(sample, count)
+	_, errDc := service.DrawCard(context.Background(), "", sample, count, 0)
 
 	assert.EqualError(t, errDc, "Id doesn't exist")
 
 }
+
+func TestCheckIfListDecksFiltersAndPaginates(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	// Two shuffled decks and one unshuffled deck with a card drawn
+	_, err = service.CreateNewDeck(context.Background(), "", true, "", nil)
+	assert.NoError(t, err)
+	_, err = service.CreateNewDeck(context.Background(), "", true, "AS,2S", nil)
+	assert.NoError(t, err)
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "AS,2S,3S", nil)
+	assert.NoError(t, err)
+	_, err = service.DrawCard(context.Background(), "", deck.DeckID, 1, 0)
+	assert.NoError(t, err)
+
+	shuffled := true
+	page, err := service.ListDecks(context.Background(), "", models.DeckFilter{Shuffled: &shuffled, Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, page.Decks, 1)
+	assert.NotEmpty(t, page.NextCursor)
+
+	next, err := service.ListDecks(context.Background(), "", models.DeckFilter{Shuffled: &shuffled, Limit: 1, Cursor: page.NextCursor})
+	assert.NoError(t, err)
+	assert.Len(t, next.Decks, 1)
+	assert.Empty(t, next.NextCursor)
+	assert.NotEqual(t, page.Decks[0].DeckID, next.Decks[0].DeckID)
+
+	// the drawn card is reflected in the remaining filter
+	minRemaining, maxRemaining := 2, 2
+	decks, err := service.ListDecks(context.Background(), "", models.DeckFilter{MinRemaining: &minRemaining, MaxRemaining: &maxRemaining})
+	assert.NoError(t, err)
+	assert.Len(t, decks.Decks, 2)
+
+	unshuffled := false
+	decks, err = service.ListDecks(context.Background(), "", models.DeckFilter{Shuffled: &unshuffled, MaxRemaining: &maxRemaining})
+	assert.NoError(t, err)
+	assert.Len(t, decks.Decks, 1)
+	assert.Equal(t, deck.DeckID, decks.Decks[0].DeckID)
+	assert.Equal(t, 2, decks.Decks[0].Remaining)
+
+	createdAfter := time.Now().Add(time.Hour)
+	decks, err = service.ListDecks(context.Background(), "", models.DeckFilter{CreatedAfter: &createdAfter})
+	assert.NoError(t, err)
+	assert.Empty(t, decks.Decks)
+}
+
+func TestCheckIfListDecksKeepsSubSecondOrder(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	// decks created within the same second
+	var created []string
+	for i := 0; i < 3; i++ {
+		deck, err := service.CreateNewDeck(context.Background(), "", false, "AS", nil)
+		assert.NoError(t, err)
+		created = append(created, deck.DeckID)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// pages follow the order they were created in, not their ids
+	var listed []dtos.RespDeckSummary
+	filter := models.DeckFilter{Limit: 1}
+	for {
+		page, err := service.ListDecks(context.Background(), "", filter)
+		assert.NoError(t, err)
+		listed = append(listed, page.Decks...)
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+	if !assert.Len(t, listed, 3) {
+		return
+	}
+	for i, deck := range listed {
+		assert.Equal(t, created[i], deck.DeckID)
+	}
+
+	// the time filters compare below the second
+	createdAt := listed[1].CreatedAt
+	decks, err := service.ListDecks(context.Background(), "", models.DeckFilter{CreatedAfter: &createdAt})
+	assert.NoError(t, err)
+	if assert.Len(t, decks.Decks, 2) {
+		assert.Equal(t, created[1], decks.Decks[0].DeckID)
+		assert.Equal(t, created[2], decks.Decks[1].DeckID)
+	}
+
+	decks, err = service.ListDecks(context.Background(), "", models.DeckFilter{CreatedBefore: &createdAt})
+	assert.NoError(t, err)
+	if assert.Len(t, decks.Decks, 1) {
+		assert.Equal(t, created[0], decks.Decks[0].DeckID)
+	}
+}
+
+func TestCheckIfListDecksWithInvalidCursorReturnError(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	_, errLd := service.ListDecks(context.Background(), "", models.DeckFilter{Cursor: "not-a-cursor"})
+
+	assert.ErrorIs(t, errLd, services.ErrInvalidCursor)
+}
+
+func TestCheckIfDeckMetadataIsPersistedUpdatedAndFiltered(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "AS,2S", map[string]string{"table_id": "7", "game_type": "poker"})
+	assert.NoError(t, err)
+	assert.Equal(t, "7", deck.Metadata["table_id"])
+	_, err = service.CreateNewDeck(context.Background(), "", false, "AS,2S", map[string]string{"table_id": "8", "game_type": "poker"})
+	assert.NoError(t, err)
+
+	deckOpend, err := service.OpenDeck(context.Background(), "", deck.DeckID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"table_id": "7", "game_type": "poker"}, deckOpend.Metadata)
+
+	// update one key, remove another and add a new one
+	table, dealer := "9", "bob"
+	updated, err := service.UpdateDeck(context.Background(), "", deck.DeckID, dtos.ReqUpdateDeck{
+		Metadata: map[string]*string{"table_id": &table, "game_type": nil, "dealer": &dealer},
+	}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"table_id": "9", "dealer": "bob"}, updated.Metadata)
+
+	deckOpend, err = service.OpenDeck(context.Background(), "", deck.DeckID)
+	assert.NoError(t, err)
+	assert.Equal(t, updated.Metadata, deckOpend.Metadata)
+
+	decks, err := service.ListDecks(context.Background(), "", models.DeckFilter{Metadata: map[string]string{"game_type": "poker"}})
+	assert.NoError(t, err)
+	assert.Len(t, decks.Decks, 1)
+	assert.Equal(t, "8", decks.Decks[0].Metadata["table_id"])
+
+	decks, err = service.ListDecks(context.Background(), "", models.DeckFilter{Metadata: map[string]string{"table_id": "9", "dealer": "bob"}})
+	assert.NoError(t, err)
+	assert.Len(t, decks.Decks, 1)
+	assert.Equal(t, deck.DeckID, decks.Decks[0].DeckID)
+}
+
+func TestCheckIfInvalidDeckMetadataReturnError(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	_, errCn := service.CreateNewDeck(context.Background(), "", false, "", map[string]string{"": "empty key"})
+	assert.ErrorIs(t, errCn, services.ErrInvalidMetadata)
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "", nil)
+	assert.NoError(t, err)
+	value := strings.Repeat("x", services.MaxMetadataValueLength+1)
+	_, errUd := service.UpdateDeck(context.Background(), "", deck.DeckID, dtos.ReqUpdateDeck{Metadata: map[string]*string{"note": &value}}, 0)
+	assert.ErrorIs(t, errUd, services.ErrInvalidMetadata)
+
+	_, errUd = service.UpdateDeck(context.Background(), "", "a251071b-662f-44b6-ba11-e24863039c59", dtos.ReqUpdateDeck{}, 0)
+	assert.ErrorIs(t, errUd, services.ErrDeckNotFound)
+}
+
+func TestCheckIfCreateNewDeckWithSingleCardReturnOneCard(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "AS", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deck.Remaining)
+}
+
+func TestCheckIfDrawCardPublishesDeckEvent(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "AS,2S,3S", nil)
+	assert.NoError(t, err)
+
+	sub, err := service.SubscribeDeckEvents(context.Background(), "", deck.DeckID)
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	_, err = service.DrawCard(context.Background(), "", deck.DeckID, 2, 0)
+	assert.NoError(t, err)
+
+	event := <-sub.Events()
+	assert.Equal(t, models.CardsDrawn, event.Type)
+	assert.Equal(t, deck.DeckID, event.DeckID)
+	assert.Equal(t, 1, event.Remaining)
+	assert.Equal(t, "AS", event.Cards[0].Code)
+	assert.Equal(t, "2S", event.Cards[1].Code)
+
+	_, err = service.SubscribeDeckEvents(context.Background(), "", "a251071b-662f-44b6-ba11-e24863039c59")
+	assert.ErrorIs(t, err, services.ErrDeckNotFound)
+}
+
+func TestCheckIfDeckHistoryReplaysDeckState(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "AS,2S,3S", map[string]string{"table_id": "7"})
+	assert.NoError(t, err)
+	_, err = service.DrawCard(context.Background(), "", deck.DeckID, 2, 0)
+	assert.NoError(t, err)
+	_, err = service.UpdateDeck(context.Background(), "", deck.DeckID, dtos.ReqUpdateDeck{Metadata: map[string]*string{"table_id": nil}}, 0)
+	assert.NoError(t, err)
+
+	history, err := service.DeckHistory(context.Background(), "", deck.DeckID)
+	assert.NoError(t, err)
+	assert.Len(t, history.Events, 3)
+	assert.Equal(t, models.DeckCreated, history.Events[0].Type)
+	assert.Equal(t, 1, history.Events[0].Seq)
+	assert.Len(t, history.Events[0].Cards, 3)
+	assert.Equal(t, models.CardsDrawn, history.Events[1].Type)
+	assert.Equal(t, 1, history.Events[1].Remaining)
+	assert.Equal(t, models.DeckUpdated, history.Events[2].Type)
+	assert.Nil(t, history.Events[2].Metadata)
+
+	// right after creation all cards are in the deck
+	state, err := service.DeckStateAt(context.Background(), "", deck.DeckID, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, state.Remaining)
+	assert.Equal(t, "7", state.Metadata["table_id"])
+
+	// after the draw only the last card is left
+	state, err = service.DeckStateAt(context.Background(), "", deck.DeckID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, state.Remaining)
+	assert.Equal(t, "3S", state.Cards[0].Code)
+
+	// the last event matches the current deck
+	state, err = service.DeckStateAt(context.Background(), "", deck.DeckID, 3)
+	assert.NoError(t, err)
+	current, err := service.OpenDeck(context.Background(), "", deck.DeckID)
+	assert.NoError(t, err)
+	assert.Equal(t, current.Cards, state.Cards)
+	assert.Nil(t, state.Metadata)
+
+	_, err = service.DeckStateAt(context.Background(), "", deck.DeckID, 4)
+	assert.ErrorIs(t, err, services.ErrEventNotFound)
+	_, err = service.DeckHistory(context.Background(), "", "a251071b-662f-44b6-ba11-e24863039c59")
+	assert.ErrorIs(t, err, services.ErrDeckNotFound)
+}
+
+func TestCheckIfDeckHistorySurvivesRestart(t *testing.T) {
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	repo := repos.NewRepository(logger, true, conf)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "AS,2S,3S", nil)
+	assert.NoError(t, err)
+	_, err = service.DrawCard(context.Background(), "", deck.DeckID, 2, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Close())
+
+	// opening the database again clears the decks, not their history
+	repo = repos.NewRepository(logger, true, conf)
+	service = services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	history, err := service.DeckHistory(context.Background(), "", deck.DeckID)
+	assert.NoError(t, err)
+	assert.Len(t, history.Events, 2)
+	assert.Equal(t, models.CardsDrawn, history.Events[1].Type)
+}
+
+func TestCheckIfDecksAreOnlyVisibleToTheirTenant(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	deck, err := service.CreateNewDeck(context.Background(), "team-a", false, "AS,2S", nil)
+	assert.NoError(t, err)
+
+	_, err = service.OpenDeck(context.Background(), "team-b", deck.DeckID)
+	assert.ErrorIs(t, err, services.ErrDeckNotFound)
+	_, err = service.DrawCard(context.Background(), "team-b", deck.DeckID, 1, 0)
+	assert.ErrorIs(t, err, services.ErrDeckNotFound)
+	_, err = service.DrawCard(context.Background(), "", deck.DeckID, 1, 0)
+	assert.ErrorIs(t, err, services.ErrDeckNotFound)
+	_, err = service.DeckHistory(context.Background(), "team-b", deck.DeckID)
+	assert.ErrorIs(t, err, services.ErrDeckNotFound)
+	assert.ErrorIs(t, service.DeleteDeck(context.Background(), "team-b", deck.DeckID, 0), services.ErrDeckNotFound)
+
+	list, err := service.ListDecks(context.Background(), "team-b", models.DeckFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Decks, 0)
+
+	// the owner still has the whole deck
+	opened, err := service.OpenDeck(context.Background(), "team-a", deck.DeckID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, opened.Remaining)
+	list, err = service.ListDecks(context.Background(), "team-a", models.DeckFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Decks, 1)
+}
+
+func TestCheckIfAPIKeysAuthenticateUntilRevoked(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new auth service using the repository
+	service := services.NewAuthService(logger, repo)
+
+	apiKey, err := service.CreateAPIKey(context.Background(), dtos.ReqCreateAPIKey{TenantID: "team-a", Name: "dealer"})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(apiKey.Key, auth.KeyPrefix))
+
+	principal, err := service.Authenticate(context.Background(), apiKey.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", principal.TenantID)
+	assert.Equal(t, apiKey.ID, principal.KeyID)
+
+	_, err = service.Authenticate(context.Background(), apiKey.Key+"x")
+	assert.ErrorIs(t, err, auth.ErrInvalidKey)
+
+	assert.NoError(t, service.RevokeAPIKey(context.Background(), apiKey.ID))
+	_, err = service.Authenticate(context.Background(), apiKey.Key)
+	assert.ErrorIs(t, err, auth.ErrInvalidKey)
+	assert.ErrorIs(t, service.RevokeAPIKey(context.Background(), apiKey.ID), services.ErrAPIKeyNotFound)
+}
+
+func TestCheckIfTenantLimitsAreEnforced(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	// a fresh database, tenants are kept between repositories
+	conf := &config.Config{
+		Database:          config.Database{TestPath: filepath.Join(t.TempDir(), "test.db")},
+		MaxDecksPerTenant: 2,
+		MaxCardsPerDeck:   52,
+	}
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create new deck and tenant services using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+	tenants := services.NewTenantService(logger, repo)
+
+	// more cards than a deck may hold
+	_, err := service.CreateNewDeck(context.Background(), "team-a", false, strings.Repeat("AS,", 52)+"AS", nil)
+	assert.ErrorIs(t, err, services.ErrTooManyCards)
+
+	// the third deck is over the default limit
+	_, err = service.CreateNewDeck(context.Background(), "team-a", false, "", nil)
+	assert.NoError(t, err)
+	_, err = service.CreateNewDeck(context.Background(), "team-a", false, "AS,2S", nil)
+	assert.NoError(t, err)
+	_, err = service.CreateNewDeck(context.Background(), "team-a", false, "AS", nil)
+	assert.ErrorIs(t, err, services.ErrDeckLimitReached)
+
+	// other tenants have their own limits
+	_, err = service.CreateNewDeck(context.Background(), "team-b", false, "AS", nil)
+	assert.NoError(t, err)
+
+	// raise the limits of the tenant
+	maxDecks, maxCards := 3, 104
+	usage, err := tenants.UpdateTenant(context.Background(), "team-a", dtos.ReqUpdateTenant{MaxDecks: &maxDecks, MaxCardsPerDeck: &maxCards})
+	assert.NoError(t, err)
+	assert.Equal(t, dtos.RespTenantLimits{MaxDecks: 3, MaxCardsPerDeck: 104}, usage.Limits)
+
+	deck, err := service.CreateNewDeck(context.Background(), "team-a", false, strings.Repeat("AS,", 52)+"AS", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 53, deck.Remaining)
+
+	// deleting a deck makes room for another
+	_, err = service.CreateNewDeck(context.Background(), "team-a", false, "AS", nil)
+	assert.ErrorIs(t, err, services.ErrDeckLimitReached)
+	assert.NoError(t, service.DeleteDeck(context.Background(), "team-a", deck.DeckID, 0))
+	deck, err = service.CreateNewDeck(context.Background(), "team-a", false, "AS", nil)
+	assert.NoError(t, err)
+
+	// and so does drawing the last card of one
+	_, err = service.CreateNewDeck(context.Background(), "team-a", false, "AS", nil)
+	assert.ErrorIs(t, err, services.ErrDeckLimitReached)
+	_, err = service.DrawCard(context.Background(), "team-a", deck.DeckID, 1, 0)
+	assert.NoError(t, err)
+	_, err = service.CreateNewDeck(context.Background(), "team-a", false, "AS", nil)
+	assert.NoError(t, err)
+}
+
+func TestCheckIfTenantUsageIsReported(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf := &config.Config{
+		Database:          config.Database{TestPath: filepath.Join(t.TempDir(), "test.db")},
+		MaxDecksPerTenant: 10,
+		MaxCardsPerDeck:   52,
+	}
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create the services using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+	tenants := services.NewTenantService(logger, repo)
+	authService := services.NewAuthService(logger, repo)
+
+	_, err := authService.CreateAPIKey(context.Background(), dtos.ReqCreateAPIKey{TenantID: "team-b", Name: "dealer"})
+	assert.NoError(t, err)
+	deck, err := service.CreateNewDeck(context.Background(), "team-a", false, "", nil)
+	assert.NoError(t, err)
+	small, err := service.CreateNewDeck(context.Background(), "team-a", false, "AS,2S", nil)
+	assert.NoError(t, err)
+	_, err = service.DrawCard(context.Background(), "team-a", deck.DeckID, 2, 0)
+	assert.NoError(t, err)
+
+	list, err := tenants.ListTenants(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, list.Tenants, 2)
+
+	teamA := list.Tenants[0]
+	assert.Equal(t, "team-a", teamA.TenantID)
+	assert.Equal(t, 2, teamA.Decks)
+	assert.Equal(t, 52, teamA.Cards)
+	assert.Equal(t, 0, teamA.APIKeys)
+	assert.Equal(t, dtos.RespTenantLimits{MaxDecks: 10, MaxCardsPerDeck: 52}, teamA.Limits)
+
+	// like the deck limit, decks without cards left aren't counted
+	_, err = service.DrawCard(context.Background(), "team-a", small.DeckID, 2, 0)
+	assert.NoError(t, err)
+	usage, err := tenants.TenantUsage(context.Background(), "team-a")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, usage.Decks)
+	assert.Equal(t, 50, usage.Cards)
+
+	teamB, err := tenants.TenantUsage(context.Background(), "team-b")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, teamB.Decks)
+	assert.Equal(t, 1, teamB.APIKeys)
+
+	_, err = tenants.TenantUsage(context.Background(), "team-z")
+	assert.ErrorIs(t, err, services.ErrTenantNotFound)
+}
+
+func TestCheckIfDeckVersionsGuardConcurrentChanges(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	// Create a new repository in test mode
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "AS,2S,3S", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deck.Version)
+
+	// every change moves the deck to a new version
+	drawn, err := service.DrawCard(context.Background(), "", deck.DeckID, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, drawn.Version)
+
+	table := "9"
+	updated, err := service.UpdateDeck(context.Background(), "", deck.DeckID, dtos.ReqUpdateDeck{Metadata: map[string]*string{"table_id": &table}}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, updated.Version)
+
+	deckOpend, err := service.OpenDeck(context.Background(), "", deck.DeckID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deckOpend.Version)
+
+	// changes made against an older version are refused
+	_, err = service.DrawCard(context.Background(), "", deck.DeckID, 1, 2)
+	assert.ErrorIs(t, err, services.ErrVersionMismatch)
+	_, err = service.UpdateDeck(context.Background(), "", deck.DeckID, dtos.ReqUpdateDeck{}, 1)
+	assert.ErrorIs(t, err, services.ErrVersionMismatch)
+	assert.ErrorIs(t, service.DeleteDeck(context.Background(), "", deck.DeckID, 2), services.ErrVersionMismatch)
+
+	deckOpend, err = service.OpenDeck(context.Background(), "", deck.DeckID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deckOpend.Remaining)
+
+	// without a version changes always apply
+	drawn, err = service.DrawCard(context.Background(), "", deck.DeckID, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, drawn.Version)
+	assert.NoError(t, service.DeleteDeck(context.Background(), "", deck.DeckID, 4))
+}
+
+// current value of a counter or gauge of the service, zero when not reported
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := metrics.Registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	next:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue next
+				}
+			}
+			if metric.GetCounter() != nil {
+				return metric.GetCounter().GetValue()
+			}
+			return metric.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestCheckIfDeckMetricsAreRecorded(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf := &config.Config{Database: config.Database{TestPath: filepath.Join(t.TempDir(), "test.db")}}
+	repo := repos.NewRepository(logger, true, conf)
+	metrics.CountDecksWith(repo.CountDecks)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	shuffled := metricValue(t, "toggl_decks_created_total", map[string]string{"shuffled": "true"})
+	drawn := metricValue(t, "toggl_cards_drawn_total", nil)
+	notEnough := metricValue(t, "toggl_draw_failures_total", map[string]string{"reason": metrics.DrawNotEnoughCards})
+	notFound := metricValue(t, "toggl_draw_failures_total", map[string]string{"reason": metrics.DrawNotFound})
+
+	deck, err := service.CreateNewDeck(context.Background(), "", true, "AS,2S,3S", nil)
+	assert.NoError(t, err)
+	_, err = service.CreateNewDeck(context.Background(), "", false, "AS", nil)
+	assert.NoError(t, err)
+
+	_, err = service.DrawCard(context.Background(), "", deck.DeckID, 2, 0)
+	assert.NoError(t, err)
+	_, err = service.DrawCard(context.Background(), "", deck.DeckID, 2, 0)
+	assert.ErrorIs(t, err, services.ErrNotEnoughCards)
+	_, err = service.DrawCard(context.Background(), "", "a251071b-662f-44b6-ba11-e24863039c59", 1, 0)
+	assert.ErrorIs(t, err, services.ErrDeckNotFound)
+
+	assert.Equal(t, shuffled+1, metricValue(t, "toggl_decks_created_total", map[string]string{"shuffled": "true"}))
+	assert.Equal(t, drawn+2, metricValue(t, "toggl_cards_drawn_total", nil))
+	assert.Equal(t, notEnough+1, metricValue(t, "toggl_draw_failures_total", map[string]string{"reason": metrics.DrawNotEnoughCards}))
+	assert.Equal(t, notFound+1, metricValue(t, "toggl_draw_failures_total", map[string]string{"reason": metrics.DrawNotFound}))
+	assert.Equal(t, 2.0, metricValue(t, "toggl_decks", nil))
+}
+
+func TestCheckIfDrawIsTracedThroughServiceAndRepository(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	// Create a new logger
+	logger := logrus.New()
+
+	conf := &config.Config{Database: config.Database{TestPath: filepath.Join(t.TempDir(), "test.db")}}
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "AS,2S", nil)
+	assert.NoError(t, err)
+
+	ctx, request := otel.Tracer("test").Start(context.Background(), "request")
+	_, err = service.DrawCard(ctx, "", deck.DeckID, 1, 0)
+	assert.NoError(t, err)
+	request.End()
+
+	// every span of the draw belongs to the trace of the request
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() == request.SpanContext().TraceID() {
+			spans[span.Name()] = span
+		}
+	}
+	assert.Equal(t, request.SpanContext().SpanID(), spans["DeckService.DrawCard"].Parent().SpanID())
+	serviceSpan := spans["DeckService.DrawCard"].SpanContext().SpanID()
+	for _, query := range []string{"repository.check_deck_exist", "repository.draw_card"} {
+		if assert.Contains(t, spans, query) {
+			assert.Equal(t, serviceSpan, spans[query].Parent().SpanID())
+		}
+	}
+}
+
+func TestCheckIfCancelledContextStopsQueries(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf := &config.Config{Database: config.Database{TestPath: filepath.Join(t.TempDir(), "test.db")}}
+	repo := repos.NewRepository(logger, true, conf)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "AS,2S", nil)
+	assert.NoError(t, err)
+
+	// the client went away
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = service.DrawCard(cancelled, "", deck.DeckID, 1, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the deadline of the request passed
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = service.CreateNewDeck(expired, "", false, "AS", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// nothing was drawn or created
+	deckOpend, err := service.OpenDeck(context.Background(), "", deck.DeckID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deckOpend.Remaining)
+	decks, err := service.ListDecks(context.Background(), "", models.DeckFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, decks.Decks, 1)
+}
+
+func TestCheckIfRepositoryIsReadyOnceMigrated(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	conf := &config.Config{Database: config.Database{TestPath: filepath.Join(t.TempDir(), "test.db")}}
+	repo := repos.NewRepository(logger, true, conf)
+
+	assert.NoError(t, repo.CheckSchema(context.Background()))
+
+	// a database left behind by an older release
+	db, err := sql.Open("sqlite3", conf.Database.TestPath)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`PRAGMA user_version = 1`)
+	assert.NoError(t, err)
+
+	assert.Error(t, repo.CheckSchema(context.Background()))
+}
+
+func TestCheckIfReloadedTenantLimitsApplyRightAway(t *testing.T) {
+	// Create a new logger
+	logger := logrus.New()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	err := os.WriteFile(path, []byte("MaxCardsPerDeck: 2\nRequireAPIKey: false\nDatabase:\n   TestPath: "+dbPath+"\n"), 0o600)
+	assert.NoError(t, err)
+	conf, err := config.Load(path)
+	assert.NoError(t, err)
+	live := config.NewLive(conf)
+	repo := repos.NewRepository(logger, true, live)
+
+	// Create a new deck service using the repository
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	_, err = service.CreateNewDeck(context.Background(), "", false, "AS,2S,3S", nil)
+	assert.ErrorIs(t, err, services.ErrTooManyCards)
+
+	err = os.WriteFile(path, []byte("MaxCardsPerDeck: 3\nRequireAPIKey: false\nDatabase:\n   TestPath: "+dbPath+"\n"), 0o600)
+	assert.NoError(t, err)
+	_, _, err = live.Reload(path)
+	assert.NoError(t, err)
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "AS,2S,3S", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deck.Remaining)
+}
+
+func TestCheckIfParallelDrawsDrawEveryCardOnce(t *testing.T) {
+	// more draws than the deck has cards for
+	var draws = 30
+	var count = 2
+	logger := logrus.New()
+
+	conf, err := setConfig()
+	assert.NoError(t, err)
+	repo := repos.NewRepository(logger, true, conf)
+	service := services.NewDeckService(logger, repo, events.NewBroker(0))
+
+	deck, err := service.CreateNewDeck(context.Background(), "", false, "", nil)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	drawn := map[string]int{}
+	errs := make(chan error, draws)
+	for i := 0; i < draws; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cards, err := service.DrawCard(context.Background(), "", deck.DeckID, count, 0)
+			if err != nil {
+				errs <- err
+				return
+			}
+			// no draw comes back short
+			assert.Len(t, cards.Cards, count)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, card := range cards.Cards {
+				drawn[card.Code]++
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// the draws the deck had no cards left for are refused, nothing else fails
+	refused := 0
+	for err := range errs {
+		assert.ErrorIs(t, err, services.ErrNotEnoughCards)
+		refused++
+	}
+	assert.Equal(t, draws-52/count, refused)
+
+	// no card is drawn twice and none is lost
+	assert.Len(t, drawn, 52)
+	for code, times := range drawn {
+		assert.Equal(t, 1, times, "%s was drawn more than once", code)
+	}
+
+	opened, err := service.OpenDeck(context.Background(), "", deck.DeckID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, opened.Remaining)
+}
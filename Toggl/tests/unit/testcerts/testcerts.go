@@ -0,0 +1,125 @@
+package testcerts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A self-signed CA writing the certificates it issues as PEM files to a
+// directory of the test
+type CA struct {
+	// the PEM file of the CA certificate
+	File string
+
+	t    testing.TB
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// Create a CA named name, its certificate written to name.pem
+func NewCA(t testing.TB, dir string, name string) *CA {
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          newSerial(t),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := &CA{File: filepath.Join(dir, name+".pem"), t: t, dir: dir, cert: cert, key: key}
+	writePEM(t, ca.File, "CERTIFICATE", der)
+	return ca
+}
+
+// A pool trusting the CA
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// Issue a certificate for localhost named name, good for servers and clients.
+// It is written to name.pem and its key to name-key.pem, replacing what was
+// there.
+func (ca *CA) Issue(name string) (certFile string, keyFile string) {
+	key := newKey(ca.t)
+	template := &x509.Certificate{
+		SerialNumber: newSerial(ca.t),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+
+	certFile = filepath.Join(ca.dir, name+".pem")
+	keyFile = filepath.Join(ca.dir, name+"-key.pem")
+	writePEM(ca.t, keyFile, "EC PRIVATE KEY", keyDer)
+	writePEM(ca.t, certFile, "CERTIFICATE", der)
+	return certFile, keyFile
+}
+
+// Issue a certificate named name for a client to present
+func (ca *CA) ClientCertificate(name string) tls.Certificate {
+	cert, err := tls.LoadX509KeyPair(ca.Issue(name))
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	return cert
+}
+
+func newKey(t testing.TB) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newSerial(t testing.TB) *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serial
+}
+
+func writePEM(t testing.TB, path string, blockType string, der []byte) {
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
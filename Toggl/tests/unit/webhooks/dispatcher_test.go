@@ -0,0 +1,289 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"toggl/app/config"
+	"toggl/app/dtos"
+	"toggl/app/events"
+	"toggl/app/models"
+	"toggl/app/repos"
+	"toggl/app/services"
+	"toggl/app/webhooks"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// a receiver recording the requests it gets, failing the first ones
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setup services on a database of their own, with a running dispatcher
+// sending to test servers on loopback
+func setup(t *testing.T) (*services.DeckServiceImpl, *services.WebhookServiceImpl) {
+	return setupDispatcher(t, true)
+}
+
+func setupDispatcher(t *testing.T, allowPrivate bool) (*services.DeckServiceImpl, *services.WebhookServiceImpl) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	conf := &config.Config{Database: config.Database{TestPath: filepath.Join(t.TempDir(), "test.db")}}
+	repo := repos.NewRepository(logger, true, conf)
+
+	broker := events.NewBroker(0)
+	dispatcher := webhooks.NewDispatcher(logger, repo)
+	dispatcher.BaseBackoff = 10 * time.Millisecond
+	dispatcher.PollInterval = 10 * time.Millisecond
+	dispatcher.MaxAttempts = 3
+	dispatcher.AllowPrivateAddresses = allowPrivate
+	broker.Listen(dispatcher.Handle)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatcher.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return services.NewDeckService(logger, repo, broker), services.NewWebhookService(logger, repo)
+}
+
+// wait until no delivery of the webhook is pending
+func waitForDeliveries(t *testing.T, webhookService *services.WebhookServiceImpl, webhookId string, count int) []dtos.RespWebhookDelivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := webhookService.ListDeliveries(context.Background(), "", webhookId, 0)
+		assert.NoError(t, err)
+
+		pending := 0
+		for _, delivery := range deliveries.Deliveries {
+			if delivery.Status == models.DeliveryPending {
+				pending++
+			}
+		}
+		if len(deliveries.Deliveries) == count && pending == 0 {
+			return deliveries.Deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries not done: %+v", deliveries.Deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDispatcherDeliversSignedLifecycleEvents(t *testing.T) {
+	deckService, webhookService := setup(t)
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	webhook, err := webhookService.CreateWebhook(context.Background(), "", dtos.ReqCreateWebhook{
+		URL:    server.URL,
+		Events: []string{models.WebhookDeckCreated, models.WebhookDeckExhausted, models.WebhookDeckDeleted},
+		Secret: "0123456789abcdef",
+	})
+	assert.NoError(t, err)
+
+	deck, err := deckService.CreateNewDeck(context.Background(), "", false, "AS,2S", nil)
+	assert.NoError(t, err)
+	_, err = deckService.DrawCard(context.Background(), "", deck.DeckID, 1, 0)
+	assert.NoError(t, err)
+	_, err = deckService.DrawCard(context.Background(), "", deck.DeckID, 1, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, deckService.DeleteDeck(context.Background(), "", deck.DeckID, 0))
+
+	deliveries := waitForDeliveries(t, webhookService, webhook.ID, 3)
+	for _, delivery := range deliveries {
+		assert.Equal(t, models.DeliverySucceeded, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, deck.DeckID, delivery.DeckID)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var types []string
+	for i, req := range rc.requests {
+		expected := webhooks.Sign("0123456789abcdef", req.Header.Get(webhooks.TimestampHeader), rc.bodies[i])
+		assert.Equal(t, expected, req.Header.Get(webhooks.SignatureHeader))
+
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rc.bodies[i], &body))
+		assert.Equal(t, req.Header.Get(webhooks.EventHeader), body["type"])
+		types = append(types, body["type"].(string))
+	}
+	// the first draw leaves a card, it isn't an event for webhooks
+	assert.Equal(t, []string{models.WebhookDeckCreated, models.WebhookDeckExhausted, models.WebhookDeckDeleted}, types)
+}
+
+func TestDispatcherRetriesFailedDeliveries(t *testing.T) {
+	deckService, webhookService := setup(t)
+	rc := &receiver{failures: 1}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	webhook, err := webhookService.CreateWebhook(context.Background(), "", dtos.ReqCreateWebhook{URL: server.URL, Events: []string{models.WebhookDeckCreated}})
+	assert.NoError(t, err)
+	assert.Len(t, webhook.Secret, 64)
+
+	_, err = deckService.CreateNewDeck(context.Background(), "", false, "", nil)
+	assert.NoError(t, err)
+
+	deliveries := waitForDeliveries(t, webhookService, webhook.ID, 1)
+	assert.Equal(t, models.DeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	deckService, webhookService := setup(t)
+	rc := &receiver{failures: 10}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	webhook, err := webhookService.CreateWebhook(context.Background(), "", dtos.ReqCreateWebhook{URL: server.URL, Events: []string{models.WebhookDeckCreated}})
+	assert.NoError(t, err)
+
+	_, err = deckService.CreateNewDeck(context.Background(), "", false, "", nil)
+	assert.NoError(t, err)
+
+	deliveries := waitForDeliveries(t, webhookService, webhook.ID, 1)
+	assert.Equal(t, models.DeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[0].LastStatusCode)
+	assert.Equal(t, "Receiver responded with status 500", deliveries[0].LastError)
+}
+
+func TestDeletedWebhookIsNotNotified(t *testing.T) {
+	deckService, webhookService := setup(t)
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	webhook, err := webhookService.CreateWebhook(context.Background(), "", dtos.ReqCreateWebhook{URL: server.URL, Events: []string{models.WebhookDeckCreated}})
+	assert.NoError(t, err)
+	assert.NoError(t, webhookService.DeleteWebhook(context.Background(), "", webhook.ID))
+	assert.ErrorIs(t, webhookService.DeleteWebhook(context.Background(), "", webhook.ID), services.ErrWebhookNotFound)
+
+	_, err = deckService.CreateNewDeck(context.Background(), "", false, "", nil)
+	assert.NoError(t, err)
+
+	_, err = webhookService.ListDeliveries(context.Background(), "", webhook.ID, 0)
+	assert.ErrorIs(t, err, services.ErrWebhookNotFound)
+	list, err := webhookService.ListWebhooks(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, list.Webhooks, 0)
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	deckService, webhookService := setupDispatcher(t, false)
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	// created without the handler checking its URL, as if the name resolved elsewhere then
+	webhook, err := webhookService.CreateWebhook(context.Background(), "", dtos.ReqCreateWebhook{URL: server.URL, Events: []string{models.WebhookDeckCreated}})
+	assert.NoError(t, err)
+
+	_, err = deckService.CreateNewDeck(context.Background(), "", false, "", nil)
+	assert.NoError(t, err)
+
+	deliveries := waitForDeliveries(t, webhookService, webhook.ID, 1)
+	assert.Equal(t, models.DeliveryFailed, deliveries[0].Status)
+	assert.Contains(t, deliveries[0].LastError, webhooks.ErrPrivateAddress.Error())
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	assert.Empty(t, rc.requests)
+}
+
+func TestDispatcherDoesNotFollowRedirects(t *testing.T) {
+	deckService, webhookService := setup(t)
+	rc := &receiver{}
+	target := httptest.NewServer(rc)
+	defer target.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	webhook, err := webhookService.CreateWebhook(context.Background(), "", dtos.ReqCreateWebhook{URL: redirect.URL, Events: []string{models.WebhookDeckCreated}})
+	assert.NoError(t, err)
+
+	_, err = deckService.CreateNewDeck(context.Background(), "", false, "", nil)
+	assert.NoError(t, err)
+
+	deliveries := waitForDeliveries(t, webhookService, webhook.ID, 1)
+	assert.Equal(t, models.DeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, http.StatusTemporaryRedirect, deliveries[0].LastStatusCode)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	assert.Empty(t, rc.requests)
+}
+
+func TestPublicIP(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "fe80::1", "fd00::1", "0.0.0.0", "::", "224.0.0.1", "::ffff:127.0.0.1"} {
+		assert.False(t, webhooks.PublicIP(net.ParseIP(addr)), addr)
+	}
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1::"} {
+		assert.True(t, webhooks.PublicIP(net.ParseIP(addr)), addr)
+	}
+}
+
+func TestDeliveriesAreQueuedWithTheChange(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	conf := &config.Config{Database: config.Database{TestPath: filepath.Join(t.TempDir(), "test.db")}}
+	repo := repos.NewRepository(logger, true, conf)
+
+	// no dispatcher listening or running
+	deckService := services.NewDeckService(logger, repo, events.NewBroker(0))
+	webhookService := services.NewWebhookService(logger, repo)
+
+	webhook, err := webhookService.CreateWebhook(context.Background(), "", dtos.ReqCreateWebhook{URL: "https://example.com/hooks", Events: []string{models.WebhookDeckCreated, models.WebhookDeckExhausted}})
+	assert.NoError(t, err)
+
+	deck, err := deckService.CreateNewDeck(context.Background(), "", false, "AS", nil)
+	assert.NoError(t, err)
+	_, err = deckService.DrawCard(context.Background(), "", deck.DeckID, 1, 0)
+	assert.NoError(t, err)
+
+	deliveries, err := webhookService.ListDeliveries(context.Background(), "", webhook.ID, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries.Deliveries, 2) {
+		for _, delivery := range deliveries.Deliveries {
+			assert.Equal(t, models.DeliveryPending, delivery.Status)
+			assert.Equal(t, deck.DeckID, delivery.DeckID)
+		}
+	}
+}